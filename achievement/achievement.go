@@ -0,0 +1,313 @@
+// Package achievement unlocks achievements defined as conditions over a
+// game's memory, evaluated at the end of every frame.
+//
+// Definitions are JSON:
+//
+//	{
+//	  "title": "Super Mario Bros.",
+//	  "achievements": [{
+//	    "id": "coins",
+//	    "title": "Coin Collector",
+//	    "description": "Collect 10 coins without losing a life",
+//	    "points": 5,
+//	    "conditions": [
+//	      {"left": "byte $075E", "cmp": ">", "right": "delta byte $075E", "hits": 10},
+//	      {"type": "reset-if", "left": "byte $075A", "cmp": "<", "right": "delta byte $075A"}
+//	    ],
+//	    "alternatives": [
+//	      [{"left": "byte $0760", "cmp": "==", "right": "0"}],
+//	      [{"left": "byte $0760", "cmp": "==", "right": "1"}]
+//	    ]
+//	  }]
+//	}
+//
+// An operand is a number or a memory reference: byte ADDR, word ADDR
+// (little-endian) or bit0 ADDR through bit7 ADDR, optionally prefixed with
+// delta for the value at the end of the previous frame.
+//
+// An achievement triggers when all of its conditions are true and, if it has
+// alternatives, all conditions of at least one alternative are true. A
+// condition with hits must be true on that many frames, not necessarily in a
+// row. A true reset-if condition clears the hit counts of the whole
+// achievement, and a true pause-if condition freezes the hit counts of its
+// group and keeps it from being true. An achievement only triggers after it
+// has been seen false once, so loading a state where it is already met does
+// not unlock it.
+package achievement
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fogleman/nes/nes"
+)
+
+// Set is the achievement definition file of a game.
+type Set struct {
+	Title        string         `json:"title"`
+	Achievements []*Achievement `json:"achievements"`
+}
+
+type Achievement struct {
+	ID           string         `json:"id"`
+	Title        string         `json:"title"`
+	Description  string         `json:"description"`
+	Points       int            `json:"points"`
+	Conditions   []*Condition   `json:"conditions"`
+	Alternatives [][]*Condition `json:"alternatives,omitempty"`
+	Unlocked     bool           `json:"-"`
+	primed       bool           // seen false since loading
+}
+
+// Condition types
+const (
+	ConditionNormal  = ""
+	ConditionResetIf = "reset-if"
+	ConditionPauseIf = "pause-if"
+)
+
+type Condition struct {
+	Type  string `json:"type,omitempty"`
+	Left  string `json:"left"`
+	Cmp   string `json:"cmp"`
+	Right string `json:"right"`
+	Hits  int    `json:"hits,omitempty"`
+	left  *operand
+	right *operand
+	hits  int
+}
+
+// operand is a constant or a memory reference
+type operand struct {
+	constant int
+	memory   bool
+	size     int // 1 or 2 bytes, or 0 for a single bit
+	bit      uint
+	address  uint16
+	delta    bool
+	previous int
+	current  int
+	read     bool // current holds a sample
+}
+
+// Load reads and compiles a definition file.
+func Load(r io.Reader) (*Set, error) {
+	var set Set
+	if err := json.NewDecoder(r).Decode(&set); err != nil {
+		return nil, err
+	}
+	for _, a := range set.Achievements {
+		for _, group := range a.groups() {
+			for _, c := range group {
+				if err := c.compile(); err != nil {
+					return nil, fmt.Errorf("achievement %s: %v", a.ID, err)
+				}
+			}
+		}
+	}
+	return &set, nil
+}
+
+// LoadFile reads and compiles the definition file at path.
+func LoadFile(path string) (*Set, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Load(file)
+}
+
+func (c *Condition) compile() error {
+	switch c.Type {
+	case ConditionNormal, ConditionResetIf, ConditionPauseIf:
+	default:
+		return fmt.Errorf("unknown condition type %q", c.Type)
+	}
+	switch c.Cmp {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return fmt.Errorf("unknown comparison %q", c.Cmp)
+	}
+	var err error
+	if c.left, err = parseOperand(c.Left); err != nil {
+		return err
+	}
+	if c.right, err = parseOperand(c.Right); err != nil {
+		return err
+	}
+	return nil
+}
+
+func parseOperand(s string) (*operand, error) {
+	fields := strings.Fields(strings.ToLower(s))
+	var o operand
+	if len(fields) > 0 && fields[0] == "delta" {
+		o.delta = true
+		fields = fields[1:]
+	}
+	switch {
+	case len(fields) == 1 && !o.delta:
+		n, err := nes.ParseNumber(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid operand %q", s)
+		}
+		o.constant = n
+		return &o, nil
+	case len(fields) != 2:
+		return nil, fmt.Errorf("invalid operand %q", s)
+	}
+	switch kind := fields[0]; {
+	case kind == "byte":
+		o.size = 1
+	case kind == "word":
+		o.size = 2
+	case len(kind) == 4 && strings.HasPrefix(kind, "bit") && kind[3] >= '0' && kind[3] <= '7':
+		o.bit = uint(kind[3] - '0')
+	default:
+		return nil, fmt.Errorf("invalid operand %q", s)
+	}
+	address, err := nes.ParseNumber(fields[1])
+	if err != nil || address < 0 || address > 0xFFFF {
+		return nil, fmt.Errorf("invalid address in %q", s)
+	}
+	o.memory = true
+	o.address = uint16(address)
+	return &o, nil
+}
+
+// sample reads the current value of a memory operand
+func (o *operand) sample(console *nes.Console) {
+	if !o.memory {
+		return
+	}
+	value := int(console.Peek(o.address))
+	switch o.size {
+	case 0:
+		value = value >> o.bit & 1
+	case 2:
+		value |= int(console.Peek(o.address+1)) << 8
+	}
+	if !o.read {
+		o.current = value
+		o.read = true
+	}
+	o.previous = o.current
+	o.current = value
+}
+
+func (o *operand) value() int {
+	switch {
+	case !o.memory:
+		return o.constant
+	case o.delta:
+		return o.previous
+	}
+	return o.current
+}
+
+func (c *Condition) test() bool {
+	a, b := c.left.value(), c.right.value()
+	switch c.Cmp {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	}
+	return a >= b
+}
+
+// update evaluates a condition for this frame and reports whether it is met
+func (c *Condition) update() bool {
+	if !c.test() {
+		return c.Hits > 0 && c.hits >= c.Hits
+	}
+	if c.Hits == 0 {
+		return true
+	}
+	if c.hits < c.Hits {
+		c.hits++
+	}
+	return c.hits >= c.Hits
+}
+
+// evaluate updates a group of conditions and reports whether they are all
+// met and whether a reset-if condition fired
+func evaluate(group []*Condition) (ok, reset bool) {
+	for _, c := range group {
+		if c.Type == ConditionPauseIf && c.test() {
+			return false, false
+		}
+	}
+	ok = true
+	for _, c := range group {
+		switch c.Type {
+		case ConditionResetIf:
+			if c.test() {
+				reset = true
+			}
+		case ConditionNormal:
+			if !c.update() {
+				ok = false
+			}
+		}
+	}
+	return ok && !reset, reset
+}
+
+func (a *Achievement) groups() [][]*Condition {
+	return append([][]*Condition{a.Conditions}, a.Alternatives...)
+}
+
+// reset clears all hit counts
+func (a *Achievement) reset() {
+	for _, group := range a.groups() {
+		for _, c := range group {
+			c.hits = 0
+		}
+	}
+}
+
+// restart forgets everything seen since loading, for when the console state
+// is replaced
+func (a *Achievement) restart() {
+	a.reset()
+	a.primed = false
+	for _, group := range a.groups() {
+		for _, c := range group {
+			c.left.read = false
+			c.right.read = false
+		}
+	}
+}
+
+// update evaluates the achievement for this frame and reports whether it
+// triggered
+func (a *Achievement) update() bool {
+	core, reset := evaluate(a.Conditions)
+	alt := len(a.Alternatives) == 0
+	for _, group := range a.Alternatives {
+		ok, r := evaluate(group)
+		alt = alt || ok
+		reset = reset || r
+	}
+	if reset {
+		a.reset()
+		a.primed = true
+		return false
+	}
+	if !(core && alt) {
+		a.primed = true
+		return false
+	}
+	return a.primed
+}
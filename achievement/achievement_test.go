@@ -0,0 +1,282 @@
+package achievement
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fogleman/nes/internal/testrom"
+	"github.com/fogleman/nes/nes"
+)
+
+func newTestConsole(t *testing.T) *nes.Console {
+	program := []byte{0x4C, 0x00, 0x80} // 8000 JMP $8000
+	console, err := nes.NewConsoleFromBytes(testrom.NROM(program))
+	if err != nil {
+		t.Fatal(err)
+	}
+	console.Reset()
+	return console
+}
+
+const testSet = `{
+  "title": "Test",
+  "achievements": [
+    {
+      "id": "coins",
+      "title": "Coins",
+      "points": 5,
+      "conditions": [
+        {"left": "byte $10", "cmp": ">", "right": "delta byte $10", "hits": 3},
+        {"type": "reset-if", "left": "byte $11", "cmp": "<", "right": "delta byte $11"},
+        {"type": "pause-if", "left": "bit7 $12", "cmp": "==", "right": "1"}
+      ]
+    },
+    {
+      "id": "world",
+      "title": "World 2 or 3",
+      "points": 10,
+      "conditions": [{"left": "word $20", "cmp": "==", "right": "$1234"}],
+      "alternatives": [
+        [{"left": "byte $22", "cmp": "==", "right": "2"}],
+        [{"left": "byte $22", "cmp": "==", "right": "3"}]
+      ]
+    }
+  ]
+}`
+
+type recordSink struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (s *recordSink) Unlock(u Unlock) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids = append(s.ids, u.ID)
+	return nil
+}
+
+func (s *recordSink) unlocked() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Join(s.ids, ",")
+}
+
+func TestEngine(t *testing.T) {
+	console := newTestConsole(t)
+	set, err := Load(strings.NewReader(testSet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &recordSink{}
+	e := NewEngine(console, set, "hash", sink, nil)
+	ram := console.RAM
+	frame := func() {
+		e.Update()
+	}
+
+	// world: met on the first frame, so it must become false before it can
+	// unlock
+	ram[0x20], ram[0x21], ram[0x22] = 0x34, 0x12, 2
+	ram[0x11] = 3
+	frame()
+	ram[0x22] = 1
+	frame()
+
+	// two coins, then a life is lost, resetting the hit count
+	ram[0x10]++
+	frame()
+	ram[0x10]++
+	frame()
+	ram[0x11]--
+	frame()
+	// paused: increases do not count
+	ram[0x12] = 0x80
+	ram[0x10]++
+	frame()
+	ram[0x12] = 0
+	ram[0x10]++
+	frame()
+	ram[0x10]++
+	frame()
+	if ids := e.Unlocked(); len(ids) != 0 {
+		t.Fatalf("unlocked early: %v", ids)
+	}
+	ram[0x10]++
+	ram[0x22] = 3
+	frame()
+	e.Close()
+	if got := sink.unlocked(); got != "coins,world" {
+		t.Errorf("got unlocks %q", got)
+	}
+	if ids := e.Unlocked(); len(ids) != 2 {
+		t.Errorf("got %v", ids)
+	}
+}
+
+func TestEngineUnlocked(t *testing.T) {
+	console := newTestConsole(t)
+	set, err := Load(strings.NewReader(testSet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &recordSink{}
+	e := NewEngine(console, set, "hash", sink, []string{"world"})
+	console.RAM[0x20], console.RAM[0x21], console.RAM[0x22] = 0, 0, 0
+	console.StepFrame()
+	console.RAM[0x20], console.RAM[0x21], console.RAM[0x22] = 0x34, 0x12, 2
+	console.StepFrame()
+	e.Close()
+	if got := sink.unlocked(); got != "" {
+		t.Errorf("got unlocks %q", got)
+	}
+}
+
+func TestEngineLoadState(t *testing.T) {
+	console := newTestConsole(t)
+	set, err := Load(strings.NewReader(testSet))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(console, set, "hash", &recordSink{}, nil)
+	var state bytes.Buffer
+	if err := console.Save(gob.NewEncoder(&state)); err != nil {
+		t.Fatal(err)
+	}
+
+	// world is seen false and two coins are collected
+	ram := console.RAM
+	ram[0x11], ram[0x22] = 3, 1
+	e.Update()
+	ram[0x10]++
+	e.Update()
+	ram[0x10]++
+	e.Update()
+
+	// neither carries over into the loaded state: world must be seen false
+	// again and the jump in coins is not an increase
+	if err := console.Load(gob.NewDecoder(&state)); err != nil {
+		t.Fatal(err)
+	}
+	ram = console.RAM
+	ram[0x20], ram[0x21], ram[0x22] = 0x34, 0x12, 2
+	ram[0x11], ram[0x10] = 3, 5
+	e.Update()
+	ram[0x10]++
+	e.Update()
+	if ids := e.Unlocked(); len(ids) != 0 {
+		t.Errorf("unlocked after loading: %v", ids)
+	}
+	e.Close()
+}
+
+type blockingSink struct {
+	release chan bool
+	recordSink
+}
+
+func (s *blockingSink) Unlock(u Unlock) error {
+	<-s.release
+	return s.recordSink.Unlock(u)
+}
+
+func TestEngineSlowSink(t *testing.T) {
+	console := newTestConsole(t)
+	var achievements []string
+	for i := 0; i < 20; i++ {
+		achievements = append(achievements, fmt.Sprintf(
+			`{"id": "a%d", "conditions": [{"left": "byte $30", "cmp": "==", "right": "1"}]}`, i))
+	}
+	set, err := Load(strings.NewReader(
+		`{"achievements": [` + strings.Join(achievements, ",") + `]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &blockingSink{release: make(chan bool)}
+	e := NewEngine(console, set, "hash", sink, nil)
+	var logged bytes.Buffer
+	e.ErrorLog = log.New(&logged, "", 0)
+
+	done := make(chan bool)
+	go func() {
+		e.Update()
+		console.RAM[0x30] = 1
+		e.Update()
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Update blocked on the sink")
+	}
+	close(sink.release)
+	e.Close()
+	delivered := len(strings.Split(sink.unlocked(), ","))
+	dropped := strings.Count(logged.String(), "dropped unlock")
+	if dropped == 0 || delivered+dropped != 20 {
+		t.Errorf("%d unlocks delivered and %d dropped", delivered, dropped)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, condition := range []string{
+		`{"left": "byte $10", "cmp": "=", "right": "1"}`,
+		`{"left": "nibble $10", "cmp": "==", "right": "1"}`,
+		`{"left": "delta 5", "cmp": "==", "right": "1"}`,
+		`{"type": "add-if", "left": "byte $10", "cmp": "==", "right": "1"}`,
+	} {
+		src := `{"achievements": [{"id": "a", "conditions": [` + condition + `]}]}`
+		if _, err := Load(strings.NewReader(src)); err == nil {
+			t.Errorf("%s: expected error", condition)
+		}
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var mu sync.Mutex
+	var received []Unlock
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var u Unlock
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received = append(received, u)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	var logged bytes.Buffer
+	sink := MultiSink{
+		&LogSink{Logger: log.New(&logged, "", 0)},
+		&WebhookSink{URL: server.URL},
+	}
+	u := Unlock{Game: "hash", ID: "coins", Title: "Coins", Points: 5}
+	if err := sink.Unlock(u); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(received) != 1 || received[0].ID != "coins" || received[0].Game != "hash" {
+		t.Errorf("webhook received %+v", received)
+	}
+	mu.Unlock()
+	if !strings.Contains(logged.String(), "Coins (5 points)") {
+		t.Errorf("logged %q", logged.String())
+	}
+
+	failing := &WebhookSink{URL: server.URL + "/missing"}
+	server.Config.Handler = http.NotFoundHandler()
+	if err := failing.Unlock(u); err == nil {
+		t.Error("expected error for 404")
+	}
+}
@@ -0,0 +1,141 @@
+package achievement
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fogleman/nes/nes"
+)
+
+// Unlock describes an unlocked achievement.
+type Unlock struct {
+	Game        string    `json:"game"` // MD5 of the ROM
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Points      int       `json:"points"`
+	Frame       uint64    `json:"frame"`
+	Time        time.Time `json:"time"`
+}
+
+// Engine evaluates a set of achievements against a console at the end of
+// every frame and sends unlocks to a sink. Sinks run on their own goroutine
+// so that slow sinks do not stall emulation.
+type Engine struct {
+	console *nes.Console
+	set     *Set
+	game    string
+	sink    Sink
+	unlocks chan Unlock
+	done    sync.WaitGroup
+	remove  func()
+	// ErrorLog receives errors returned by the sink and unlocks dropped
+	// because the sink fell behind; nil uses the log package's standard
+	// logger.
+	ErrorLog *log.Logger
+}
+
+// NewEngine attaches set to console. game identifies the ROM in unlocks;
+// achievements whose IDs are listed in unlocked start out unlocked.
+func NewEngine(console *nes.Console, set *Set, game string, sink Sink, unlocked []string) *Engine {
+	e := Engine{console: console, set: set, game: game, sink: sink}
+	done := make(map[string]bool)
+	for _, id := range unlocked {
+		done[id] = true
+	}
+	for _, a := range set.Achievements {
+		a.Unlocked = done[a.ID]
+	}
+	e.unlocks = make(chan Unlock, 16)
+	e.done.Add(1)
+	go e.deliver()
+	removeFrame := console.OnFrame(e.Update)
+	removeLoad := console.OnLoad(e.restart)
+	e.remove = func() {
+		removeFrame()
+		removeLoad()
+	}
+	return &e
+}
+
+// restart clears hit counts and deltas when a state is loaded, so that
+// nothing carries over from the frames before it
+func (e *Engine) restart() {
+	for _, a := range e.set.Achievements {
+		a.restart()
+	}
+}
+
+// Update evaluates the achievements. It is called at the end of every frame.
+func (e *Engine) Update() {
+	for _, a := range e.set.Achievements {
+		if a.Unlocked {
+			continue
+		}
+		for _, group := range a.groups() {
+			for _, c := range group {
+				c.left.sample(e.console)
+				c.right.sample(e.console)
+			}
+		}
+		if a.update() {
+			a.Unlocked = true
+			u := Unlock{
+				Game: e.game, ID: a.ID, Title: a.Title,
+				Description: a.Description, Points: a.Points,
+				Frame: e.console.PPU.Frame, Time: time.Now()}
+			select {
+			case e.unlocks <- u:
+			default:
+				// never stall emulation on a slow sink
+				e.println("achievement: sink is behind, dropped unlock", a.ID)
+			}
+		}
+	}
+}
+
+func (e *Engine) deliver() {
+	defer e.done.Done()
+	for u := range e.unlocks {
+		if err := e.sink.Unlock(u); err != nil {
+			e.println("achievement:", err)
+		}
+	}
+}
+
+func (e *Engine) println(v ...interface{}) {
+	if e.ErrorLog != nil {
+		e.ErrorLog.Println(v...)
+	} else {
+		log.Println(v...)
+	}
+}
+
+// Achievements returns the achievements being tracked.
+func (e *Engine) Achievements() []*Achievement {
+	return e.set.Achievements
+}
+
+// Unlocked returns the IDs of the unlocked achievements.
+func (e *Engine) Unlocked() []string {
+	var ids []string
+	for _, a := range e.set.Achievements {
+		if a.Unlocked {
+			ids = append(ids, a.ID)
+		}
+	}
+	return ids
+}
+
+// Close detaches the engine from the console and waits for pending unlocks
+// to be delivered.
+func (e *Engine) Close() {
+	if e.remove == nil {
+		return
+	}
+	e.remove()
+	e.remove = nil
+	close(e.unlocks)
+	e.done.Wait()
+}
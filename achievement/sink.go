@@ -0,0 +1,71 @@
+package achievement
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Sink receives unlocked achievements.
+type Sink interface {
+	Unlock(u Unlock) error
+}
+
+// LogSink logs unlocks. A nil Logger uses the log package's standard logger.
+type LogSink struct {
+	Logger *log.Logger
+}
+
+func (s *LogSink) Unlock(u Unlock) error {
+	msg := fmt.Sprintf("achievement unlocked: %s (%d points) - %s",
+		u.Title, u.Points, u.Description)
+	if s.Logger != nil {
+		s.Logger.Println(msg)
+	} else {
+		log.Println(msg)
+	}
+	return nil
+}
+
+// WebhookSink POSTs each unlock as JSON to URL.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client // nil uses a client with a 10 second timeout
+}
+
+func (s *WebhookSink) Unlock(u Unlock) error {
+	body, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s: %s", s.URL, resp.Status)
+	}
+	return nil
+}
+
+// MultiSink sends each unlock to every sink in turn, returning the first
+// error.
+type MultiSink []Sink
+
+func (m MultiSink) Unlock(u Unlock) error {
+	var first error
+	for _, s := range m {
+		if err := s.Unlock(u); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,23 @@
+// Package testrom builds small iNES images for tests.
+package testrom
+
+// Header is the iNES header of an NROM cartridge with 16KB of PRG-ROM and
+// 8KB of CHR-ROM.
+var Header = []byte{'N', 'E', 'S', 0x1A, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+// NROM returns an NROM image that runs program from $8000.
+func NROM(program []byte) []byte {
+	return Image(Header, program)
+}
+
+// Image returns an iNES image with the given header, a 16KB PRG-ROM holding
+// program at $8000 with the reset vector pointing at it, and 8KB of blank
+// CHR-ROM.
+func Image(header, program []byte) []byte {
+	prg := make([]byte, 0x4000)
+	copy(prg, program)
+	prg[0x3FFC], prg[0x3FFD] = 0x00, 0x80
+	rom := append([]byte(nil), header...)
+	rom = append(rom, prg...)
+	return append(rom, make([]byte, 0x2000)...)
+}
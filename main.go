@@ -1,27 +1,38 @@
 package main
 
 import (
+	"flag"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
-	"strings"
 
+	"github.com/fogleman/nes/nes"
 	"github.com/fogleman/nes/ui"
 )
 
 func main() {
 	log.SetFlags(0)
+	debug := flag.Bool("debug", false, "start the debugger on the terminal")
+	gdb := flag.String("gdb", "", "listen for GDB remote connections on this address")
+	script := flag.String("script", "", "run this script with the game")
+	webhook := flag.String("webhook", "", "POST achievement unlocks to this URL")
+	movie := flag.String("movie", "", "play this movie (.fm2 or .nesm) when the game starts")
+	patch := flag.String("patch", "", "apply this .ips, .bps or .ups patch to the game")
+	flag.Parse()
 	paths := getPaths()
 	if len(paths) == 0 {
 		log.Fatalln("no rom files specified or found")
 	}
-	ui.Run(paths)
+	if *patch != "" && len(paths) != 1 {
+		log.Fatalln("-patch needs a single rom file")
+	}
+	ui.Run(paths, ui.Options{Debug: *debug, GDB: *gdb, Script: *script, Webhook: *webhook, Movie: *movie, Patch: *patch})
 }
 
 func getPaths() []string {
 	var arg string
-	args := os.Args[1:]
+	args := flag.Args()
 	if len(args) == 1 {
 		arg = args[0]
 	} else {
@@ -39,7 +50,7 @@ func getPaths() []string {
 		var result []string
 		for _, info := range infos {
 			name := info.Name()
-			if !strings.HasSuffix(name, ".nes") {
+			if !nes.IsROMFile(name) {
 				continue
 			}
 			result = append(result, path.Join(arg, name))
@@ -2,7 +2,12 @@ package nes
 
 import "encoding/gob"
 
-const frameCounterRate = CPUFrequency / 240.0
+// dynamic rate control: every rateControlInterval samples the output rate
+// is nudged by up to maxRateDelta to keep the audio buffer half full
+const (
+	maxRateDelta        = 0.005
+	rateControlInterval = 64
+)
 
 var lengthTable = []byte{
 	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
@@ -29,34 +34,26 @@ var dmcTable = []byte{
 	214, 190, 170, 160, 143, 127, 113, 107, 95, 80, 71, 64, 53, 42, 36, 27,
 }
 
-var pulseTable [31]float32
-var tndTable [203]float32
-
-func init() {
-	for i := 0; i < 31; i++ {
-		pulseTable[i] = 95.52 / (8128.0/float32(i) + 100)
-	}
-	for i := 0; i < 203; i++ {
-		tndTable[i] = 163.67 / (24329.0/float32(i) + 100)
-	}
-}
-
 // APU
 
 type APU struct {
 	console     *Console
-	channel     chan float32
+	buffer      *AudioBuffer
 	sampleRate  float64
+	rateControl bool
+	rateCounter int
+	mixer       *Mixer
+	blip        [2]blipBuffer
 	pulse1      Pulse
 	pulse2      Pulse
 	triangle    Triangle
 	noise       Noise
 	dmc         DMC
-	cycle       uint64
+	cycle       uint64 // CPU cycles; the console's scheduler clock
 	framePeriod byte
 	frameValue  byte
 	frameIRQ    bool
-	filterChain FilterChain
+	filterChain [2]FilterChain
 }
 
 func NewAPU(console *Console) *APU {
@@ -66,7 +63,12 @@ func NewAPU(console *Console) *APU {
 	apu.pulse1.channel = 1
 	apu.pulse2.channel = 2
 	apu.framePeriod = 4
+	apu.rateControl = true
 	apu.dmc.cpu = console.CPU
+	expansion, _ := console.Mapper.(ExpansionAudio)
+	apu.mixer = NewMixer(expansion)
+	console.scheduler.handle(eventFrameCounter, apu.frameCounterEvent)
+	apu.scheduleFrameCounter()
 	return &apu
 }
 
@@ -85,6 +87,7 @@ func (apu *APU) Save(encoder *gob.Encoder) error {
 
 func (apu *APU) Load(decoder *gob.Decoder) error {
 	decoder.Decode(&apu.cycle)
+	apu.scheduleFrameCounter()
 	decoder.Decode(&apu.framePeriod)
 	decoder.Decode(&apu.frameValue)
 	decoder.Decode(&apu.frameIRQ)
@@ -97,39 +100,85 @@ func (apu *APU) Load(decoder *gob.Decoder) error {
 }
 
 func (apu *APU) Step() {
-	cycle1 := apu.cycle
 	apu.cycle++
-	cycle2 := apu.cycle
 	apu.stepTimer()
-	f1 := int(float64(cycle1) / frameCounterRate)
-	f2 := int(float64(cycle2) / frameCounterRate)
-	if f1 != f2 {
-		apu.stepFrameCounter()
+	if s := &apu.console.scheduler; apu.cycle >= s.next {
+		s.run(apu.cycle)
+	}
+	if apu.sampleRate != 0 {
+		// blip only needs the steps, so mix when a level changes
+		if levels := apu.levels(); apu.mixer.changed(levels) {
+			left, right := apu.mixer.mix(levels)
+			apu.blip[0].update(left)
+			apu.blip[1].update(right)
+		}
+		apu.blip[1].clock()
+		if apu.blip[0].clock() {
+			apu.sendSample(apu.blip[0].read(), apu.blip[1].read())
+		}
 	}
-	s1 := int(float64(cycle1) / apu.sampleRate)
-	s2 := int(float64(cycle2) / apu.sampleRate)
-	if s1 != s2 {
-		apu.sendSample()
+}
+
+// setSampleRate sets the output rate in samples per second; zero disables
+// sample generation
+func (apu *APU) setSampleRate(sampleRate float64) {
+	apu.sampleRate = sampleRate
+	for i := range apu.filterChain {
+		if sampleRate != 0 {
+			apu.blip[i].setRates(CPUFrequency, sampleRate)
+			apu.filterChain[i] = FilterChain{
+				HighPassFilter(float32(sampleRate), 90),
+				HighPassFilter(float32(sampleRate), 440),
+				LowPassFilter(float32(sampleRate), 14000),
+			}
+		} else {
+			apu.filterChain[i] = nil
+		}
 	}
 }
 
-func (apu *APU) sendSample() {
-	output := apu.filterChain.Step(apu.output())
-	select {
-	case apu.channel <- output:
-	default:
+func (apu *APU) sendSample(left, right float32) {
+	if apu.buffer == nil {
+		return
+	}
+	left = apu.filterChain[0].Step(left)
+	right = apu.filterChain[1].Step(right)
+	apu.buffer.Write(left, right)
+	if !apu.rateControl {
+		return
+	}
+	apu.rateCounter++
+	if apu.rateCounter >= rateControlInterval {
+		apu.rateCounter = 0
+		ratio := 1 + maxRateDelta*(1-2*apu.buffer.Fill())
+		apu.blip[0].setRates(CPUFrequency, apu.sampleRate*ratio)
+		apu.blip[1].setRates(CPUFrequency, apu.sampleRate*ratio)
+		apu.buffer.setRatio(ratio)
+	}
+}
+
+// levels returns the current output level of each 2A03 channel
+func (apu *APU) levels() [5]byte {
+	return [5]byte{
+		apu.pulse1.output(),
+		apu.pulse2.output(),
+		apu.triangle.output(),
+		apu.noise.output(),
+		apu.dmc.output(),
 	}
 }
 
-func (apu *APU) output() float32 {
-	p1 := apu.pulse1.output()
-	p2 := apu.pulse2.output()
-	t := apu.triangle.output()
-	n := apu.noise.output()
-	d := apu.dmc.output()
-	pulseOut := pulseTable[p1+p2]
-	tndOut := tndTable[3*t+2*n+d]
-	return pulseOut + tndOut
+// scheduleFrameCounter schedules the next frame counter tick. The frame
+// counter runs at 240 Hz, so tick k is on the first cycle at or after
+// k * CPUFrequency / 240.
+func (apu *APU) scheduleFrameCounter() {
+	k := apu.cycle*240/CPUFrequency + 1
+	apu.console.scheduler.schedule(eventFrameCounter, (k*CPUFrequency+239)/240)
+}
+
+func (apu *APU) frameCounterEvent() {
+	apu.stepFrameCounter()
+	apu.scheduleFrameCounter()
 }
 
 // mode 0:    mode 1:       function
@@ -832,6 +881,9 @@ func (d *DMC) stepReader() {
 	if d.currentLength > 0 && d.bitCount == 0 {
 		d.cpu.stall += 4
 		d.shiftRegister = d.cpu.Read(d.currentAddress)
+		if d.cpu.console.cdl != nil {
+			d.cpu.console.cdl.logPRG(d.currentAddress, CDLPCM)
+		}
 		d.bitCount = 8
 		d.currentAddress++
 		if d.currentAddress == 0 {
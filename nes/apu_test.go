@@ -0,0 +1,168 @@
+package nes
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+// newTestAPU returns an APU producing samples at sampleRate with no output
+// filtering, playing a 50% duty pulse wave with the given timer period.
+func newTestAPU(sampleRate float64, timerPeriod uint16) *APU {
+	apu := NewAPU(&Console{})
+	apu.setSampleRate(sampleRate)
+	apu.filterChain = [2]FilterChain{}
+	apu.rateControl = false
+	apu.writeControl(0x01)
+	apu.pulse1.writeControl(0xBF) // duty 50%, halt length, constant volume 15
+	apu.pulse1.writeTimerLow(byte(timerPeriod))
+	apu.pulse1.writeTimerHigh(byte(timerPeriod>>8) & 7)
+	return apu
+}
+
+// collectSamples runs the APU and returns the left channel output
+func collectSamples(apu *APU, cycles int) []float32 {
+	var samples []float32
+	apu.buffer = NewAudioBuffer(1024)
+	buf := make([]float32, 1024)
+	read := func() {
+		n := apu.buffer.Read(buf)
+		for i := 0; i < n; i += 2 {
+			samples = append(samples, buf[i])
+		}
+	}
+	for i := 0; i < cycles; i++ {
+		apu.Step()
+		if apu.buffer.Len() >= 512 {
+			read()
+		}
+	}
+	read()
+	return samples
+}
+
+func TestAPUSampleRate(t *testing.T) {
+	for _, rate := range []float64{44100, 48000} {
+		apu := newTestAPU(rate, 0x100)
+		samples := collectSamples(apu, CPUFrequency)
+		if len(samples) != int(rate) {
+			t.Errorf("%g Hz: got %d samples for one second", rate, len(samples))
+		}
+	}
+}
+
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a := x[start+k]
+				b := x[start+k+size/2] * wk
+				x[start+k] = a + b
+				x[start+k+size/2] = a - b
+				wk *= w
+			}
+		}
+	}
+}
+
+// aliasRatio returns the power outside the harmonics of frequency as a
+// fraction of the total power, ignoring DC.
+func aliasRatio(samples []float32, sampleRate, frequency float64) float64 {
+	const n = 1 << 15
+	x := make([]complex128, n)
+	for i := range x {
+		// blackman-harris window
+		a := 2 * math.Pi * float64(i) / (n - 1)
+		w := 0.35875 - 0.48829*math.Cos(a) + 0.14128*math.Cos(2*a) - 0.01168*math.Cos(3*a)
+		x[i] = complex(float64(samples[len(samples)-n+i])*w, 0)
+	}
+	fft(x)
+	binWidth := sampleRate / n
+	var total, harmonic float64
+	for i := 4; i < n/2; i++ {
+		p := real(x[i])*real(x[i]) + imag(x[i])*imag(x[i])
+		total += p
+		f := float64(i) * binWidth
+		k := math.Round(f / frequency)
+		if k >= 1 && math.Abs(f-k*frequency) < 6*binWidth {
+			harmonic += p
+		}
+	}
+	return (total - harmonic) / total
+}
+
+func TestAPUAliasing(t *testing.T) {
+	const rate = 48000
+	for _, period := range []uint16{20, 33, 57} {
+		frequency := CPUFrequency / (16 * (float64(period) + 1))
+		apu := newTestAPU(rate, period)
+		samples := collectSamples(apu, CPUFrequency)
+		ratio := aliasRatio(samples, rate, frequency)
+		db := 10 * math.Log10(ratio)
+		if db > -55 {
+			t.Errorf("%.0f Hz pulse: aliased power %.1f dB, want < -55 dB", frequency, db)
+		}
+	}
+}
+
+func TestAPURateControl(t *testing.T) {
+	// the consumer runs 0.3% fast relative to the emulated clock
+	const rate = 48000
+	const drift = 1.003
+	apu := newTestAPU(rate, 0x100)
+	apu.rateControl = true
+	apu.buffer = NewAudioBuffer(16384)
+	buf := make([]float32, 960)
+	interval := CPUFrequency / (rate * drift / float64(len(buf)/2))
+	next := interval
+	var stats AudioStats
+	for i := 0; i < CPUFrequency*10; i++ {
+		apu.Step()
+		if float64(i) >= next {
+			next += interval
+			apu.buffer.Read(buf)
+		}
+		if i == CPUFrequency*2 {
+			stats = apu.buffer.Stats()
+		}
+	}
+	end := apu.buffer.Stats()
+	if end.Underruns != stats.Underruns || end.Overruns != stats.Overruns {
+		t.Errorf("underruns %d -> %d, overruns %d -> %d after settling",
+			stats.Underruns, end.Underruns, stats.Overruns, end.Overruns)
+	}
+	// proportional control settles where the rate adjustment cancels the
+	// drift: 1 + maxRateDelta*(1-2*fill) = drift
+	want := (1 - (drift-1)/maxRateDelta) / 2
+	if math.Abs(end.Fill-want) > 0.1 {
+		t.Errorf("buffer fill %.2f, want %.2f", end.Fill, want)
+	}
+}
+
+func TestMixerPanAndMute(t *testing.T) {
+	m := NewMixer(nil)
+	levels := [5]byte{15, 0, 8, 0, 0}
+	l, r := m.mix(levels)
+	if l != r || l == 0 {
+		t.Fatalf("centered mix: got %g, %g", l, r)
+	}
+	m.SetPan(ChannelPulse1, -1)
+	m.SetMute(ChannelTriangle, true)
+	l, r = m.mix(levels)
+	if l == 0 || r != 0 {
+		t.Errorf("pulse1 panned left, triangle muted: got %g, %g", l, r)
+	}
+}
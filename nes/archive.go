@@ -0,0 +1,114 @@
+package nes
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// maxROMSize limits how much is read or unpacked for a single ROM; the
+// largest NES games are a few megabytes
+const maxROMSize = 16 << 20
+
+var errROMTooLarge = errors.New("rom is too large")
+
+// ROMExtensions are the file extensions of ROMs and archives that can be
+// loaded.
+var ROMExtensions = []string{".nes", ".zip", ".gz"}
+
+// IsROMFile reports whether a file name has one of the ROMExtensions.
+func IsROMFile(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, e := range ROMExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadROM reads a ROM image from r, unpacking it if it is a zip or gzip
+// archive. See UnpackROM.
+func ReadROM(r io.Reader) ([]byte, error) {
+	data, err := readLimited(r)
+	if err != nil {
+		return nil, err
+	}
+	return UnpackROM(data)
+}
+
+// UnpackROM returns the iNES image in data. Zip and gzip archives are
+// unpacked; in a zip, the first .nes entry with an iNES header is used,
+// falling back to any entry with one. Anything else is returned as is.
+func UnpackROM(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return unpackZip(data)
+	case bytes.HasPrefix(data, []byte{0x1F, 0x8B}):
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return readLimited(r)
+	case bytes.HasPrefix(data, []byte("7z\xBC\xAF\x27\x1C")):
+		return nil, errors.New("7z archives are not supported")
+	}
+	return data, nil
+}
+
+func unpackZip(data []byte) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var files []*zip.File
+	for _, f := range archive.File {
+		if strings.EqualFold(path.Ext(f.Name), ".nes") {
+			files = append(files, f)
+		}
+	}
+	for _, f := range archive.File {
+		if !strings.EqualFold(path.Ext(f.Name), ".nes") {
+			files = append(files, f)
+		}
+	}
+	for _, f := range files {
+		if f.FileInfo().IsDir() || f.UncompressedSize64 > maxROMSize {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		rom, err := readLimited(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		if isINES(rom) {
+			return rom, nil
+		}
+	}
+	return nil, errors.New("no .nes file in zip archive")
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxROMSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxROMSize {
+		return nil, errROMTooLarge
+	}
+	return data, nil
+}
+
+func isINES(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("NES\x1A"))
+}
@@ -0,0 +1,91 @@
+package nes
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fogleman/nes/internal/testrom"
+)
+
+func zipROM(t *testing.T, files map[string][]byte, order ...string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range order {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write(files[name])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUnpackROM(t *testing.T) {
+	rom := testrom.NROM(debuggerProgram)
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(rom)
+	w.Close()
+	files := map[string][]byte{
+		"readme.txt": []byte("hello"),
+		"other.bin":  rom,
+		"game.NES":   rom,
+		"fake.nes":   []byte("not a rom"),
+	}
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"plain", rom, true},
+		{"gzip", gz.Bytes(), true},
+		{"zip", zipROM(t, files, "readme.txt", "fake.nes", "game.NES"), true},
+		{"zip without .nes", zipROM(t, files, "readme.txt", "other.bin"), true},
+		{"zip without rom", zipROM(t, files, "readme.txt", "fake.nes"), false},
+		{"7z", []byte("7z\xBC\xAF\x27\x1C\x00\x04"), false},
+	}
+	for _, test := range tests {
+		got, err := UnpackROM(test.data)
+		if test.ok && (err != nil || !bytes.Equal(got, rom)) {
+			t.Errorf("%s: got %d bytes, %v", test.name, len(got), err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+
+	console, err := NewConsoleFromBytes(gz.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if console.Cartridge.PRG[0] != debuggerProgram[0] {
+		t.Error("wrong PRG")
+	}
+	data := zipROM(t, files, "game.NES")
+	if _, err := NewConsoleFromReader(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "game.zip")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewConsole(path); err != nil {
+		t.Fatal(err)
+	}
+	if !IsROMFile("Game.ZIP") || IsROMFile("game.txt") {
+		t.Error("IsROMFile")
+	}
+}
@@ -0,0 +1,107 @@
+package nes
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// AudioBuffer is a lock-free single-producer, single-consumer ring buffer
+// of samples between the APU (producer) and an audio output (consumer).
+// Samples are interleaved stereo: left, right, left, right...
+type AudioBuffer struct {
+	// accessed atomically; kept first for 64-bit alignment
+	readPos   uint64
+	writePos  uint64
+	underruns uint64
+	overruns  uint64
+	ratio     uint64 // float64 bits of the current resampling ratio
+
+	samples []float32
+	mask    uint64
+}
+
+// AudioStats reports the state of an AudioBuffer.
+type AudioStats struct {
+	Buffered  int     // values waiting to be played, two per stereo frame
+	Capacity  int     // total capacity in values, two per stereo frame
+	Fill      float64 // Buffered / Capacity
+	Underruns uint64  // reads that found fewer samples than requested
+	Overruns  uint64  // frames dropped because the buffer was full
+	Ratio     float64 // output rate adjustment applied by the APU
+}
+
+// NewAudioBuffer returns a buffer holding at least size samples.
+func NewAudioBuffer(size int) *AudioBuffer {
+	n := 2
+	for n < size {
+		n <<= 1
+	}
+	b := AudioBuffer{samples: make([]float32, n), mask: uint64(n - 1)}
+	b.ratio = math.Float64bits(1)
+	return &b
+}
+
+// Write appends a stereo frame, reporting false if the buffer was full.
+func (b *AudioBuffer) Write(left, right float32) bool {
+	w := atomic.LoadUint64(&b.writePos)
+	r := atomic.LoadUint64(&b.readPos)
+	if w-r+2 > uint64(len(b.samples)) {
+		atomic.AddUint64(&b.overruns, 1)
+		return false
+	}
+	b.samples[w&b.mask] = left
+	b.samples[(w+1)&b.mask] = right
+	atomic.StoreUint64(&b.writePos, w+2)
+	return true
+}
+
+// Read fills samples from the buffer and returns the number read, which is
+// always a whole number of frames. A short read counts as an underrun.
+func (b *AudioBuffer) Read(samples []float32) int {
+	r := atomic.LoadUint64(&b.readPos)
+	w := atomic.LoadUint64(&b.writePos)
+	n := int(w - r)
+	if want := len(samples) &^ 1; n < want {
+		atomic.AddUint64(&b.underruns, 1)
+	} else {
+		n = want
+	}
+	for i := 0; i < n; i++ {
+		samples[i] = b.samples[(r+uint64(i))&b.mask]
+	}
+	atomic.StoreUint64(&b.readPos, r+uint64(n))
+	return n
+}
+
+// Len returns the number of buffered samples.
+func (b *AudioBuffer) Len() int {
+	w := atomic.LoadUint64(&b.writePos)
+	r := atomic.LoadUint64(&b.readPos)
+	return int(w - r)
+}
+
+// Cap returns the capacity in samples.
+func (b *AudioBuffer) Cap() int {
+	return len(b.samples)
+}
+
+// Fill returns the buffered fraction, from 0 (empty) to 1 (full).
+func (b *AudioBuffer) Fill() float64 {
+	return float64(b.Len()) / float64(b.Cap())
+}
+
+func (b *AudioBuffer) Stats() AudioStats {
+	buffered := b.Len()
+	return AudioStats{
+		Buffered:  buffered,
+		Capacity:  b.Cap(),
+		Fill:      float64(buffered) / float64(b.Cap()),
+		Underruns: atomic.LoadUint64(&b.underruns),
+		Overruns:  atomic.LoadUint64(&b.overruns),
+		Ratio:     math.Float64frombits(atomic.LoadUint64(&b.ratio)),
+	}
+}
+
+func (b *AudioBuffer) setRatio(ratio float64) {
+	atomic.StoreUint64(&b.ratio, math.Float64bits(ratio))
+}
@@ -0,0 +1,49 @@
+package nes
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// BenchmarkROMs runs every ROM in ../rom and reports emulated frames per
+// second of CPU time.
+func BenchmarkROMs(b *testing.B) {
+	paths, _ := filepath.Glob("../rom/*.nes")
+	if len(paths) == 0 {
+		b.Skip("no roms in ../rom")
+	}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".nes")
+		b.Run(strings.Replace(name, " ", "_", -1), func(b *testing.B) {
+			console, err := NewConsole(path)
+			if err != nil {
+				b.Skip(err)
+			}
+			console.SetAudioSampleRate(44100)
+			for i := 0; i < 60; i++ {
+				console.StepFrame()
+			}
+			benchmarkFrames(b, console)
+		})
+	}
+}
+
+// BenchmarkStepFrame runs a small test program, for machines without ROMs.
+func BenchmarkStepFrame(b *testing.B) {
+	console := newTestConsole(b, joypadProgram)
+	console.SetAudioSampleRate(44100)
+	console.StepFrame()
+	benchmarkFrames(b, console)
+}
+
+func benchmarkFrames(b *testing.B, console *Console) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		console.StepFrame()
+	}
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "frames/s")
+}
@@ -0,0 +1,102 @@
+package nes
+
+import "math"
+
+// Band-limited step synthesis in the style of blip_buf. Instead of point
+// sampling the APU output once per output sample, every change in amplitude
+// is added to the output as a band-limited step at its exact sub-sample
+// position. This removes the aliasing of high-pitched square waves.
+
+const (
+	blipPhases    = 256  // sub-sample resolution of step positions
+	blipWidth     = 24   // kernel length in output samples
+	blipSize      = 64   // ring size, must be a power of two > blipWidth
+	blipCutoff    = 0.85 // kernel cutoff as a fraction of the nyquist rate
+	blipRateScale = 1 << 12
+)
+
+// blipKernel holds the band-limited impulse for each sub-sample phase
+var blipKernel [blipPhases][blipWidth]float32
+
+func init() {
+	for p := 0; p < blipPhases; p++ {
+		frac := float64(p) / blipPhases
+		var sum float64
+		var kernel [blipWidth]float64
+		for i := range kernel {
+			t := float64(i) - blipWidth/2 - frac
+			x := t / (blipWidth / 2)
+			if x <= -1 || x >= 1 {
+				continue
+			}
+			// windowed sinc (blackman window)
+			w := 0.42 + 0.5*math.Cos(math.Pi*x) + 0.08*math.Cos(2*math.Pi*x)
+			kernel[i] = sinc(blipCutoff*t) * w
+			sum += kernel[i]
+		}
+		for i := range kernel {
+			blipKernel[p][i] = float32(kernel[i] / sum)
+		}
+	}
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// blipBuffer converts a signal clocked at clockRate into samples at
+// sampleRate. Time is tracked with integer ticks so that exactly sampleRate
+// samples are produced for every clockRate clocks.
+type blipBuffer struct {
+	clockRate  uint64 // ticks per output sample
+	step       uint64 // ticks per input clock
+	offset     uint64 // ticks elapsed in the current output sample
+	head       int    // ring index of the current output sample
+	amplitude  float32
+	integrator float64
+	buffer     [blipSize]float64
+}
+
+func (b *blipBuffer) setRates(clockRate, sampleRate float64) {
+	b.clockRate = uint64(math.Round(clockRate)) * blipRateScale
+	b.step = uint64(math.Round(sampleRate * blipRateScale))
+}
+
+// addDelta adds a band-limited step of the given size at the current time
+func (b *blipBuffer) addDelta(delta float32) {
+	phase := int(b.offset * blipPhases / b.clockRate)
+	kernel := &blipKernel[phase]
+	for i := 0; i < blipWidth; i++ {
+		b.buffer[(b.head+i)&(blipSize-1)] += float64(delta * kernel[i])
+	}
+}
+
+// update adds a step if amplitude differs from the current amplitude
+func (b *blipBuffer) update(amplitude float32) {
+	if amplitude != b.amplitude {
+		b.addDelta(amplitude - b.amplitude)
+		b.amplitude = amplitude
+	}
+}
+
+// clock advances time by one input clock and reports whether an output
+// sample is ready to be read
+func (b *blipBuffer) clock() bool {
+	b.offset += b.step
+	if b.offset < b.clockRate {
+		return false
+	}
+	b.offset -= b.clockRate
+	return true
+}
+
+// read returns the next output sample
+func (b *blipBuffer) read() float32 {
+	b.integrator += b.buffer[b.head]
+	b.buffer[b.head] = 0
+	b.head = (b.head + 1) & (blipSize - 1)
+	return float32(b.integrator)
+}
@@ -9,11 +9,15 @@ type Cartridge struct {
 	Mapper  byte   // mapper type
 	Mirror  byte   // mirroring mode
 	Battery byte   // battery present
+	CHRRAM  bool   // CHR is RAM rather than ROM
+
+	Info        *GameInfo // game database entry, if found
+	HeaderFixes []string  // header values corrected while loading
 }
 
 func NewCartridge(prg, chr []byte, mapper, mirror, battery byte) *Cartridge {
 	sram := make([]byte, 0x2000)
-	return &Cartridge{prg, chr, sram, mapper, mirror, battery}
+	return &Cartridge{prg, chr, sram, mapper, mirror, battery, false, nil, nil}
 }
 
 func (cartridge *Cartridge) Save(encoder *gob.Encoder) error {
@@ -0,0 +1,199 @@
+package nes
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// PRG flags, as in FCEUX .cdl files. Bits 2-3 hold the CPU bank ($8000,
+// $A000, $C000 or $E000) the byte was last accessed through.
+const (
+	CDLCode         = 0x01 // executed
+	CDLData         = 0x02 // read as data
+	CDLIndirectCode = 0x10 // jumped to through a pointer
+	CDLIndirectData = 0x20 // read through a pointer
+	CDLPCM          = 0x40 // read as DMC sample data
+)
+
+// CHR flags
+const (
+	CDLDrawn = 0x01 // fetched by the PPU for rendering
+	CDLRead  = 0x02 // read by the CPU through $2007
+)
+
+// romMapper is implemented by mappers that can report where a CPU or PPU
+// address currently maps in PRG or CHR. Offsets are -1 outside ROM.
+type romMapper interface {
+	prgOffset(address uint16) int
+	chrOffset(address uint16) int
+}
+
+// CodeDataLogger records how each PRG and CHR byte is used while the
+// console runs.
+type CodeDataLogger struct {
+	mapper romMapper
+	PRG    []byte
+	CHR    []byte // nil for CHR RAM
+}
+
+// CDLCoverage summarizes a code/data log.
+type CDLCoverage struct {
+	PRGSize  int
+	Code     int // bytes executed
+	Data     int // bytes read as data but never executed
+	PRGUsed  int // bytes with any flag
+	CHRSize  int
+	CHRDrawn int
+	CHRUsed  int
+}
+
+// StartCDL attaches a new code/data logger to the console. It returns nil
+// if the mapper does not support logging.
+func (console *Console) StartCDL() *CodeDataLogger {
+	mapper, ok := console.Mapper.(romMapper)
+	if !ok {
+		return nil
+	}
+	cdl := CodeDataLogger{mapper: mapper}
+	cdl.PRG = make([]byte, len(console.Cartridge.PRG))
+	if !console.Cartridge.CHRRAM {
+		cdl.CHR = make([]byte, len(console.Cartridge.CHR))
+	}
+	console.cdl = &cdl
+	return &cdl
+}
+
+// CDL returns the attached code/data logger, if any.
+func (console *Console) CDL() *CodeDataLogger {
+	return console.cdl
+}
+
+// StopCDL detaches the code/data logger.
+func (console *Console) StopCDL() {
+	console.cdl = nil
+}
+
+func (cdl *CodeDataLogger) logPRG(address uint16, flags byte) {
+	offset := cdl.mapper.prgOffset(address)
+	if offset < 0 || offset >= len(cdl.PRG) {
+		return
+	}
+	bank := byte(address>>13&3) << 2
+	cdl.PRG[offset] = cdl.PRG[offset]&^0x0C | flags | bank
+}
+
+func (cdl *CodeDataLogger) logCHR(address uint16, flags byte) {
+	if cdl.CHR == nil {
+		return
+	}
+	offset := cdl.mapper.chrOffset(address)
+	if offset < 0 || offset >= len(cdl.CHR) {
+		return
+	}
+	cdl.CHR[offset] |= flags
+}
+
+// cdlReads lists the instructions that read their memory operand
+var cdlReads = map[string]bool{
+	"ADC": true, "AND": true, "ASL": true, "BIT": true, "CMP": true,
+	"CPX": true, "CPY": true, "DEC": true, "EOR": true, "INC": true,
+	"LDA": true, "LDX": true, "LDY": true, "LSR": true, "ORA": true,
+	"ROL": true, "ROR": true, "SBC": true, "DCP": true, "ISC": true,
+	"LAS": true, "LAX": true, "RLA": true, "RRA": true, "SLO": true,
+	"SRE": true,
+}
+
+// logInstruction records the instruction about to execute at the CPU's PC,
+// whose effective address is address
+func (cdl *CodeDataLogger) logInstruction(cpu *CPU, opcode byte, address uint16) {
+	mode := instructionModes[opcode]
+	size := uint16(instructionSizes[opcode])
+	if size == 0 {
+		size = 1
+	}
+	for i := uint16(0); i < size; i++ {
+		cdl.logPRG(cpu.PC+i, CDLCode)
+	}
+	indirect := byte(0)
+	switch mode {
+	case modeIndirect:
+		peek := cpu.console.Peek
+		pointer := uint16(peek(cpu.PC+2))<<8 | uint16(peek(cpu.PC+1))
+		cdl.logPRG(pointer, CDLData)
+		cdl.logPRG(pointer&0xFF00|uint16(byte(pointer)+1), CDLData)
+		cdl.logPRG(address, CDLIndirectCode)
+		return
+	case modeIndexedIndirect, modeIndirectIndexed:
+		indirect = CDLIndirectData
+	case modeAbsolute, modeAbsoluteX, modeAbsoluteY,
+		modeZeroPage, modeZeroPageX, modeZeroPageY:
+	default:
+		return
+	}
+	if cdlReads[instructionNames[opcode]] {
+		cdl.logPRG(address, CDLData|indirect)
+	}
+}
+
+// Coverage counts the logged bytes.
+func (cdl *CodeDataLogger) Coverage() CDLCoverage {
+	c := CDLCoverage{PRGSize: len(cdl.PRG), CHRSize: len(cdl.CHR)}
+	for _, flags := range cdl.PRG {
+		flags &^= 0x0C
+		if flags != 0 {
+			c.PRGUsed++
+		}
+		if flags&CDLCode != 0 {
+			c.Code++
+		} else if flags != 0 {
+			c.Data++
+		}
+	}
+	for _, flags := range cdl.CHR {
+		if flags != 0 {
+			c.CHRUsed++
+		}
+		if flags&CDLDrawn != 0 {
+			c.CHRDrawn++
+		}
+	}
+	return c
+}
+
+// WriteTo writes the log in FCEUX .cdl format: PRG flags followed by CHR
+// flags, which are omitted for CHR RAM.
+func (cdl *CodeDataLogger) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(cdl.PRG)
+	if err != nil {
+		return int64(n), err
+	}
+	m, err := w.Write(cdl.CHR)
+	return int64(n + m), err
+}
+
+// ReadFrom merges a log in FCEUX .cdl format into this one.
+func (cdl *CodeDataLogger) ReadFrom(r io.Reader) (int64, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return int64(len(data)), err
+	}
+	for i, flags := range data {
+		if i < len(cdl.PRG) {
+			cdl.PRG[i] |= flags
+		} else if i-len(cdl.PRG) < len(cdl.CHR) {
+			cdl.CHR[i-len(cdl.PRG)] |= flags
+		}
+	}
+	return int64(len(data)), nil
+}
+
+func (cdl *CodeDataLogger) SaveFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = cdl.WriteTo(file)
+	return err
+}
@@ -0,0 +1,42 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCodeDataLogger(t *testing.T) {
+	program := []byte{
+		0xAD, 0x10, 0x80, // 8000 LDA $8010
+		0x6C, 0x12, 0x80, // 8003 JMP ($8012)
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0x42,       // 8010 data
+		0,          // 8011 unused
+		0x00, 0x80, // 8012 pointer to $8000
+	}
+	console := newTestConsole(t, program)
+	cdl := console.StartCDL()
+	console.StepFrame()
+	tests := []struct {
+		offset int
+		flags  byte
+	}{
+		{0x00, CDLCode | CDLIndirectCode},
+		{0x05, CDLCode},
+		{0x06, 0},
+		{0x10, CDLData},
+		{0x11, 0},
+		{0x12, CDLData},
+		{0x13, CDLData},
+	}
+	for _, test := range tests {
+		if got := cdl.PRG[test.offset] &^ 0x0C; got != test.flags {
+			t.Errorf("PRG $%04X: flags %02X, want %02X", test.offset, got, test.flags)
+		}
+	}
+	var buf bytes.Buffer
+	cdl.WriteTo(&buf)
+	if buf.Len() != len(cdl.PRG)+len(cdl.CHR) {
+		t.Errorf("cdl file is %d bytes, want %d", buf.Len(), len(cdl.PRG)+len(cdl.CHR))
+	}
+}
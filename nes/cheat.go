@@ -0,0 +1,234 @@
+package nes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const gameGenieLetters = "APZLGITYEOXUKSVN"
+
+// Cheat is a Game Genie code, which patches reads of PRG-ROM, or a RAM
+// cheat, which stores a value in memory every frame.
+type Cheat struct {
+	Code    string
+	Name    string
+	Enabled bool
+	Address uint16
+	Value   byte
+	Compare int  // value the ROM must hold for the patch to apply; -1 for any
+	RAM     bool // written to memory every frame rather than patching ROM
+}
+
+// ParseCheat decodes a 6 or 8 letter Game Genie code, a Pro Action Replay
+// code (8 hex digits, 00AAAAVV) or a raw RAM cheat written as AAAA:VV.
+func ParseCheat(code string) (*Cheat, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	cheat := Cheat{Code: code, Enabled: true, Compare: -1}
+	switch {
+	case strings.Contains(code, ":"):
+		parts := strings.SplitN(code, ":", 2)
+		address, err1 := strconv.ParseUint(parts[0], 16, 16)
+		value, err2 := strconv.ParseUint(parts[1], 16, 8)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid RAM cheat: %s", code)
+		}
+		cheat.Address = uint16(address)
+		cheat.Value = byte(value)
+		cheat.RAM = true
+	case len(code) == 8 && isHex(code):
+		n, _ := strconv.ParseUint(code, 16, 32)
+		cheat.Address = uint16(n >> 8)
+		cheat.Value = byte(n)
+		cheat.RAM = true
+	case len(code) == 6 || len(code) == 8:
+		var n [8]uint16
+		for i := 0; i < len(code); i++ {
+			index := strings.IndexByte(gameGenieLetters, code[i])
+			if index < 0 {
+				return nil, fmt.Errorf("invalid Game Genie code: %s", code)
+			}
+			n[i] = uint16(index)
+		}
+		cheat.Address = 0x8000 |
+			(n[3]&7)<<12 | (n[5]&7)<<8 | (n[4]&8)<<8 |
+			(n[2]&7)<<4 | (n[1]&8)<<4 | n[4]&7 | n[3]&8
+		value := (n[1]&7)<<4 | (n[0]&8)<<4 | n[0]&7
+		if len(code) == 6 {
+			value |= n[5] & 8
+		} else {
+			value |= n[7] & 8
+			cheat.Compare = int((n[7]&7)<<4 | (n[6]&8)<<4 | n[6]&7 | n[5]&8)
+		}
+		cheat.Value = byte(value)
+	default:
+		return nil, fmt.Errorf("unrecognized cheat code: %s", code)
+	}
+	return &cheat, nil
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !strings.ContainsRune("0123456789ABCDEF", rune(s[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Cheat) String() string {
+	if c.Name == "" {
+		return c.Code
+	}
+	return c.Code + " " + c.Name
+}
+
+// cheatEngine holds the cheats of a console
+type cheatEngine struct {
+	cheats  []*Cheat
+	patches map[uint16][]*Cheat // enabled ROM patches by address
+	ram     []*Cheat            // enabled RAM cheats
+}
+
+// update rebuilds the lists of enabled cheats
+func (e *cheatEngine) update() {
+	e.patches = make(map[uint16][]*Cheat)
+	e.ram = nil
+	for _, c := range e.cheats {
+		if !c.Enabled {
+			continue
+		}
+		if c.RAM {
+			e.ram = append(e.ram, c)
+		} else {
+			e.patches[c.Address] = append(e.patches[c.Address], c)
+		}
+	}
+}
+
+// patch applies Game Genie codes to a value read from PRG-ROM
+func (e *cheatEngine) patch(address uint16, value byte) byte {
+	for _, c := range e.patches[address] {
+		if c.Compare < 0 || int(value) == c.Compare {
+			return c.Value
+		}
+	}
+	return value
+}
+
+func writableRAM(address uint16) bool {
+	return address < 0x2000 || address >= 0x6000 && address < 0x8000
+}
+
+// apply stores the RAM cheats
+func (e *cheatEngine) apply(console *Console) {
+	for _, c := range e.ram {
+		if c.Address < 0x2000 {
+			console.RAM[c.Address%0x0800] = c.Value
+		} else {
+			console.Mapper.Write(c.Address, c.Value)
+		}
+	}
+}
+
+// AddCheat adds and enables a cheat. Adding a code that is already present
+// replaces it. RAM cheats must target internal RAM ($0000-$1FFF) or
+// cartridge RAM ($6000-$7FFF).
+func (console *Console) AddCheat(code, name string) (*Cheat, error) {
+	cheat, err := ParseCheat(code)
+	if err != nil {
+		return nil, err
+	}
+	if cheat.RAM && !writableRAM(cheat.Address) {
+		return nil, fmt.Errorf("RAM cheat address $%04X is not RAM: %s", cheat.Address, cheat.Code)
+	}
+	cheat.Name = name
+	console.RemoveCheat(cheat.Code)
+	if console.cheats == nil {
+		console.cheats = &cheatEngine{}
+	}
+	console.cheats.cheats = append(console.cheats.cheats, cheat)
+	console.cheats.update()
+	return cheat, nil
+}
+
+func (console *Console) RemoveCheat(code string) bool {
+	e := console.cheats
+	if e == nil {
+		return false
+	}
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for i, c := range e.cheats {
+		if c.Code == code {
+			e.cheats = append(e.cheats[:i], e.cheats[i+1:]...)
+			e.update()
+			return true
+		}
+	}
+	return false
+}
+
+func (console *Console) EnableCheat(code string, enabled bool) bool {
+	e := console.cheats
+	if e == nil {
+		return false
+	}
+	code = strings.ToUpper(strings.TrimSpace(code))
+	for _, c := range e.cheats {
+		if c.Code == code {
+			c.Enabled = enabled
+			e.update()
+			return true
+		}
+	}
+	return false
+}
+
+func (console *Console) Cheats() []*Cheat {
+	if console.cheats == nil {
+		return nil
+	}
+	return append([]*Cheat(nil), console.cheats.cheats...)
+}
+
+// ReadCheats adds cheats from r, one per line: the code, optionally
+// followed by a name. Lines starting with "-" are disabled cheats and
+// lines starting with "#" are comments.
+func (console *Console) ReadCheats(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		enabled := !strings.HasPrefix(line, "-")
+		line = strings.TrimPrefix(line, "-")
+		fields := strings.SplitN(line, " ", 2)
+		name := ""
+		if len(fields) == 2 {
+			name = strings.TrimSpace(fields[1])
+		}
+		cheat, err := console.AddCheat(fields[0], name)
+		if err != nil {
+			return err
+		}
+		console.EnableCheat(cheat.Code, enabled)
+	}
+	return scanner.Err()
+}
+
+// WriteCheats writes the cheats in the format read by ReadCheats.
+func (console *Console) WriteCheats(w io.Writer) error {
+	for _, c := range console.Cheats() {
+		prefix := ""
+		if !c.Enabled {
+			prefix = "-"
+		}
+		if _, err := fmt.Fprintf(w, "%s%s\n", prefix, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
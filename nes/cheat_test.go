@@ -0,0 +1,73 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseCheat(t *testing.T) {
+	tests := []struct {
+		code    string
+		address uint16
+		value   byte
+		compare int
+		ram     bool
+	}{
+		{"SXIOPO", 0x91D9, 0xAD, -1, false},
+		{"GOSSIP", 0xD1DD, 0x14, -1, false},
+		{"ZEXPYGLA", 0x94A7, 0x02, 0x03, false},
+		{"0075:09", 0x0075, 0x09, -1, true},
+		{"00075A09", 0x075A, 0x09, -1, true},
+	}
+	for _, test := range tests {
+		c, err := ParseCheat(test.code)
+		if err != nil {
+			t.Errorf("%s: %v", test.code, err)
+			continue
+		}
+		if c.Address != test.address || c.Value != test.value ||
+			c.Compare != test.compare || c.RAM != test.ram {
+			t.Errorf("%s: got $%04X=%02X compare %d ram %v", test.code,
+				c.Address, c.Value, c.Compare, c.RAM)
+		}
+	}
+	if _, err := ParseCheat("QQQQQQ"); err == nil {
+		t.Error("expected error for invalid code")
+	}
+}
+
+func TestCheats(t *testing.T) {
+	console := newTestConsole(t, debuggerProgram)
+	console.AddCheat("0301:07", "ram")
+	console.AddCheat("SXIOPO", "")
+	if _, err := console.AddCheat("ZEXPYGLA", "compare mismatch"); err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"2000:80", "4015:00", "8000:EA", "00401500"} {
+		if _, err := console.AddCheat(code, ""); err == nil {
+			t.Errorf("%s: expected error for a RAM cheat outside RAM", code)
+		}
+	}
+	console.StepFrame()
+	if console.RAM[0x301] != 7 {
+		t.Errorf("RAM cheat: $0301 = %d, want 7", console.RAM[0x301])
+	}
+	if value := console.CPU.Read(0x91D9); value != 0xAD {
+		t.Errorf("6 letter code: read $%02X, want $AD", value)
+	}
+	if console.CPU.Read(0x94A7) != 0 {
+		t.Errorf("8 letter code applied although the compare value differs")
+	}
+
+	var buf bytes.Buffer
+	console.EnableCheat("0301:07", false)
+	console.WriteCheats(&buf)
+	other := newTestConsole(t, debuggerProgram)
+	if err := other.ReadCheats(&buf); err != nil {
+		t.Fatal(err)
+	}
+	cheats := other.Cheats()
+	if len(cheats) != 3 || cheats[0].Enabled || cheats[0].Name != "ram" || !cheats[1].Enabled {
+		t.Errorf("cheat file round trip: %v", cheats)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/gob"
 	"image"
 	"image/color"
+	"io"
 	"os"
 	"path"
 )
@@ -17,6 +18,15 @@ type Console struct {
 	Controller2 *Controller
 	Mapper      Mapper
 	RAM         []byte
+	Palette     *Palette
+	debugger    *Debugger
+	cdl         *CodeDataLogger
+	cheats      *cheatEngine
+	hooks       *hooks
+	movie       *moviePlayer
+	stepper     Mapper   // the mapper, unless its Step does nothing
+	mapper2     *Mapper2 // the mapper, if the PPU can read its CHR directly
+	scheduler   scheduler
 }
 
 func NewConsole(path string) (*Console, error) {
@@ -24,16 +34,45 @@ func NewConsole(path string) (*Console, error) {
 	if err != nil {
 		return nil, err
 	}
+	return newConsole(cartridge)
+}
+
+// NewConsoleFromReader creates a console for the iNES image, or zip or gzip
+// archive containing one, read from r.
+func NewConsoleFromReader(r io.Reader) (*Console, error) {
+	cartridge, err := ReadNES(r)
+	if err != nil {
+		return nil, err
+	}
+	return newConsole(cartridge)
+}
+
+// NewConsoleFromBytes creates a console for an iNES image, or zip or gzip
+// archive containing one, held in memory.
+func NewConsoleFromBytes(data []byte) (*Console, error) {
+	cartridge, err := LoadNES(data)
+	if err != nil {
+		return nil, err
+	}
+	return newConsole(cartridge)
+}
+
+func newConsole(cartridge *Cartridge) (*Console, error) {
 	ram := make([]byte, 2048)
 	controller1 := NewController()
 	controller2 := NewController()
 	console := Console{
-		nil, nil, nil, cartridge, controller1, controller2, nil, ram}
+		nil, nil, nil, cartridge, controller1, controller2, nil, ram,
+		DefaultPalette, nil, nil, nil, nil, nil, nil, nil, scheduler{}}
 	mapper, err := NewMapper(&console)
 	if err != nil {
 		return nil, err
 	}
 	console.Mapper = mapper
+	if _, ok := mapper.(idleMapper); !ok {
+		console.stepper = mapper
+	}
+	console.mapper2, _ = mapper.(*Mapper2)
 	console.CPU = NewCPU(&console)
 	console.APU = NewAPU(&console)
 	console.PPU = NewPPU(&console)
@@ -41,19 +80,41 @@ func NewConsole(path string) (*Console, error) {
 }
 
 func (console *Console) Reset() {
+	if console.movie != nil {
+		if console.movie.recording {
+			console.movie.commands |= MovieReset
+		}
+		return
+	}
 	console.CPU.Reset()
 }
 
 func (console *Console) Step() int {
+	debugger := console.debugger
+	if debugger != nil && debugger.before() {
+		return 0
+	}
+	if console.movie != nil && console.movie.boundary {
+		console.movie.advance(console)
+	}
 	cpuCycles := console.CPU.Step()
 	ppuCycles := cpuCycles * 3
-	for i := 0; i < ppuCycles; i++ {
-		console.PPU.Step()
-		console.Mapper.Step()
+	if stepper := console.stepper; stepper != nil {
+		for i := 0; i < ppuCycles; i++ {
+			console.PPU.Step()
+			stepper.Step()
+		}
+	} else {
+		for i := 0; i < ppuCycles; i++ {
+			console.PPU.Step()
+		}
 	}
 	for i := 0; i < cpuCycles; i++ {
 		console.APU.Step()
 	}
+	if debugger != nil {
+		debugger.after()
+	}
 	return cpuCycles
 }
 
@@ -61,52 +122,132 @@ func (console *Console) StepFrame() int {
 	cpuCycles := 0
 	frame := console.PPU.Frame
 	for frame == console.PPU.Frame {
-		cpuCycles += console.Step()
+		cycles := console.Step()
+		if cycles == 0 {
+			break // paused in the debugger
+		}
+		cpuCycles += cycles
 	}
 	return cpuCycles
 }
 
+// endFrame is called by the PPU at the start of vertical blank
+func (console *Console) endFrame() {
+	if console.movie != nil {
+		console.movie.boundary = true
+	}
+	if console.cheats != nil {
+		console.cheats.apply(console)
+	}
+	if console.hooks != nil {
+		for _, h := range console.hooks.frame {
+			h.f()
+		}
+	}
+}
+
 func (console *Console) StepSeconds(seconds float64) {
 	cycles := int(CPUFrequency * seconds)
 	for cycles > 0 {
-		cycles -= console.Step()
+		n := console.Step()
+		if n == 0 {
+			break // paused in the debugger
+		}
+		cycles -= n
 	}
 }
 
+// Peek reads a byte from the CPU address space without side effects.
+// I/O registers read as zero.
+func (console *Console) Peek(address uint16) byte {
+	return console.CPU.Memory.(*cpuMemory).peek(address)
+}
+
 func (console *Console) Buffer() *image.RGBA {
 	return console.PPU.front
 }
 
+// IndexedBuffer returns the most recent frame as palette indexes. Pixels
+// index into console.Palette; see IndexedImage.
+func (console *Console) IndexedBuffer() *IndexedImage {
+	return console.PPU.frontIndex
+}
+
 func (console *Console) BackgroundColor() color.RGBA {
-	return Palette[console.PPU.readPalette(0)%64]
+	ppu := console.PPU
+	return console.Palette.Lookup(
+		ppu.readPalette(0), ppu.flagGrayscale == 1, ppu.emphasis())
+}
+
+// SetPalette sets the colors used to render frames. A nil palette restores
+// DefaultPalette.
+func (console *Console) SetPalette(palette *Palette) {
+	if palette == nil {
+		palette = DefaultPalette
+	}
+	console.Palette = palette
 }
 
 func (console *Console) SetButtons1(buttons [8]bool) {
-	console.Controller1.SetButtons(buttons)
+	console.setButtons(0, console.Controller1, buttons)
 }
 
 func (console *Console) SetButtons2(buttons [8]bool) {
-	console.Controller2.SetButtons(buttons)
+	console.setButtons(1, console.Controller2, buttons)
 }
 
-func (console *Console) SetAudioChannel(channel chan float32) {
-	console.APU.channel = channel
+func (console *Console) setButtons(port int, controller *Controller, buttons [8]bool) {
+	if console.movie != nil {
+		if console.movie.recording {
+			console.movie.input[port] = buttons
+		}
+		return
+	}
+	controller.SetButtons(buttons)
 }
 
-func (console *Console) SetAudioSampleRate(sampleRate float64) {
-	if sampleRate != 0 {
-		// Convert samples per second to cpu steps per sample
-		console.APU.sampleRate = CPUFrequency / sampleRate
-		// Initialize filters
-		console.APU.filterChain = FilterChain{
-			HighPassFilter(float32(sampleRate), 90),
-			HighPassFilter(float32(sampleRate), 440),
-			LowPassFilter(float32(sampleRate), 14000),
-		}
-	} else {
-		console.APU.filterChain = nil
+// SetAudioBuffer sets the buffer that receives interleaved stereo audio
+// samples. The output rate is continuously adjusted to keep the buffer half
+// full unless rate control is disabled.
+func (console *Console) SetAudioBuffer(buffer *AudioBuffer) {
+	console.APU.buffer = buffer
+}
+
+// SetAudioRateControl enables or disables dynamic rate control.
+func (console *Console) SetAudioRateControl(enabled bool) {
+	console.APU.rateControl = enabled
+	if !enabled {
+		console.APU.setSampleRate(console.APU.sampleRate)
 	}
 }
+
+// AudioChannels returns the names of the audio channels, including any
+// expansion audio channels provided by the mapper. Channel numbers used by
+// SetChannelVolume, SetChannelPan and SetChannelMute index this list.
+func (console *Console) AudioChannels() []string {
+	return console.APU.mixer.ChannelNames()
+}
+
+// SetChannelVolume sets the volume of a channel, where 1 is the default.
+func (console *Console) SetChannelVolume(channel int, volume float32) {
+	console.APU.mixer.SetVolume(channel, volume)
+}
+
+// SetChannelPan sets the stereo position of a channel, from -1 (left) to 1
+// (right).
+func (console *Console) SetChannelPan(channel int, pan float32) {
+	console.APU.mixer.SetPan(channel, pan)
+}
+
+// SetChannelMute silences a channel without changing its volume.
+func (console *Console) SetChannelMute(channel int, mute bool) {
+	console.APU.mixer.SetMute(channel, mute)
+}
+
+func (console *Console) SetAudioSampleRate(sampleRate float64) {
+	console.APU.setSampleRate(sampleRate)
+}
+
 func (console *Console) SaveState(filename string) error {
 	dir, _ := path.Split(filename)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -128,7 +269,12 @@ func (console *Console) Save(encoder *gob.Encoder) error {
 	console.PPU.Save(encoder)
 	console.Cartridge.Save(encoder)
 	console.Mapper.Save(encoder)
-	return encoder.Encode(true)
+	if err := encoder.Encode(true); err != nil {
+		return err
+	}
+	// controllers follow the end marker so older states still load
+	console.Controller1.Save(encoder)
+	return console.Controller2.Save(encoder)
 }
 
 func (console *Console) LoadState(filename string) error {
@@ -141,7 +287,14 @@ func (console *Console) LoadState(filename string) error {
 	return console.Load(decoder)
 }
 
+// Load restores a state written by Save. It ends any movie being recorded
+// or played.
 func (console *Console) Load(decoder *gob.Decoder) error {
+	console.movie = nil
+	return console.load(decoder)
+}
+
+func (console *Console) load(decoder *gob.Decoder) error {
 	decoder.Decode(&console.RAM)
 	console.CPU.Load(decoder)
 	console.APU.Load(decoder)
@@ -152,5 +305,13 @@ func (console *Console) Load(decoder *gob.Decoder) error {
 	if err := decoder.Decode(&dummy); err != nil {
 		return err
 	}
+	if console.Controller1.Load(decoder) == nil {
+		console.Controller2.Load(decoder)
+	}
+	if console.hooks != nil {
+		for _, h := range console.hooks.load {
+			h.f()
+		}
+	}
 	return nil
 }
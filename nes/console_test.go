@@ -0,0 +1,15 @@
+package nes
+
+import "testing"
+
+// fast-forward runs many frames per displayed frame, so stepping must not
+// allocate
+func TestStepFrameAllocs(t *testing.T) {
+	console := newTestConsole(t, joypadProgram)
+	console.SetAudioSampleRate(44100)
+	console.SetAudioBuffer(NewAudioBuffer(1 << 20))
+	console.StepFrame()
+	if n := testing.AllocsPerRun(20, func() { console.StepFrame() }); n != 0 {
+		t.Errorf("StepFrame made %v allocations", n)
+	}
+}
@@ -1,5 +1,7 @@
 package nes
 
+import "encoding/gob"
+
 const (
 	ButtonA = iota
 	ButtonB
@@ -25,6 +27,24 @@ func (c *Controller) SetButtons(buttons [8]bool) {
 	c.buttons = buttons
 }
 
+// Save writes the shift register state. Buttons are input rather than
+// state and are not saved.
+func (c *Controller) Save(encoder *gob.Encoder) error {
+	encoder.Encode(c.index)
+	return encoder.Encode(c.strobe)
+}
+
+func (c *Controller) Load(decoder *gob.Decoder) error {
+	if err := decoder.Decode(&c.index); err != nil {
+		return err
+	}
+	return decoder.Decode(&c.strobe)
+}
+
+func (c *Controller) Buttons() [8]bool {
+	return c.buttons
+}
+
 func (c *Controller) Read() byte {
 	value := byte(0)
 	if c.index < 8 && c.buttons[c.index] {
@@ -152,28 +152,33 @@ var instructionNames = [256]string{
 }
 
 type CPU struct {
-	Memory           // memory interface
-	Cycles    uint64 // number of cycles
-	PC        uint16 // program counter
-	SP        byte   // stack pointer
-	A         byte   // accumulator
-	X         byte   // x register
-	Y         byte   // y register
-	C         byte   // carry flag
-	Z         byte   // zero flag
-	I         byte   // interrupt disable flag
-	D         byte   // decimal mode flag
-	B         byte   // break command flag
-	U         byte   // unused flag
-	V         byte   // overflow flag
-	N         byte   // negative flag
-	interrupt byte   // interrupt type to perform
-	stall     int    // number of cycles to stall
+	Memory             // memory interface
+	console   *Console // reference to parent object
+	Cycles    uint64   // number of cycles
+	PC        uint16   // program counter
+	SP        byte     // stack pointer
+	A         byte     // accumulator
+	X         byte     // x register
+	Y         byte     // y register
+	C         byte     // carry flag
+	Z         byte     // zero flag
+	I         byte     // interrupt disable flag
+	D         byte     // decimal mode flag
+	B         byte     // break command flag
+	U         byte     // unused flag
+	V         byte     // overflow flag
+	N         byte     // negative flag
+	interrupt byte     // interrupt type to perform
+	stall     int      // number of cycles to stall
+	tracer    *Tracer  // optional execution trace logger
 	table     [256]func(*stepInfo)
+	info      stepInfo // reused by Step so it does not allocate
+	memory    *cpuMemory
 }
 
 func NewCPU(console *Console) *CPU {
-	cpu := CPU{Memory: NewCPUMemory(console)}
+	memory := &cpuMemory{console}
+	cpu := CPU{Memory: memory, memory: memory, console: console}
 	cpu.createTable()
 	cpu.Reset()
 	return &cpu
@@ -264,25 +269,9 @@ func (cpu *CPU) Reset() {
 	cpu.SetFlags(0x24)
 }
 
-// PrintInstruction prints the current CPU state
+// PrintInstruction prints the current CPU state in nestest log format
 func (cpu *CPU) PrintInstruction() {
-	opcode := cpu.Read(cpu.PC)
-	bytes := instructionSizes[opcode]
-	name := instructionNames[opcode]
-	w0 := fmt.Sprintf("%02X", cpu.Read(cpu.PC+0))
-	w1 := fmt.Sprintf("%02X", cpu.Read(cpu.PC+1))
-	w2 := fmt.Sprintf("%02X", cpu.Read(cpu.PC+2))
-	if bytes < 2 {
-		w1 = "  "
-	}
-	if bytes < 3 {
-		w2 = "  "
-	}
-	fmt.Printf(
-		"%4X  %s %s %s  %s %28s"+
-			"A:%02X X:%02X Y:%02X P:%02X SP:%02X CYC:%3d\n",
-		cpu.PC, w0, w1, w2, name, "",
-		cpu.A, cpu.X, cpu.Y, cpu.Flags(), cpu.SP, (cpu.Cycles*3)%341)
+	fmt.Println(NewTracer(cpu.console, nil).Line())
 }
 
 // pagesDiffer returns true if the two addresses reference different pages
@@ -308,6 +297,16 @@ func (cpu *CPU) compare(a, b byte) {
 	}
 }
 
+// Read and Write call the CPU memory map directly rather than through the
+// Memory interface, which is slower on this hot path.
+func (cpu *CPU) Read(address uint16) byte {
+	return cpu.memory.Read(address)
+}
+
+func (cpu *CPU) Write(address uint16, value byte) {
+	cpu.memory.Write(address, value)
+}
+
 // Read16 reads two bytes using Read to return a double-word value
 func (cpu *CPU) Read16(address uint16) uint16 {
 	lo := uint16(cpu.Read(address))
@@ -438,6 +437,15 @@ func (cpu *CPU) Step() int {
 	}
 	cpu.interrupt = interruptNone
 
+	if cpu.tracer != nil {
+		cpu.tracer.trace()
+	}
+	if hooks := cpu.console.hooks; hooks != nil {
+		for _, h := range hooks.execute[cpu.PC] {
+			h.f()
+		}
+	}
+
 	opcode := cpu.Read(cpu.PC)
 	mode := instructionModes[opcode]
 
@@ -480,13 +488,17 @@ func (cpu *CPU) Step() int {
 		address = uint16(cpu.Read(cpu.PC+1)+cpu.Y) & 0xff
 	}
 
+	if cpu.console.cdl != nil {
+		cpu.console.cdl.logInstruction(cpu, opcode, address)
+	}
+
 	cpu.PC += uint16(instructionSizes[opcode])
 	cpu.Cycles += uint64(instructionCycles[opcode])
 	if pageCrossed {
 		cpu.Cycles += uint64(instructionPageCycles[opcode])
 	}
-	info := &stepInfo{address, cpu.PC, mode}
-	cpu.table[opcode](info)
+	cpu.info = stepInfo{address, cpu.PC, mode}
+	cpu.table[opcode](&cpu.info)
 
 	return int(cpu.Cycles - cycles)
 }
@@ -496,6 +508,10 @@ func (cpu *CPU) nmi() {
 	cpu.push16(cpu.PC)
 	cpu.php(nil)
 	cpu.PC = cpu.Read16(0xFFFA)
+	if cpu.console.cdl != nil {
+		cpu.console.cdl.logPRG(0xFFFA, CDLData)
+		cpu.console.cdl.logPRG(0xFFFB, CDLData)
+	}
 	cpu.I = 1
 	cpu.Cycles += 7
 }
@@ -505,6 +521,10 @@ func (cpu *CPU) irq() {
 	cpu.push16(cpu.PC)
 	cpu.php(nil)
 	cpu.PC = cpu.Read16(0xFFFE)
+	if cpu.console.cdl != nil {
+		cpu.console.cdl.logPRG(0xFFFE, CDLData)
+		cpu.console.cdl.logPRG(0xFFFF, CDLData)
+	}
 	cpu.I = 1
 	cpu.Cycles += 7
 }
@@ -0,0 +1,459 @@
+package nes
+
+import "fmt"
+
+// breakpoint kinds
+const (
+	BreakExecute = 1 << iota
+	BreakRead
+	BreakWrite
+	BreakNMI
+	BreakIRQ
+)
+
+var breakKindNames = map[int]string{
+	BreakExecute: "execute",
+	BreakRead:    "read",
+	BreakWrite:   "write",
+	BreakNMI:     "nmi",
+	BreakIRQ:     "irq",
+
+	BreakRead | BreakWrite: "access",
+}
+
+// BreakKindName returns the name of a breakpoint kind, e.g. "write".
+func BreakKindName(kind int) string {
+	return breakKindNames[kind]
+}
+
+// ParseBreakKind returns the breakpoint kind with the given name.
+func ParseBreakKind(name string) (int, error) {
+	for kind, n := range breakKindNames {
+		if n == name {
+			return kind, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown breakpoint kind: %s", name)
+}
+
+// Breakpoint pauses the console when the CPU executes, reads or writes an
+// address in Start-End, or when an NMI or IRQ is taken, provided the
+// condition, if any, is true.
+type Breakpoint struct {
+	ID        int
+	Kind      int
+	Start     uint16
+	End       uint16
+	Condition string
+	Enabled   bool
+	Hits      int
+	condition *Expression
+}
+
+func (b *Breakpoint) String() string {
+	s := fmt.Sprintf("#%d %s", b.ID, BreakKindName(b.Kind))
+	if b.Kind&(BreakNMI|BreakIRQ) == 0 {
+		s += fmt.Sprintf(" $%04X", b.Start)
+		if b.End != b.Start {
+			s += fmt.Sprintf("-$%04X", b.End)
+		}
+	}
+	if b.Condition != "" {
+		s += " if " + b.Condition
+	}
+	if !b.Enabled {
+		s += " (disabled)"
+	}
+	return s
+}
+
+func (b *Breakpoint) match(console *Console, address uint16, value byte) bool {
+	if !b.Enabled || address < b.Start || address > b.End {
+		return false
+	}
+	if b.condition != nil && b.condition.Eval(console, address, value) == 0 {
+		return false
+	}
+	b.Hits++
+	return true
+}
+
+// stepping modes
+const (
+	stepNone = iota
+	stepInto
+	stepOver
+	stepOut
+	stepScanline
+	stepFrame
+)
+
+// Registers is a snapshot of the CPU registers and PPU position.
+type Registers struct {
+	PC       uint16
+	A        byte
+	X        byte
+	Y        byte
+	SP       byte
+	P        byte
+	Cycles   uint64
+	Scanline int
+	Cycle    int
+	Frame    uint64
+}
+
+// Debugger controls execution of a console. While paused, Console.Step
+// does nothing and returns 0, and StepFrame and StepSeconds return early.
+type Debugger struct {
+	console     *Console
+	breakpoints []*Breakpoint
+	nextID      int
+	paused      bool
+	reason      string
+	resume      bool // ignore execute and interrupt breakpoints once
+	step        int
+	stepPC      uint16
+	stepSP      byte
+	stepCount   uint64 // scanline or frame the step started on
+	fetchPC     uint16 // instruction being executed; its bytes are not reads
+	fetchSize   uint16
+	opcode      byte
+	hit         *Breakpoint // access breakpoint hit by the current instruction
+	hitAddress  uint16      // address whose access hit it
+	last        *Breakpoint // breakpoint that caused the last pause
+	lastAddress uint16      // address accessed, if last is an access breakpoint
+	listeners   []*breakListener
+}
+
+// Debugger returns the console's debugger, attaching one on first use.
+func (console *Console) Debugger() *Debugger {
+	if console.debugger == nil {
+		console.debugger = &Debugger{console: console, nextID: 1}
+	}
+	return console.debugger
+}
+
+// AddBreakpoint adds a breakpoint of the given kind covering start-end.
+// start and end are ignored for interrupt breakpoints.
+func (d *Debugger) AddBreakpoint(kind int, start, end uint16, condition string) (*Breakpoint, error) {
+	if _, ok := breakKindNames[kind]; !ok {
+		return nil, fmt.Errorf("invalid breakpoint kind: %d", kind)
+	}
+	if kind&(BreakNMI|BreakIRQ) != 0 {
+		start, end = 0, 0xFFFF
+	}
+	if end < start {
+		start, end = end, start
+	}
+	b := Breakpoint{
+		ID: d.nextID, Kind: kind, Start: start, End: end,
+		Condition: condition, Enabled: true}
+	if condition != "" {
+		expression, err := ParseExpression(condition)
+		if err != nil {
+			return nil, err
+		}
+		b.condition = expression
+	}
+	d.nextID++
+	d.breakpoints = append(d.breakpoints, &b)
+	return &b, nil
+}
+
+func (d *Debugger) RemoveBreakpoint(id int) bool {
+	for i, b := range d.breakpoints {
+		if b.ID == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Debugger) EnableBreakpoint(id int, enabled bool) bool {
+	for _, b := range d.breakpoints {
+		if b.ID == id {
+			b.Enabled = enabled
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	return append([]*Breakpoint(nil), d.breakpoints...)
+}
+
+func (d *Debugger) Paused() bool {
+	return d.paused
+}
+
+// Reason describes why execution last paused.
+func (d *Debugger) Reason() string {
+	return d.reason
+}
+
+func (d *Debugger) Pause() {
+	d.last = nil
+	d.pause("pause")
+}
+
+func (d *Debugger) Continue() {
+	d.run(stepNone)
+}
+
+// StepInto executes one instruction.
+func (d *Debugger) StepInto() {
+	d.run(stepInto)
+}
+
+// StepOver executes one instruction, running subroutine calls to completion.
+func (d *Debugger) StepOver() {
+	inst := Disassemble(d.console.Peek, d.console.CPU.PC)
+	if inst.Opcode() != 0x20 {
+		d.run(stepInto)
+		return
+	}
+	d.stepPC = inst.Address + 3
+	d.run(stepOver)
+}
+
+// StepOut runs until the current subroutine or interrupt handler returns.
+func (d *Debugger) StepOut() {
+	d.run(stepOut)
+}
+
+// StepScanline runs until the PPU starts the next scanline.
+func (d *Debugger) StepScanline() {
+	d.stepCount = uint64(d.console.PPU.ScanLine)
+	d.run(stepScanline)
+}
+
+// StepFrame runs until the PPU starts the next frame.
+func (d *Debugger) StepFrame() {
+	d.stepCount = d.console.PPU.Frame
+	d.run(stepFrame)
+}
+
+func (d *Debugger) run(step int) {
+	d.step = step
+	d.stepSP = d.console.CPU.SP
+	d.resume = true
+	d.paused = false
+}
+
+func (d *Debugger) pause(reason string) {
+	d.paused = true
+	d.reason = reason
+	d.step = stepNone
+	for _, l := range d.listeners {
+		l.f(reason)
+	}
+}
+
+type breakListener struct {
+	f func(reason string)
+}
+
+// OnBreak registers a function to be called whenever execution pauses. It
+// is called from the emulation loop and must not block. Calling the returned
+// function removes it again.
+func (d *Debugger) OnBreak(f func(reason string)) (remove func()) {
+	x := &breakListener{f}
+	d.listeners = append(d.listeners, x)
+	return func() {
+		for i, y := range d.listeners {
+			if y == x {
+				d.listeners = append(d.listeners[:i:i], d.listeners[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Breakpoint returns the breakpoint that caused the last pause, or nil if
+// execution paused for another reason.
+func (d *Debugger) Breakpoint() *Breakpoint {
+	return d.last
+}
+
+// BreakAddress returns the address whose read or write caused the last
+// pause when Breakpoint is a read, write or access breakpoint.
+func (d *Debugger) BreakAddress() uint16 {
+	return d.lastAddress
+}
+
+func (d *Debugger) Registers() Registers {
+	cpu := d.console.CPU
+	ppu := d.console.PPU
+	return Registers{
+		cpu.PC, cpu.A, cpu.X, cpu.Y, cpu.SP, cpu.Flags(),
+		cpu.Cycles, ppu.ScanLine, ppu.Cycle, ppu.Frame}
+}
+
+// SetRegister sets a CPU register (A, X, Y, SP, P or PC) or flag (C, Z, I,
+// D, V or N).
+func (d *Debugger) SetRegister(name string, value int) error {
+	cpu := d.console.CPU
+	flag := byte(value) & 1
+	switch name {
+	case "A", "a":
+		cpu.A = byte(value)
+	case "X", "x":
+		cpu.X = byte(value)
+	case "Y", "y":
+		cpu.Y = byte(value)
+	case "SP", "sp":
+		cpu.SP = byte(value)
+	case "P", "p":
+		cpu.SetFlags(byte(value))
+	case "PC", "pc":
+		cpu.PC = uint16(value)
+	case "C", "c":
+		cpu.C = flag
+	case "Z", "z":
+		cpu.Z = flag
+	case "I", "i":
+		cpu.I = flag
+	case "D", "d":
+		cpu.D = flag
+	case "V", "v":
+		cpu.V = flag
+	case "N", "n":
+		cpu.N = flag
+	default:
+		return fmt.Errorf("unknown register: %s", name)
+	}
+	return nil
+}
+
+// ReadMemory returns n bytes starting at address without side effects. n is
+// limited to 0-$10000, the size of the address space.
+func (d *Debugger) ReadMemory(address uint16, n int) []byte {
+	data := make([]byte, clampLength(n))
+	for i := range data {
+		data[i] = d.console.Peek(address + uint16(i))
+	}
+	return data
+}
+
+// WriteMemory stores data starting at address. Writes go through the CPU
+// memory map without triggering breakpoints, so writes to PPU, APU and
+// mapper registers take effect as usual.
+func (d *Debugger) WriteMemory(address uint16, data []byte) {
+	for i, value := range data {
+		d.console.Poke(address+uint16(i), value)
+	}
+}
+
+// before is called ahead of each CPU step and reports whether execution
+// should stop.
+func (d *Debugger) before() bool {
+	if d.paused {
+		return true
+	}
+	d.last = nil
+	cpu := d.console.CPU
+	if cpu.stall > 0 {
+		d.fetchSize = 0
+		return false
+	}
+	resume := d.resume
+	d.resume = false
+	if len(d.breakpoints) == 0 && d.step == stepNone {
+		d.fetchSize = 0 // nothing to check, so skip disassembling
+		return false
+	}
+	pc := cpu.PC
+	kind := 0
+	switch cpu.interrupt {
+	case interruptNMI:
+		kind = BreakNMI
+		pc = d.peek16(0xFFFA)
+	case interruptIRQ:
+		kind = BreakIRQ
+		pc = d.peek16(0xFFFE)
+	}
+	inst := Disassemble(d.console.Peek, pc)
+	d.fetchPC = pc
+	d.fetchSize = uint16(inst.Size)
+	d.opcode = inst.Opcode()
+	if resume {
+		return false
+	}
+	if d.step == stepOver && pc == d.stepPC && cpu.SP >= d.stepSP {
+		d.pause("step")
+		return true
+	}
+	for _, b := range d.breakpoints {
+		if (b.Kind == kind || b.Kind == BreakExecute) && b.match(d.console, pc, 0) {
+			d.last = b
+			d.pause(b.String())
+			return true
+		}
+	}
+	return false
+}
+
+// after is called when a CPU step completes
+func (d *Debugger) after() {
+	if d.fetchSize == 0 {
+		return
+	}
+	if d.hit != nil {
+		d.last = d.hit
+		d.lastAddress = d.hitAddress
+		d.hit = nil
+		d.pause(d.last.String())
+		return
+	}
+	ppu := d.console.PPU
+	cpu := d.console.CPU
+	switch d.step {
+	case stepInto:
+		d.pause("step")
+	case stepOut:
+		if (d.opcode == 0x60 || d.opcode == 0x40) && cpu.SP > d.stepSP {
+			d.pause("step")
+		}
+	case stepScanline:
+		if uint64(ppu.ScanLine) != d.stepCount {
+			d.pause("step")
+		}
+	case stepFrame:
+		if ppu.Frame != d.stepCount {
+			d.pause("step")
+		}
+	}
+}
+
+// access is called for each CPU memory read and write
+func (d *Debugger) access(kind int, address uint16, value byte) {
+	if d.hit != nil {
+		return
+	}
+	if kind == BreakRead && address-d.fetchPC < d.fetchSize {
+		return
+	}
+	for _, b := range d.breakpoints {
+		if b.Kind&kind != 0 && b.match(d.console, address, value) {
+			d.hit = b
+			d.hitAddress = address
+			return
+		}
+	}
+}
+
+func clampLength(n int) int {
+	switch {
+	case n < 0:
+		return 0
+	case n > 0x10000:
+		return 0x10000
+	}
+	return n
+}
+
+func (d *Debugger) peek16(address uint16) uint16 {
+	return uint16(d.console.Peek(address+1))<<8 | uint16(d.console.Peek(address))
+}
@@ -0,0 +1,107 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/fogleman/nes/internal/testrom"
+)
+
+// newTestConsole returns a console running program from $8000 on an NROM
+// cartridge.
+func newTestConsole(t testing.TB, program []byte) *Console {
+	console, err := NewConsoleFromBytes(testrom.NROM(program))
+	if err != nil {
+		t.Fatal(err)
+	}
+	console.Reset()
+	return console
+}
+
+var debuggerProgram = []byte{
+	0xA2, 0x00, // 8000 LDX #$00
+	0x20, 0x10, 0x80, // 8002 JSR $8010
+	0xE8,             // 8005 INX
+	0x8E, 0x00, 0x03, // 8006 STX $0300
+	0x4C, 0x02, 0x80, // 8009 JMP $8002
+	0, 0, 0, 0,
+	0xA9, 0x10, // 8010 LDA #$10
+	0x85, 0x10, // 8012 STA $10
+	0x60, // 8014 RTS
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	console := newTestConsole(t, debuggerProgram)
+	d := console.Debugger()
+	if _, err := d.AddBreakpoint(BreakExecute, 0x8010, 0x8010, "X==2"); err != nil {
+		t.Fatal(err)
+	}
+	console.StepFrame()
+	if !d.Paused() || console.CPU.PC != 0x8010 || console.CPU.X != 2 {
+		t.Fatalf("execute breakpoint: paused %v at $%04X with X=%d",
+			d.Paused(), console.CPU.PC, console.CPU.X)
+	}
+	if console.Step() != 0 {
+		t.Fatal("Step ran while paused")
+	}
+
+	d.StepOut()
+	console.StepFrame()
+	if console.CPU.PC != 0x8005 {
+		t.Errorf("step out stopped at $%04X, want $8005", console.CPU.PC)
+	}
+
+	d.RemoveBreakpoint(1)
+	d.AddBreakpoint(BreakWrite, 0x0300, 0x0300, "VALUE==$05")
+	d.Continue()
+	console.StepFrame()
+	if console.CPU.PC != 0x8009 || console.RAM[0x300] != 5 {
+		t.Errorf("write breakpoint: stopped at $%04X with $0300=%d",
+			console.CPU.PC, console.RAM[0x300])
+	}
+
+	d.SetRegister("PC", 0x8002)
+	d.StepOver()
+	console.StepFrame()
+	if console.CPU.PC != 0x8005 || console.CPU.A != 0x10 {
+		t.Errorf("step over stopped at $%04X with A=$%02X", console.CPU.PC, console.CPU.A)
+	}
+}
+
+func TestReadMemory(t *testing.T) {
+	d := newTestConsole(t, debuggerProgram).Debugger()
+	if data := d.ReadMemory(0x8000, 2); len(data) != 2 || data[0] != 0xA2 {
+		t.Errorf("got % X", data)
+	}
+	if data := d.ReadMemory(0, -1); len(data) != 0 {
+		t.Errorf("negative length: got %d bytes", len(data))
+	}
+	if data := d.ReadMemory(0, 1<<30); len(data) != 0x10000 {
+		t.Errorf("huge length: got %d bytes", len(data))
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	console := newTestConsole(t, debuggerProgram)
+	console.CPU.A = 0x10
+	console.RAM[0x300] = 7
+	tests := map[string]int{
+		"A==$10":               1,
+		"a == 16 && [$0300]>6": 1,
+		"[$300]+1":             8,
+		"!(A&$10) || X!=0":     0,
+		"VALUE-2":              3,
+	}
+	for text, want := range tests {
+		e, err := ParseExpression(text)
+		if err != nil {
+			t.Errorf("%q: %v", text, err)
+			continue
+		}
+		if got := e.Eval(console, 0, 5); got != want {
+			t.Errorf("%q = %d, want %d", text, got, want)
+		}
+	}
+	if _, err := ParseExpression("A=="); err == nil {
+		t.Error("expected error for incomplete expression")
+	}
+}
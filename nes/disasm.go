@@ -0,0 +1,169 @@
+package nes
+
+import "fmt"
+
+var unofficialNames = map[string]bool{
+	"AHX": true, "ALR": true, "ANC": true, "ARR": true, "AXS": true,
+	"DCP": true, "ISC": true, "KIL": true, "LAS": true, "LAX": true,
+	"RLA": true, "RRA": true, "SAX": true, "SHX": true, "SHY": true,
+	"SLO": true, "SRE": true, "TAS": true, "XAA": true,
+}
+
+// Instruction is a decoded 6502 instruction.
+type Instruction struct {
+	Address uint16  // address of the opcode
+	Bytes   [3]byte // opcode and operand bytes
+	Size    int     // number of valid bytes
+	Name    string  // mnemonic
+	Mode    byte    // addressing mode
+}
+
+// Disassemble decodes the instruction at address, using read to fetch the
+// instruction bytes. Sizes are those the CPU uses to advance PC.
+func Disassemble(read func(address uint16) byte, address uint16) Instruction {
+	opcode := read(address)
+	inst := Instruction{
+		Address: address,
+		Size:    int(instructionSizes[opcode]),
+		Name:    instructionNames[opcode],
+		Mode:    instructionModes[opcode],
+	}
+	// opcodes the CPU doesn't implement have no size; show them as one byte
+	if inst.Size == 0 {
+		inst.Size = 1
+	}
+	for i := 0; i < inst.Size; i++ {
+		inst.Bytes[i] = read(address + uint16(i))
+	}
+	return inst
+}
+
+func (inst Instruction) Opcode() byte {
+	return inst.Bytes[0]
+}
+
+// Operand returns the operand as a byte or little-endian word.
+func (inst Instruction) Operand() uint16 {
+	switch inst.Size {
+	case 2:
+		return uint16(inst.Bytes[1])
+	case 3:
+		return uint16(inst.Bytes[2])<<8 | uint16(inst.Bytes[1])
+	}
+	return 0
+}
+
+// Official reports whether the opcode is a documented 6502 instruction.
+func (inst Instruction) Official() bool {
+	opcode := inst.Opcode()
+	if inst.Name == "NOP" {
+		return opcode == 0xEA
+	}
+	return opcode != 0xEB && !unofficialNames[inst.Name]
+}
+
+// Target returns the destination of a relative branch.
+func (inst Instruction) Target() uint16 {
+	offset := uint16(inst.Bytes[1])
+	if offset < 0x80 {
+		return inst.Address + 2 + offset
+	}
+	return inst.Address + 2 + offset - 0x100
+}
+
+// Operands formats the operand in standard assembler syntax.
+func (inst Instruction) Operands() string {
+	operand := inst.Operand()
+	switch inst.Mode {
+	case modeAbsolute:
+		return fmt.Sprintf("$%04X", operand)
+	case modeAbsoluteX:
+		return fmt.Sprintf("$%04X,X", operand)
+	case modeAbsoluteY:
+		return fmt.Sprintf("$%04X,Y", operand)
+	case modeAccumulator:
+		return "A"
+	case modeImmediate:
+		return fmt.Sprintf("#$%02X", operand)
+	case modeIndexedIndirect:
+		return fmt.Sprintf("($%02X,X)", operand)
+	case modeIndirect:
+		return fmt.Sprintf("($%04X)", operand)
+	case modeIndirectIndexed:
+		return fmt.Sprintf("($%02X),Y", operand)
+	case modeRelative:
+		return fmt.Sprintf("$%04X", inst.Target())
+	case modeZeroPage:
+		return fmt.Sprintf("$%02X", operand)
+	case modeZeroPageX:
+		return fmt.Sprintf("$%02X,X", operand)
+	case modeZeroPageY:
+		return fmt.Sprintf("$%02X,Y", operand)
+	}
+	return ""
+}
+
+// String returns the instruction in assembler syntax, e.g. "LDA $0200,X".
+func (inst Instruction) String() string {
+	if operands := inst.Operands(); operands != "" {
+		return inst.Name + " " + operands
+	}
+	return inst.Name
+}
+
+// HexBytes returns the instruction bytes as space separated hex values.
+func (inst Instruction) HexBytes() string {
+	switch inst.Size {
+	case 1:
+		return fmt.Sprintf("%02X", inst.Bytes[0])
+	case 2:
+		return fmt.Sprintf("%02X %02X", inst.Bytes[0], inst.Bytes[1])
+	}
+	return fmt.Sprintf("%02X %02X %02X", inst.Bytes[0], inst.Bytes[1], inst.Bytes[2])
+}
+
+// Annotated returns the instruction with its effective address and the
+// value found there, in the style of the nestest log, for example
+// "LDA ($80),Y = 0200 @ 0205 = 5A". The CPU registers determine the
+// effective address; memory is read with peek so no side effects occur.
+func (inst Instruction) Annotated(cpu *CPU, peek func(address uint16) byte) string {
+	s := inst.String()
+	operand := inst.Operand()
+	peek16bug := func(address uint16) uint16 {
+		hi := (address & 0xFF00) | uint16(byte(address)+1)
+		return uint16(peek(hi))<<8 | uint16(peek(address))
+	}
+	opcode := inst.Opcode()
+	jump := opcode == 0x4C || opcode == 0x20
+	switch inst.Mode {
+	case modeAbsolute:
+		if !jump {
+			s += fmt.Sprintf(" = %02X", peek(operand))
+		}
+	case modeAbsoluteX:
+		address := operand + uint16(cpu.X)
+		s += fmt.Sprintf(" @ %04X = %02X", address, peek(address))
+	case modeAbsoluteY:
+		address := operand + uint16(cpu.Y)
+		s += fmt.Sprintf(" @ %04X = %02X", address, peek(address))
+	case modeIndexedIndirect:
+		pointer := byte(operand) + cpu.X
+		address := peek16bug(uint16(pointer))
+		s += fmt.Sprintf(" @ %02X = %04X = %02X", pointer, address, peek(address))
+	case modeIndirect:
+		s += fmt.Sprintf(" = %04X", peek16bug(operand))
+	case modeIndirectIndexed:
+		base := peek16bug(operand)
+		address := base + uint16(cpu.Y)
+		s += fmt.Sprintf(" = %04X @ %04X = %02X", base, address, peek(address))
+	case modeZeroPage:
+		s += fmt.Sprintf(" = %02X", peek(operand))
+	case modeZeroPageX:
+		address := uint16(byte(operand) + cpu.X)
+		s += fmt.Sprintf(" @ %02X = %02X", address, peek(address))
+	case modeZeroPageY:
+		address := uint16(byte(operand) + cpu.Y)
+		s += fmt.Sprintf(" @ %02X = %02X", address, peek(address))
+	}
+	return s
+}
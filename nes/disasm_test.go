@@ -0,0 +1,76 @@
+package nes
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	tests := []struct {
+		bytes    []byte
+		size     int
+		text     string
+		hex      string
+		official bool
+	}{
+		{[]byte{0xEA}, 1, "NOP", "EA", true},
+		{[]byte{0x0A}, 1, "ASL A", "0A", true},
+		{[]byte{0xA9, 0x10}, 2, "LDA #$10", "A9 10", true},
+		{[]byte{0xA5, 0x80}, 2, "LDA $80", "A5 80", true},
+		{[]byte{0xB5, 0x80}, 2, "LDA $80,X", "B5 80", true},
+		{[]byte{0xB6, 0x80}, 2, "LDX $80,Y", "B6 80", true},
+		{[]byte{0xA1, 0x80}, 2, "LDA ($80,X)", "A1 80", true},
+		{[]byte{0xB1, 0x80}, 2, "LDA ($80),Y", "B1 80", true},
+		{[]byte{0xAD, 0x00, 0x02}, 3, "LDA $0200", "AD 00 02", true},
+		{[]byte{0xBD, 0x00, 0x02}, 3, "LDA $0200,X", "BD 00 02", true},
+		{[]byte{0xB9, 0x00, 0x02}, 3, "LDA $0200,Y", "B9 00 02", true},
+		{[]byte{0x6C, 0xFF, 0x02}, 3, "JMP ($02FF)", "6C FF 02", true},
+		{[]byte{0xD0, 0xFC}, 2, "BNE $7FFE", "D0 FC", true},
+		{[]byte{0x10, 0x05}, 2, "BPL $8007", "10 05", true},
+		{[]byte{0x04, 0x80}, 2, "NOP $80", "04 80", false},
+		{[]byte{0x02}, 1, "KIL", "02", false}, // not implemented by the CPU
+	}
+	for _, test := range tests {
+		read := func(address uint16) byte {
+			if i := int(address) - 0x8000; i >= 0 && i < len(test.bytes) {
+				return test.bytes[i]
+			}
+			return 0xFF
+		}
+		inst := Disassemble(read, 0x8000)
+		if inst.Size != test.size || inst.String() != test.text ||
+			inst.HexBytes() != test.hex || inst.Official() != test.official {
+			t.Errorf("% X: got size %d, %q, %q, official %v", test.bytes,
+				inst.Size, inst.String(), inst.HexBytes(), inst.Official())
+		}
+		if inst.Size != int(instructionSizes[test.bytes[0]]) && instructionSizes[test.bytes[0]] != 0 {
+			t.Errorf("% X: size differs from the CPU's", test.bytes)
+		}
+	}
+}
+
+func TestTracerLine(t *testing.T) {
+	console := newTestConsole(t, debuggerProgram)
+	tracer := NewTracer(console, nil)
+	want := []string{
+		"8000  A2 00     LDX #$00                        A:00 X:00 Y:00 P:24 SP:FD PPU:240,340 CYC:0",
+		"8002  20 10 80  JSR $8010                       A:00 X:00 Y:00 P:26 SP:FD PPU:241,  5 CYC:2",
+		"8010  A9 10     LDA #$10                        A:00 X:00 Y:00 P:26 SP:FB PPU:241, 23 CYC:8",
+		"8012  85 10     STA $10 = 00                    A:10 X:00 Y:00 P:24 SP:FB PPU:241, 29 CYC:10",
+	}
+	for i, w := range want {
+		if got := tracer.Line(); got != w {
+			t.Errorf("line %d:\ngot  %q\nwant %q", i, got, w)
+		}
+		// registers start in the same column as in nestest.log
+		if got := strings.Index(tracer.Line(), "A:"); got != 48 {
+			t.Errorf("line %d: registers at column %d", i, got)
+		}
+		console.Step()
+	}
+	tracer.SetFormat(TraceFCEUX)
+	w := "$8014:60        RTS                              A:10 X:00 Y:00 S:FB P:nvUbdIzc"
+	if got := tracer.Line(); got != w {
+		t.Errorf("fceux:\ngot  %q\nwant %q", got, w)
+	}
+}
@@ -0,0 +1,260 @@
+package nes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expression is a compiled debugger condition such as "A==$10 && [$0300]>2".
+//
+// Operands are numbers ($hex, 0xhex or decimal), the names A, X, Y, SP, P,
+// PC, the flags C, Z, I, D, V, N, SCANLINE, CYCLE (PPU dot), FRAME, CYCLES
+// (CPU cycles), and ADDR and VALUE for the memory access that triggered a
+// breakpoint. [expr] reads a byte from memory. Operators, from lowest to
+// highest precedence, are || && == != < <= > >= | ^ & + - and unary ! - ~.
+// Non-zero values are true.
+type Expression struct {
+	text string
+	eval exprFunc
+}
+
+// exprEnv is the state an expression is evaluated against
+type exprEnv struct {
+	console *Console
+	address uint16
+	value   byte
+}
+
+type exprFunc func(env *exprEnv) int
+
+func ParseExpression(text string) (*Expression, error) {
+	p := exprParser{text: text}
+	p.next()
+	eval, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.token != "" {
+		return nil, fmt.Errorf("expression %q: unexpected %q", text, p.token)
+	}
+	return &Expression{text, eval}, nil
+}
+
+func (e *Expression) String() string {
+	return e.text
+}
+
+// Eval evaluates the expression. address and value describe the memory
+// access being checked, if any.
+func (e *Expression) Eval(console *Console, address uint16, value byte) int {
+	return e.eval(&exprEnv{console, address, value})
+}
+
+var exprNames = map[string]exprFunc{
+	"A":        func(env *exprEnv) int { return int(env.console.CPU.A) },
+	"X":        func(env *exprEnv) int { return int(env.console.CPU.X) },
+	"Y":        func(env *exprEnv) int { return int(env.console.CPU.Y) },
+	"SP":       func(env *exprEnv) int { return int(env.console.CPU.SP) },
+	"P":        func(env *exprEnv) int { return int(env.console.CPU.Flags()) },
+	"PC":       func(env *exprEnv) int { return int(env.console.CPU.PC) },
+	"C":        func(env *exprEnv) int { return int(env.console.CPU.C) },
+	"Z":        func(env *exprEnv) int { return int(env.console.CPU.Z) },
+	"I":        func(env *exprEnv) int { return int(env.console.CPU.I) },
+	"D":        func(env *exprEnv) int { return int(env.console.CPU.D) },
+	"V":        func(env *exprEnv) int { return int(env.console.CPU.V) },
+	"N":        func(env *exprEnv) int { return int(env.console.CPU.N) },
+	"SCANLINE": func(env *exprEnv) int { return env.console.PPU.ScanLine },
+	"CYCLE":    func(env *exprEnv) int { return env.console.PPU.Cycle },
+	"FRAME":    func(env *exprEnv) int { return int(env.console.PPU.Frame) },
+	"CYCLES":   func(env *exprEnv) int { return int(env.console.CPU.Cycles) },
+	"ADDR":     func(env *exprEnv) int { return int(env.address) },
+	"VALUE":    func(env *exprEnv) int { return int(env.value) },
+}
+
+// binary operators by precedence level
+var exprOperators = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"+", "-"},
+}
+
+func exprBool(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func exprBinary(op string, a, b exprFunc) exprFunc {
+	switch op {
+	case "||":
+		return func(env *exprEnv) int { return exprBool(a(env) != 0 || b(env) != 0) }
+	case "&&":
+		return func(env *exprEnv) int { return exprBool(a(env) != 0 && b(env) != 0) }
+	case "==":
+		return func(env *exprEnv) int { return exprBool(a(env) == b(env)) }
+	case "!=":
+		return func(env *exprEnv) int { return exprBool(a(env) != b(env)) }
+	case "<":
+		return func(env *exprEnv) int { return exprBool(a(env) < b(env)) }
+	case "<=":
+		return func(env *exprEnv) int { return exprBool(a(env) <= b(env)) }
+	case ">":
+		return func(env *exprEnv) int { return exprBool(a(env) > b(env)) }
+	case ">=":
+		return func(env *exprEnv) int { return exprBool(a(env) >= b(env)) }
+	case "|":
+		return func(env *exprEnv) int { return a(env) | b(env) }
+	case "^":
+		return func(env *exprEnv) int { return a(env) ^ b(env) }
+	case "&":
+		return func(env *exprEnv) int { return a(env) & b(env) }
+	case "+":
+		return func(env *exprEnv) int { return a(env) + b(env) }
+	case "-":
+		return func(env *exprEnv) int { return a(env) - b(env) }
+	}
+	panic("unknown operator " + op)
+}
+
+type exprParser struct {
+	text  string
+	pos   int
+	token string
+}
+
+// next advances to the next token, leaving "" at the end of input
+func (p *exprParser) next() {
+	for p.pos < len(p.text) && p.text[p.pos] == ' ' {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.text) {
+		p.token = ""
+		return
+	}
+	c := p.text[p.pos]
+	switch {
+	case c == '$' || isAlnum(c):
+		p.pos++
+		for p.pos < len(p.text) && isAlnum(p.text[p.pos]) {
+			p.pos++
+		}
+	case strings.HasPrefix(p.text[p.pos:], "||"),
+		strings.HasPrefix(p.text[p.pos:], "&&"),
+		strings.HasPrefix(p.text[p.pos:], "=="),
+		strings.HasPrefix(p.text[p.pos:], "!="),
+		strings.HasPrefix(p.text[p.pos:], "<="),
+		strings.HasPrefix(p.text[p.pos:], ">="):
+		p.pos += 2
+	default:
+		p.pos++
+	}
+	p.token = p.text[start:p.pos]
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+func (p *exprParser) parseBinary(level int) (exprFunc, error) {
+	if level == len(exprOperators) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, o := range exprOperators[level] {
+			if p.token == o {
+				op = o
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = exprBinary(op, left, right)
+	}
+}
+
+func (p *exprParser) parseUnary() (exprFunc, error) {
+	switch p.token {
+	case "!", "-", "~":
+		op := p.token
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "!":
+			return func(env *exprEnv) int { return exprBool(operand(env) == 0) }, nil
+		case "-":
+			return func(env *exprEnv) int { return -operand(env) }, nil
+		}
+		return func(env *exprEnv) int { return ^operand(env) }, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprFunc, error) {
+	token := p.token
+	switch token {
+	case "":
+		return nil, fmt.Errorf("expression %q: unexpected end", p.text)
+	case "(", "[":
+		p.next()
+		inner, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		closing := map[string]string{"(": ")", "[": "]"}[token]
+		if p.token != closing {
+			return nil, fmt.Errorf("expression %q: missing %q", p.text, closing)
+		}
+		p.next()
+		if token == "(" {
+			return inner, nil
+		}
+		return func(env *exprEnv) int {
+			return int(env.console.Peek(uint16(inner(env))))
+		}, nil
+	}
+	p.next()
+	if f, ok := exprNames[strings.ToUpper(token)]; ok {
+		return f, nil
+	}
+	n, err := ParseNumber(token)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: unexpected %q", p.text, token)
+	}
+	return func(env *exprEnv) int { return n }, nil
+}
+
+// ParseNumber parses a number written as $hex, 0xhex or decimal.
+func ParseNumber(s string) (int, error) {
+	var n int64
+	var err error
+	switch {
+	case strings.HasPrefix(s, "$"):
+		n, err = strconv.ParseInt(s[1:], 16, 64)
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		n, err = strconv.ParseInt(s[2:], 16, 64)
+	default:
+		n, err = strconv.ParseInt(s, 10, 64)
+	}
+	return int(n), err
+}
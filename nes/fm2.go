@@ -0,0 +1,153 @@
+package nes
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// fm2Buttons is the order of buttons in an FM2 input field; character i is
+// button 7-i
+const fm2Buttons = "RLDUTSBA"
+
+// ReadFM2 reads a movie in the FCEUX FM2 text format. The file must start
+// with "version 3" and hold at least one frame. Only movies with gamepads in
+// ports 0 and 1 that start at power-on are supported.
+func ReadFM2(r io.Reader) (*Movie, error) {
+	m := Movie{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if line == 1 {
+			if text != "version 3" {
+				return nil, errors.New("fm2: not an FM2 version 3 movie")
+			}
+			continue
+		}
+		if text == "" {
+			continue
+		}
+		if text[0] == '|' {
+			f, err := parseFM2Frame(text)
+			if err != nil {
+				return nil, fmt.Errorf("fm2 line %d: %v", line, err)
+			}
+			m.Frames = append(m.Frames, f)
+			continue
+		}
+		fields := strings.SplitN(text, " ", 2)
+		key, value := fields[0], ""
+		if len(fields) == 2 {
+			value = fields[1]
+		}
+		switch key {
+		case "rerecordCount":
+			m.Rerecords, _ = strconv.Atoi(value)
+		case "romChecksum":
+			if strings.HasPrefix(value, "base64:") {
+				hash, err := base64.StdEncoding.DecodeString(value[7:])
+				if err == nil {
+					m.ROMHash = hex.EncodeToString(hash)
+				}
+			}
+		case "comment":
+			m.Comments = append(m.Comments, value)
+		case "savestate":
+			return nil, errors.New("fm2: movies starting from a savestate are not supported")
+		case "fourscore":
+			if value != "0" {
+				return nil, errors.New("fm2: four score is not supported")
+			}
+		case "port0", "port1":
+			if value != "0" && value != "1" {
+				return nil, fmt.Errorf("fm2: unsupported %s device %s", key, value)
+			}
+		case "binary":
+			if value != "0" {
+				return nil, errors.New("fm2: binary input is not supported")
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(m.Frames) == 0 {
+		return nil, errors.New("fm2: movie has no frames")
+	}
+	return &m, nil
+}
+
+// parseFM2Frame parses an input line such as |0|R......A|........||
+func parseFM2Frame(text string) (MovieFrame, error) {
+	var f MovieFrame
+	fields := strings.Split(text, "|")
+	if len(fields) < 3 {
+		return f, errors.New("invalid input line")
+	}
+	commands, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return f, errors.New("invalid commands")
+	}
+	f.Commands = byte(commands)
+	for port := 0; port < 2 && port+2 < len(fields); port++ {
+		buttons := fields[port+2]
+		if buttons == "" {
+			continue
+		}
+		if len(buttons) != 8 {
+			return f, fmt.Errorf("invalid input for port %d", port)
+		}
+		for i := 0; i < 8; i++ {
+			if buttons[i] != '.' && buttons[i] != ' ' {
+				f.Buttons[port] |= 1 << uint(7-i)
+			}
+		}
+	}
+	return f, nil
+}
+
+// WriteFM2 writes the movie in the FCEUX FM2 text format. Movies that start
+// from a save state cannot be written, since FM2 save states are in FCEUX's
+// own format.
+func (m *Movie) WriteFM2(w io.Writer) error {
+	if m.State != nil {
+		return errors.New("fm2: only movies that start at power-on can be exported")
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "version 3")
+	fmt.Fprintln(bw, "emuVersion 20604")
+	fmt.Fprintf(bw, "rerecordCount %d\n", m.Rerecords)
+	fmt.Fprintln(bw, "palFlag 0")
+	if hash, err := hex.DecodeString(m.ROMHash); err == nil && len(hash) > 0 {
+		fmt.Fprintf(bw, "romChecksum base64:%s\n", base64.StdEncoding.EncodeToString(hash))
+	}
+	fmt.Fprintln(bw, "fourscore 0")
+	fmt.Fprintln(bw, "port0 1")
+	fmt.Fprintln(bw, "port1 1")
+	fmt.Fprintln(bw, "port2 0")
+	for _, comment := range m.Comments {
+		fmt.Fprintf(bw, "comment %s\n", comment)
+	}
+	for _, f := range m.Frames {
+		fmt.Fprintf(bw, "|%d|%s|%s||\n", f.Commands,
+			fm2Input(f.Buttons[0]), fm2Input(f.Buttons[1]))
+	}
+	return bw.Flush()
+}
+
+func fm2Input(b byte) string {
+	s := []byte("........")
+	for i := 0; i < 8; i++ {
+		if b>>uint(7-i)&1 == 1 {
+			s[i] = fm2Buttons[i]
+		}
+	}
+	return string(s)
+}
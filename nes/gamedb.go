@@ -0,0 +1,93 @@
+package nes
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"sort"
+)
+
+// GameInfo is a game database entry. Games are identified by the CRC32 and
+// SHA-1 of their PRG-ROM followed by their CHR-ROM, without the header.
+// Region and Submapper are for information only: the console always runs at
+// NTSC timing and none of the implemented mappers have submappers.
+type GameInfo struct {
+	CRC32     uint32
+	SHA1      string // lowercase hex
+	Title     string
+	Publisher string
+	Region    string // NTSC, PAL, Multi or Dendy
+	Mapper    int
+	Submapper int
+	Mirror    byte // MirrorHorizontal, MirrorVertical or MirrorFour
+	Battery   bool
+	PRGRAM    int // PRG-RAM size in bytes, battery-backed or not
+	CHRRAM    int // CHR-RAM size in bytes
+}
+
+// LookupGame returns the game database entry for a cartridge's ROM, or nil.
+// The checked-in database is empty until generated with util/gamedb, so
+// until then this always returns nil.
+func LookupGame(prg, chr []byte) *GameInfo {
+	return lookupGame(gameDB, prg, chr)
+}
+
+// lookupGame searches db, which must be sorted by CRC32
+func lookupGame(db []GameInfo, prg, chr []byte) *GameInfo {
+	crc := crc32.Update(crc32.ChecksumIEEE(prg), crc32.IEEETable, chr)
+	i := sort.Search(len(db), func(i int) bool {
+		return db[i].CRC32 >= crc
+	})
+	sum := ""
+	for ; i < len(db) && db[i].CRC32 == crc; i++ {
+		info := &db[i]
+		if info.SHA1 == "" {
+			return info
+		}
+		if sum == "" {
+			h := sha1.New()
+			h.Write(prg)
+			h.Write(chr)
+			sum = hex.EncodeToString(h.Sum(nil))
+		}
+		if info.SHA1 == sum {
+			return info
+		}
+	}
+	return nil
+}
+
+// applyGameInfo corrects the cartridge's mapper, mirroring, battery and RAM
+// sizes with those from the game database, noting each change in HeaderFixes
+func (cartridge *Cartridge) applyGameInfo(info *GameInfo) {
+	cartridge.Info = info
+	fix := func(format string, a ...interface{}) {
+		cartridge.HeaderFixes = append(cartridge.HeaderFixes, fmt.Sprintf(format, a...))
+	}
+	if info.Mapper < 256 && byte(info.Mapper) != cartridge.Mapper {
+		fix("mapper %d -> %d", cartridge.Mapper, info.Mapper)
+		cartridge.Mapper = byte(info.Mapper)
+	}
+	if info.Mirror != cartridge.Mirror {
+		fix("mirroring %d -> %d", cartridge.Mirror, info.Mirror)
+		cartridge.Mirror = info.Mirror
+	}
+	battery := byte(0)
+	if info.Battery {
+		battery = 1
+	}
+	if battery != cartridge.Battery {
+		fix("battery %d -> %d", cartridge.Battery, battery)
+		cartridge.Battery = battery
+	}
+	// mappers assume at least 8KB of each, so RAM only grows
+	if info.PRGRAM > len(cartridge.SRAM) {
+		fix("PRG-RAM %dKB -> %dKB", len(cartridge.SRAM)/1024, info.PRGRAM/1024)
+		cartridge.SRAM = make([]byte, info.PRGRAM)
+	}
+	if cartridge.CHRRAM && info.CHRRAM > len(cartridge.CHR) {
+		fix("CHR-RAM %dKB -> %dKB", len(cartridge.CHR)/1024, info.CHRRAM/1024)
+		cartridge.CHR = make([]byte, info.CHRRAM)
+	}
+}
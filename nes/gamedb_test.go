@@ -0,0 +1,62 @@
+package nes
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"hash/crc32"
+	"reflect"
+	"testing"
+
+	"github.com/fogleman/nes/internal/testrom"
+)
+
+func TestHeaderGarbage(t *testing.T) {
+	header := append([]byte{'N', 'E', 'S', 0x1A, 1, 1, 0x10}, "DiskDude!"...)
+	cartridge, err := LoadNES(testrom.Image(header, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cartridge.Mapper != 1 || len(cartridge.HeaderFixes) != 1 {
+		t.Errorf("got mapper %d, fixes %v", cartridge.Mapper, cartridge.HeaderFixes)
+	}
+}
+
+func TestGameDB(t *testing.T) {
+	cartridge, err := LoadNES(testrom.NROM(debuggerProgram))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cartridge.Info != nil || cartridge.HeaderFixes != nil {
+		t.Fatalf("unknown rom found: %+v", cartridge.Info)
+	}
+
+	data := append(append([]byte(nil), cartridge.PRG...), cartridge.CHR...)
+	sum := sha1.Sum(data)
+	info := GameInfo{
+		CRC32: crc32.ChecksumIEEE(data), SHA1: hex.EncodeToString(sum[:]),
+		Title: "Test", Mapper: 2, Mirror: MirrorVertical, Battery: true,
+		PRGRAM: 0x8000,
+	}
+	db := []GameInfo{{CRC32: info.CRC32 - 1}, info, {CRC32: info.CRC32 + 1}}
+	got := lookupGame(db, cartridge.PRG, cartridge.CHR)
+	if !reflect.DeepEqual(got, &info) {
+		t.Fatalf("got %+v", got)
+	}
+	cartridge.applyGameInfo(got)
+	want := []string{
+		"mapper 0 -> 2", "mirroring 0 -> 1", "battery 0 -> 1",
+		"PRG-RAM 8KB -> 32KB"}
+	if !reflect.DeepEqual(cartridge.HeaderFixes, want) {
+		t.Errorf("got fixes %q", cartridge.HeaderFixes)
+	}
+	if cartridge.Mapper != 2 || cartridge.Mirror != MirrorVertical ||
+		cartridge.Battery != 1 || len(cartridge.SRAM) != 0x8000 {
+		t.Errorf("header not corrected: %+v", cartridge)
+	}
+
+	// a CRC32 collision
+	db[1].SHA1 = "0123"
+	if got := lookupGame(db, cartridge.PRG, cartridge.CHR); got != nil {
+		t.Errorf("got %+v for a different SHA-1", got)
+	}
+}
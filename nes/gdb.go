@@ -0,0 +1,473 @@
+package nes
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gdbTargetXML describes the register layout to GDB: a, x, y, sp, pc, p
+const gdbTargetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.gnu.gdb.mos6502.core">
+    <reg name="a" bitsize="8" type="uint8" regnum="0"/>
+    <reg name="x" bitsize="8" type="uint8"/>
+    <reg name="y" bitsize="8" type="uint8"/>
+    <reg name="sp" bitsize="8" type="uint8"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+    <reg name="p" bitsize="8" type="uint8"/>
+  </feature>
+</target>`
+
+// GDBServer implements the GDB remote serial protocol for the CPU. The
+// registers are A, X, Y, SP, PC and P, in that order, and memory is the CPU
+// address space. Execution is controlled through the console's Debugger, so
+// the emulation loop simply stops advancing while GDB has the target halted.
+//
+// The emulation loop and the server both access the console; lock must be
+// held by the loop while it steps the console.
+type GDBServer struct {
+	console  *Console
+	lock     sync.Locker
+	stops    chan bool
+	mu       sync.Mutex
+	listener net.Listener
+	conn     net.Conn // the connection being served, if any
+	closed   bool
+	running  bool             // GDB is waiting for a stop reply
+	points   map[string][]int // GDB breakpoint spec -> debugger IDs
+	attached bool             // listening for the debugger's pauses
+}
+
+var errGDBClosed = errors.New("gdb server closed")
+
+func NewGDBServer(console *Console, lock sync.Locker) *GDBServer {
+	s := GDBServer{console: console, lock: lock}
+	s.stops = make(chan bool, 1)
+	s.points = make(map[string][]int)
+	return &s
+}
+
+// attach listens for pauses, creating the console's debugger on the first
+// connection rather than slowing the console down before then; s.lock
+// must be held
+func (s *GDBServer) attach() *Debugger {
+	debugger := s.console.Debugger()
+	if !s.attached {
+		s.attached = true
+		debugger.OnBreak(func(reason string) {
+			if s.running {
+				s.running = false
+				select {
+				case s.stops <- true:
+				default:
+				}
+			}
+		})
+	}
+	return debugger
+}
+
+// ListenAndServe accepts GDB connections on address, e.g. "localhost:2345".
+func (s *GDBServer) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on listener, one at a time, until Close.
+func (s *GDBServer) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return errGDBClosed
+		}
+		s.conn = conn
+		s.mu.Unlock()
+		s.serveConn(conn)
+		s.mu.Lock()
+		s.conn = nil
+		s.mu.Unlock()
+	}
+}
+
+// Close stops accepting connections and disconnects GDB, which resumes
+// the console.
+func (s *GDBServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+// gdbPacket is a packet or an interrupt (0x03) received from GDB
+type gdbPacket struct {
+	data      string
+	interrupt bool
+}
+
+func (s *GDBServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	packets := make(chan gdbPacket)
+	go readGDBPackets(conn, packets)
+
+	s.lock.Lock()
+	debugger := s.attach()
+	debugger.Pause()
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		s.running = false
+		for _, ids := range s.points {
+			for _, id := range ids {
+				debugger.RemoveBreakpoint(id)
+			}
+		}
+		s.points = make(map[string][]int)
+		debugger.Continue()
+		s.lock.Unlock()
+	}()
+
+	reply := func(data string) bool {
+		_, err := fmt.Fprintf(conn, "$%s#%02x", data, gdbChecksum(data))
+		return err == nil
+	}
+	for {
+		var packet gdbPacket
+		var ok bool
+		select {
+		case packet, ok = <-packets:
+			if !ok {
+				return
+			}
+		case <-s.stops:
+			if !reply(s.stopReply()) {
+				return
+			}
+			continue
+		}
+		if packet.interrupt {
+			s.lock.Lock()
+			wasRunning := s.running
+			s.running = false
+			debugger.Pause()
+			s.lock.Unlock()
+			if wasRunning && !reply("S02") {
+				return
+			}
+			continue
+		}
+		s.lock.Lock()
+		response, resume := s.handle(packet.data)
+		if resume {
+			s.running = true
+		}
+		s.lock.Unlock()
+		if packet.data == "k" {
+			return
+		}
+		if !resume && !reply(response) {
+			return
+		}
+		if packet.data == "D" {
+			return
+		}
+	}
+}
+
+// readGDBPackets acknowledges and forwards packets until the connection
+// closes
+func readGDBPackets(conn net.Conn, packets chan<- gdbPacket) {
+	defer close(packets)
+	reader := bufio.NewReader(conn)
+	for {
+		c, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		switch c {
+		case 0x03:
+			packets <- gdbPacket{interrupt: true}
+		case '$':
+			data, err := reader.ReadString('#')
+			if err != nil {
+				return
+			}
+			data = data[:len(data)-1]
+			sum := make([]byte, 2)
+			if _, err := reader.Read(sum[:1]); err != nil {
+				return
+			}
+			if _, err := reader.Read(sum[1:]); err != nil {
+				return
+			}
+			checksum, err := strconv.ParseUint(string(sum), 16, 8)
+			if err != nil || byte(checksum) != gdbChecksum(data) {
+				conn.Write([]byte("-"))
+				continue
+			}
+			conn.Write([]byte("+"))
+			packets <- gdbPacket{data: gdbUnescape(data)}
+		}
+	}
+}
+
+func gdbChecksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+func gdbUnescape(data string) string {
+	if !strings.Contains(data, "}") {
+		return data
+	}
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			b.WriteByte(data[i] ^ 0x20)
+		} else {
+			b.WriteByte(data[i])
+		}
+	}
+	return b.String()
+}
+
+// stopReply describes why the target stopped
+func (s *GDBServer) stopReply() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	debugger := s.console.Debugger()
+	b := debugger.Breakpoint()
+	if b == nil || b.Kind&(BreakRead|BreakWrite) == 0 {
+		return "S05"
+	}
+	watch := map[int]string{
+		BreakRead:              "rwatch",
+		BreakWrite:             "watch",
+		BreakRead | BreakWrite: "awatch",
+	}[b.Kind]
+	return fmt.Sprintf("T05%s:%04x;", watch, debugger.BreakAddress())
+}
+
+// handle runs a command with the lock held. resume reports that the target
+// was resumed and a stop reply will follow later.
+func (s *GDBServer) handle(data string) (response string, resume bool) {
+	debugger := s.console.Debugger()
+	cpu := s.console.CPU
+	if data == "" {
+		return "", false
+	}
+	args := data[1:]
+	switch data[0] {
+	case '?':
+		return "S05", false
+	case 'g':
+		return fmt.Sprintf("%02x%02x%02x%02x%02x%02x%02x",
+			cpu.A, cpu.X, cpu.Y, cpu.SP, byte(cpu.PC), byte(cpu.PC>>8), cpu.Flags()), false
+	case 'G':
+		b, err := hex.DecodeString(args)
+		if err != nil || len(b) < 7 {
+			return "E01", false
+		}
+		cpu.A, cpu.X, cpu.Y, cpu.SP = b[0], b[1], b[2], b[3]
+		cpu.PC = uint16(b[4]) | uint16(b[5])<<8
+		cpu.SetFlags(b[6])
+		return "OK", false
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || n > 5 {
+			return "E01", false
+		}
+		values := []byte{cpu.A, cpu.X, cpu.Y, cpu.SP, 0, cpu.Flags()}
+		if n == 4 {
+			return fmt.Sprintf("%02x%02x", byte(cpu.PC), byte(cpu.PC>>8)), false
+		}
+		return fmt.Sprintf("%02x", values[n]), false
+	case 'P':
+		parts := strings.SplitN(args, "=", 2)
+		if len(parts) != 2 {
+			return "E01", false
+		}
+		n, err1 := strconv.ParseUint(parts[0], 16, 8)
+		b, err2 := hex.DecodeString(parts[1])
+		if err1 != nil || err2 != nil || len(b) == 0 || n > 5 {
+			return "E01", false
+		}
+		names := []string{"A", "X", "Y", "SP", "PC", "P"}
+		value := int(b[0])
+		if n == 4 && len(b) > 1 {
+			value |= int(b[1]) << 8
+		}
+		debugger.SetRegister(names[n], value)
+		return "OK", false
+	case 'm':
+		address, length, ok := parseGDBRange(args)
+		if !ok {
+			return "E01", false
+		}
+		return hex.EncodeToString(debugger.ReadMemory(address, length)), false
+	case 'M':
+		parts := strings.SplitN(args, ":", 2)
+		address, length, ok := parseGDBRange(parts[0])
+		if !ok || len(parts) != 2 {
+			return "E01", false
+		}
+		b, err := hex.DecodeString(parts[1])
+		if err != nil || len(b) != length {
+			return "E01", false
+		}
+		debugger.WriteMemory(address, b)
+		return "OK", false
+	case 'X':
+		parts := strings.SplitN(args, ":", 2)
+		address, length, ok := parseGDBRange(parts[0])
+		if !ok || len(parts) != 2 || len(parts[1]) != length {
+			return "E01", false
+		}
+		debugger.WriteMemory(address, []byte(parts[1]))
+		return "OK", false
+	case 'c':
+		if args != "" {
+			if n, err := strconv.ParseUint(args, 16, 16); err == nil {
+				cpu.PC = uint16(n)
+			}
+		}
+		debugger.Continue()
+		return "", true
+	case 's':
+		if args != "" {
+			if n, err := strconv.ParseUint(args, 16, 16); err == nil {
+				cpu.PC = uint16(n)
+			}
+		}
+		debugger.StepInto()
+		return "", true
+	case 'Z', 'z':
+		return s.breakpoint(data[0] == 'Z', args), false
+	case 'H', 'T':
+		return "OK", false
+	case 'D':
+		return "OK", false
+	case 'k':
+		return "", false
+	case 'q':
+		return s.query(args), false
+	}
+	return "", false
+}
+
+// breakpoint handles Z and z packets: TYPE,ADDR,KIND
+func (s *GDBServer) breakpoint(insert bool, args string) string {
+	debugger := s.console.Debugger()
+	parts := strings.Split(args, ",")
+	if len(parts) < 3 {
+		return "E01"
+	}
+	kinds := map[string]int{
+		"0": BreakExecute,
+		"1": BreakExecute,
+		"2": BreakWrite,
+		"3": BreakRead,
+		"4": BreakRead | BreakWrite,
+	}
+	kind, ok := kinds[parts[0]]
+	if !ok {
+		return ""
+	}
+	address, length, ok := parseGDBRange(parts[1] + "," + parts[2])
+	if !ok {
+		return "E01"
+	}
+	if kind == BreakExecute || length < 1 {
+		length = 1
+	}
+	key := strings.Join(parts[:3], ",")
+	if !insert {
+		for _, id := range s.points[key] {
+			debugger.RemoveBreakpoint(id)
+		}
+		delete(s.points, key)
+		return "OK"
+	}
+	b, err := debugger.AddBreakpoint(kind, address, address+uint16(length-1), "")
+	if err != nil {
+		return "E01"
+	}
+	s.points[key] = append(s.points[key], b.ID)
+	return "OK"
+}
+
+func (s *GDBServer) query(args string) string {
+	switch {
+	case strings.HasPrefix(args, "Supported"):
+		return "PacketSize=1000;qXfer:features:read+"
+	case args == "Attached":
+		return "1"
+	case args == "C":
+		return "QC1"
+	case args == "fThreadInfo":
+		return "m1"
+	case args == "sThreadInfo":
+		return "l"
+	case strings.HasPrefix(args, "Xfer:features:read:target.xml:"):
+		offset, length, ok := parseGDBRange(strings.TrimPrefix(args, "Xfer:features:read:target.xml:"))
+		if !ok {
+			return "E01"
+		}
+		return gdbXfer(gdbTargetXML, int(offset), length)
+	}
+	return ""
+}
+
+// gdbXfer returns part of an object for a qXfer read
+func gdbXfer(object string, offset, length int) string {
+	if offset >= len(object) {
+		return "l"
+	}
+	end := offset + length
+	if end >= len(object) {
+		return "l" + object[offset:]
+	}
+	return "m" + object[offset:end]
+}
+
+// parseGDBRange parses "ADDR,LENGTH" in hex
+func parseGDBRange(s string) (uint16, int, bool) {
+	parts := strings.SplitN(s, ",", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	address, err1 := strconv.ParseUint(parts[0], 16, 32)
+	length, err2 := strconv.ParseUint(parts[1], 16, 32)
+	if err1 != nil || err2 != nil || length > 0x10000 {
+		return 0, 0, false
+	}
+	return uint16(address), int(length), true
+}
@@ -0,0 +1,152 @@
+package nes
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type gdbClient struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// command sends a packet and returns the reply
+func (c *gdbClient) command(data string) string {
+	fmt.Fprintf(c.conn, "$%s#%02x", data, gdbChecksum(data))
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if ack, err := c.reader.ReadByte(); err != nil || ack != '+' {
+		c.t.Fatalf("%s: no ack (%v)", data, err)
+	}
+	if _, err := c.reader.ReadString('$'); err != nil {
+		c.t.Fatalf("%s: %v", data, err)
+	}
+	reply, err := c.reader.ReadString('#')
+	if err != nil {
+		c.t.Fatalf("%s: %v", data, err)
+	}
+	c.reader.Discard(2)
+	c.conn.Write([]byte("+"))
+	return strings.TrimSuffix(reply, "#")
+}
+
+// waitClosed reads until the server closes the connection, which may reset
+// it since the client's last ack is never read
+func (c *gdbClient) waitClosed() {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := ioutil.ReadAll(c.reader)
+	if err, ok := err.(net.Error); ok && err.Timeout() {
+		c.t.Fatal("connection not closed")
+	}
+}
+
+func (c *gdbClient) expect(data, want string) {
+	if got := c.command(data); got != want {
+		c.t.Errorf("%s: got %q, want %q", data, got, want)
+	}
+}
+
+func TestGDBServer(t *testing.T) {
+	console := newTestConsole(t, debuggerProgram)
+	var lock sync.Mutex
+	server := NewGDBServer(console, &lock)
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	// the emulation loop
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			lock.Lock()
+			console.StepFrame()
+			lock.Unlock()
+			runtime.Gosched()
+		}
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := &gdbClient{t, conn, bufio.NewReader(conn)}
+
+	c.expect("?", "S05")
+	if reply := c.command("qSupported:multiprocess+"); !strings.Contains(reply, "qXfer:features:read+") {
+		t.Errorf("qSupported: %q", reply)
+	}
+	c.expect("Z0,8010,1", "OK")
+	c.expect("c", "S05")
+	if regs := c.command("g"); len(regs) != 14 || regs[8:12] != "1080" {
+		t.Errorf("registers at breakpoint: %q, want pc $8010", regs)
+	}
+	c.expect("z0,8010,1", "OK")
+	c.expect("s", "S05")
+	c.expect("p4", "1280")
+
+	c.expect("Z2,10,1", "OK")
+	c.expect("M0010,1:00", "OK")
+	c.expect("c", "T05watch:0010;")
+	c.expect("m10,1", "10")
+	c.expect("z2,10,1", "OK")
+
+	// the reply has the address written, not the start of the range
+	c.expect("Z2,2fe,4", "OK")
+	c.expect("c", "T05watch:0300;")
+	c.expect("z2,2fe,4", "OK")
+
+	c.expect("P0=42", "OK")
+	c.expect("p0", "42")
+
+	// continue, then interrupt; packets are handled in order
+	fmt.Fprintf(conn, "$c#%02x", gdbChecksum("c"))
+	if ack, _ := c.reader.ReadByte(); ack != '+' {
+		t.Fatal("c: no ack")
+	}
+	conn.Write([]byte{0x03})
+	if _, err := c.reader.ReadString('$'); err != nil {
+		t.Fatal(err)
+	}
+	if reply, _ := c.reader.ReadString('#'); reply != "S02#" {
+		t.Errorf("interrupt: got %q", reply)
+	}
+	c.reader.Discard(2)
+
+	// the server resumes the console before closing the connection
+	c.expect("D", "OK")
+	c.waitClosed()
+	lock.Lock()
+	paused := console.Debugger().Paused()
+	lock.Unlock()
+	if paused {
+		t.Error("console still paused after detach")
+	}
+
+	// closing the server disconnects GDB
+	conn, err = net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c = &gdbClient{t, conn, bufio.NewReader(conn)}
+	c.expect("?", "S05")
+	server.Close()
+	c.waitClosed()
+}
@@ -0,0 +1,101 @@
+package nes
+
+// hooks holds the callbacks registered with OnFrame, OnLoad, OnExecute and
+// OnWrite
+type hooks struct {
+	frame   []*hook
+	load    []*hook
+	execute map[uint16][]*hook
+	write   map[uint16][]*writeHook
+}
+
+type hook struct {
+	f func()
+}
+
+type writeHook struct {
+	f func(address uint16, value byte)
+}
+
+func (console *Console) getHooks() *hooks {
+	if console.hooks == nil {
+		console.hooks = &hooks{
+			execute: make(map[uint16][]*hook),
+			write:   make(map[uint16][]*writeHook),
+		}
+	}
+	return console.hooks
+}
+
+// OnFrame registers a function to be called at the end of each frame, when
+// the PPU enters vertical blank. Console.Buffer holds the finished frame.
+// Calling the returned function removes it again.
+func (console *Console) OnFrame(f func()) (remove func()) {
+	h := console.getHooks()
+	x := &hook{f}
+	h.frame = append(h.frame, x)
+	return func() {
+		h.frame = removeHook(h.frame, x)
+	}
+}
+
+// OnLoad registers a function to be called after the console state is
+// replaced by Load, PowerCycle or a movie starting. Calling the returned
+// function removes it again.
+func (console *Console) OnLoad(f func()) (remove func()) {
+	h := console.getHooks()
+	x := &hook{f}
+	h.load = append(h.load, x)
+	return func() {
+		h.load = removeHook(h.load, x)
+	}
+}
+
+// OnExecute registers a function to be called before the CPU executes the
+// instruction at address. Calling the returned function removes it again.
+func (console *Console) OnExecute(address uint16, f func()) (remove func()) {
+	h := console.getHooks()
+	x := &hook{f}
+	h.execute[address] = append(h.execute[address], x)
+	return func() {
+		h.execute[address] = removeHook(h.execute[address], x)
+	}
+}
+
+// OnWrite registers a function to be called after the CPU writes to
+// address. Calling the returned function removes it again.
+func (console *Console) OnWrite(address uint16, f func(address uint16, value byte)) (remove func()) {
+	h := console.getHooks()
+	x := &writeHook{f}
+	h.write[address] = append(h.write[address], x)
+	return func() {
+		list := h.write[address]
+		for i, y := range list {
+			if y == x {
+				h.write[address] = append(list[:i:i], list[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func removeHook(list []*hook, x *hook) []*hook {
+	for i, y := range list {
+		if y == x {
+			return append(list[:i:i], list[i+1:]...)
+		}
+	}
+	return list
+}
+
+// ClearHooks removes all functions registered with OnFrame, OnLoad,
+// OnExecute and OnWrite.
+func (console *Console) ClearHooks() {
+	console.hooks = nil
+}
+
+// Poke writes a byte to the CPU address space without triggering
+// breakpoints or hooks.
+func (console *Console) Poke(address uint16, value byte) {
+	console.CPU.Memory.(*cpuMemory).write(address, value)
+}
@@ -0,0 +1,72 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+)
+
+// IndexedImage is a frame of palette indexes, one uint16 per pixel. The low
+// 6 bits hold the palette RAM value (after grayscale masking) and bits 6-8
+// hold the PPUMASK emphasis bits, so each pixel indexes directly into a
+// Palette.
+type IndexedImage struct {
+	Pix    []uint16
+	Stride int
+	Rect   image.Rectangle
+}
+
+func NewIndexedImage(r image.Rectangle) *IndexedImage {
+	w, h := r.Dx(), r.Dy()
+	return &IndexedImage{make([]uint16, w*h), w, r}
+}
+
+func (p *IndexedImage) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+func (p *IndexedImage) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x - p.Rect.Min.X)
+}
+
+func (p *IndexedImage) IndexAt(x, y int) uint16 {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return 0
+	}
+	return p.Pix[p.PixOffset(x, y)]
+}
+
+func (p *IndexedImage) SetIndex(x, y int, index uint16) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	p.Pix[p.PixOffset(x, y)] = index
+}
+
+// RGBA resolves the indexes through the palette into dst, allocating a new
+// image if dst is nil.
+func (p *IndexedImage) RGBA(palette *Palette, dst *image.RGBA) *image.RGBA {
+	if dst == nil {
+		dst = image.NewRGBA(p.Rect)
+	}
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		for x := p.Rect.Min.X; x < p.Rect.Max.X; x++ {
+			dst.SetRGBA(x, y, palette[p.Pix[p.PixOffset(x, y)]%512])
+		}
+	}
+	return dst
+}
+
+// Paletted returns the frame as an image.Paletted using the first 64
+// colors of the palette, dropping the emphasis bits. It is intended for
+// encoders that want a compact 8-bit representation.
+func (p *IndexedImage) Paletted(palette *Palette) *image.Paletted {
+	colors := make(color.Palette, 64)
+	for i := range colors {
+		colors[i] = palette[i]
+	}
+	dst := image.NewPaletted(p.Rect, colors)
+	for i, index := range p.Pix {
+		dst.Pix[i] = byte(index & 0x3F)
+	}
+	return dst
+}
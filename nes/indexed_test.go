@@ -0,0 +1,56 @@
+package nes
+
+import (
+	"image"
+	"testing"
+)
+
+func TestIndexedImage(t *testing.T) {
+	im := NewIndexedImage(image.Rect(0, 0, 4, 2))
+	im.SetIndex(1, 0, 0x16)
+	im.SetIndex(3, 1, 0x21|6<<6)
+	im.SetIndex(4, 1, 0x30) // out of bounds
+	if im.IndexAt(1, 0) != 0x16 || im.IndexAt(3, 1) != 0x21|6<<6 || im.IndexAt(4, 1) != 0 {
+		t.Fatalf("got %v", im.Pix)
+	}
+	rgba := im.RGBA(DefaultPalette, nil)
+	paletted := im.Paletted(DefaultPalette)
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			index := im.IndexAt(x, y)
+			if got := rgba.RGBAAt(x, y); got != DefaultPalette[index] {
+				t.Errorf("RGBA at %d,%d: got %v, want %v", x, y, got, DefaultPalette[index])
+			}
+			if got := paletted.ColorIndexAt(x, y); uint16(got) != index&0x3F {
+				t.Errorf("Paletted at %d,%d: got $%02X", x, y, got)
+			}
+		}
+	}
+}
+
+// TestIndexedBuffer checks that the indexed frame resolves to the RGBA
+// frame, with grayscale and emphasis
+func TestIndexedBuffer(t *testing.T) {
+	p := []byte{0xAD, 0x02, 0x20} // LDA $2002
+	p = store(p, 0x2006, 0x3F)
+	p = store(p, 0x2006, 0x00)
+	p = store(p, 0x2007, 0x16)
+	p = store(p, 0x2001, 0xAB) // background, grayscale, red and blue emphasis
+	end := 0x8000 + uint16(len(p))
+	p = append(p, 0x4C, byte(end), byte(end>>8))
+	console := newTestConsole(t, p)
+	console.StepFrame()
+	console.StepFrame()
+
+	indexed := console.IndexedBuffer()
+	if got, want := indexed.IndexAt(100, 100), paletteIndex(0x16, true, 5); got != want {
+		t.Errorf("got index $%03X, want $%03X", got, want)
+	}
+	buffer := console.Buffer()
+	rgba := indexed.RGBA(console.Palette, nil)
+	for i := range buffer.Pix {
+		if rgba.Pix[i] != buffer.Pix[i] {
+			t.Fatalf("indexed frame differs from the RGBA frame at byte %d", i)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package nes
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 )
@@ -16,20 +18,43 @@ type iNESFileHeader struct {
 	Control1 byte    // control bits
 	Control2 byte    // control bits
 	NumRAM   byte    // PRG-RAM size (x 8KB)
-	_        [7]byte // unused padding
+	Padding  [7]byte // unused padding
 }
 
-// LoadNESFile reads an iNES file (.nes) and returns a Cartridge on success.
-// http://wiki.nesdev.com/w/index.php/INES
-// http://nesdev.com/NESDoc.pdf (page 28)
+// LoadNESFile reads an iNES file (.nes), which may be in a zip or gzip
+// archive, and returns a Cartridge on success.
 func LoadNESFile(path string) (*Cartridge, error) {
-	// open file
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
+	return ReadNES(file)
+}
+
+// ReadNES reads an iNES image, or an archive containing one, from r.
+func ReadNES(r io.Reader) (*Cartridge, error) {
+	data, err := ReadROM(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseNES(bytes.NewReader(data))
+}
+
+// LoadNES loads an iNES image, or an archive containing one, from memory.
+func LoadNES(data []byte) (*Cartridge, error) {
+	data, err := UnpackROM(data)
+	if err != nil {
+		return nil, err
+	}
+	return parseNES(bytes.NewReader(data))
+}
 
+// parseNES parses an iNES image. Header values are corrected from the game
+// database; see HeaderFixes.
+// http://wiki.nesdev.com/w/index.php/INES
+// http://nesdev.com/NESDoc.pdf (page 28)
+func parseNES(file io.Reader) (*Cartridge, error) {
 	// read file header
 	header := iNESFileHeader{}
 	if err := binary.Read(file, binary.LittleEndian, &header); err != nil {
@@ -44,6 +69,15 @@ func LoadNESFile(path string) (*Cartridge, error) {
 	// mapper type
 	mapper1 := header.Control1 >> 4
 	mapper2 := header.Control2 >> 4
+	// headers with text such as "DiskDude!" in the padding have a bogus
+	// upper mapper nibble, unless they are NES 2.0
+	var fixes []string
+	nes20 := header.Control2&0x0C == 0x08
+	if !nes20 && mapper2 != 0 && binary.LittleEndian.Uint32(header.Padding[3:]) != 0 {
+		fixes = append(fixes, fmt.Sprintf(
+			"mapper %d -> %d (garbage in header padding)", mapper1|mapper2<<4, mapper1))
+		mapper2 = 0
+	}
 	mapper := mapper1 | mapper2<<4
 
 	// mirroring type
@@ -74,11 +108,19 @@ func LoadNESFile(path string) (*Cartridge, error) {
 		return nil, err
 	}
 
+	info := LookupGame(prg, chr)
+
 	// provide chr-rom/ram if not in file
 	if header.NumCHR == 0 {
 		chr = make([]byte, 8192)
 	}
 
 	// success
-	return NewCartridge(prg, chr, mapper, mirror, battery), nil
+	cartridge := NewCartridge(prg, chr, mapper, mirror, battery)
+	cartridge.CHRRAM = header.NumCHR == 0
+	cartridge.HeaderFixes = fixes
+	if info != nil {
+		cartridge.applyGameInfo(info)
+	}
+	return cartridge, nil
 }
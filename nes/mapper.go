@@ -13,6 +13,12 @@ type Mapper interface {
 	Load(decoder *gob.Decoder) error
 }
 
+// idleMapper is implemented by mappers whose Step does nothing, so that the
+// console can skip calling it on every PPU cycle.
+type idleMapper interface {
+	idle()
+}
+
 func NewMapper(console *Console) (Mapper, error) {
 	cartridge := console.Cartridge
 	switch cartridge.Mapper {
@@ -55,6 +55,9 @@ func (m *Mapper1) Load(decoder *gob.Decoder) error {
 func (m *Mapper1) Step() {
 }
 
+func (m *Mapper1) idle() {
+}
+
 func (m *Mapper1) Read(address uint16) byte {
 	switch {
 	case address < 0x2000:
@@ -74,6 +77,18 @@ func (m *Mapper1) Read(address uint16) byte {
 	return 0
 }
 
+func (m *Mapper1) prgOffset(address uint16) int {
+	if address < 0x8000 {
+		return -1
+	}
+	address -= 0x8000
+	return m.prgOffsets[address/0x4000] + int(address%0x4000)
+}
+
+func (m *Mapper1) chrOffset(address uint16) int {
+	return m.chrOffsets[address/0x1000] + int(address%0x1000)
+}
+
 func (m *Mapper1) Write(address uint16, value byte) {
 	switch {
 	case address < 0x2000:
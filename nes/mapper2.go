@@ -36,6 +36,9 @@ func (m *Mapper2) Load(decoder *gob.Decoder) error {
 func (m *Mapper2) Step() {
 }
 
+func (m *Mapper2) idle() {
+}
+
 func (m *Mapper2) Read(address uint16) byte {
 	switch {
 	case address < 0x2000:
@@ -55,6 +58,20 @@ func (m *Mapper2) Read(address uint16) byte {
 	return 0
 }
 
+func (m *Mapper2) prgOffset(address uint16) int {
+	switch {
+	case address >= 0xC000:
+		return m.prgBank2*0x4000 + int(address-0xC000)
+	case address >= 0x8000:
+		return m.prgBank1*0x4000 + int(address-0x8000)
+	}
+	return -1
+}
+
+func (m *Mapper2) chrOffset(address uint16) int {
+	return int(address)
+}
+
 func (m *Mapper2) Write(address uint16, value byte) {
 	switch {
 	case address < 0x2000:
@@ -37,6 +37,9 @@ func (m *Mapper225) Load(decoder *gob.Decoder) error {
 func (m *Mapper225) Step() {
 }
 
+func (m *Mapper225) idle() {
+}
+
 func (m *Mapper225) Read(address uint16) byte {
 	switch {
 	case address < 0x2000:
@@ -57,6 +60,20 @@ func (m *Mapper225) Read(address uint16) byte {
 	return 0
 }
 
+func (m *Mapper225) prgOffset(address uint16) int {
+	switch {
+	case address >= 0xC000:
+		return m.prgBank2*0x4000 + int(address-0xC000)
+	case address >= 0x8000:
+		return m.prgBank1*0x4000 + int(address-0x8000)
+	}
+	return -1
+}
+
+func (m *Mapper225) chrOffset(address uint16) int {
+	return m.chrBank*0x2000 + int(address)
+}
+
 func (m *Mapper225) Write(address uint16, value byte) {
 	if (address < 0x8000) {
 		return
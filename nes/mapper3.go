@@ -34,6 +34,9 @@ func (m *Mapper3) Load(decoder *gob.Decoder) error {
 func (m *Mapper3) Step() {
 }
 
+func (m *Mapper3) idle() {
+}
+
 func (m *Mapper3) Read(address uint16) byte {
 	switch {
 	case address < 0x2000:
@@ -54,6 +57,20 @@ func (m *Mapper3) Read(address uint16) byte {
 	return 0
 }
 
+func (m *Mapper3) prgOffset(address uint16) int {
+	switch {
+	case address >= 0xC000:
+		return m.prgBank2*0x4000 + int(address-0xC000)
+	case address >= 0x8000:
+		return m.prgBank1*0x4000 + int(address-0x8000)
+	}
+	return -1
+}
+
+func (m *Mapper3) chrOffset(address uint16) int {
+	return m.chrBank*0x2000 + int(address)
+}
+
 func (m *Mapper3) Write(address uint16, value byte) {
 	switch {
 	case address < 0x2000:
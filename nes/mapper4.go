@@ -98,6 +98,18 @@ func (m *Mapper4) Read(address uint16) byte {
 	return 0
 }
 
+func (m *Mapper4) prgOffset(address uint16) int {
+	if address < 0x8000 {
+		return -1
+	}
+	address -= 0x8000
+	return m.prgOffsets[address/0x2000] + int(address%0x2000)
+}
+
+func (m *Mapper4) chrOffset(address uint16) int {
+	return m.chrOffsets[address/0x0400] + int(address%0x0400)
+}
+
 func (m *Mapper4) Write(address uint16, value byte) {
 	switch {
 	case address < 0x2000:
@@ -6,40 +6,68 @@ import (
 	"log"
 )
 
+// mapper40IRQCycles is the period of the IRQ counter in CPU cycles
+const mapper40IRQCycles = 4096
+
 type Mapper40 struct {
 	*Cartridge
 	console *Console
 	bank    int
-	cycles  int
+	irqAt   uint64 // cycle of the next IRQ, or never while disabled
 }
 
 func NewMapper40(console *Console, cartridge *Cartridge) Mapper {
-	return &Mapper40{cartridge, console, 0, 0}
+	m := &Mapper40{cartridge, console, 0, mapper40IRQCycles}
+	console.scheduler.handle(eventMapperIRQ, m.irq)
+	console.scheduler.schedule(eventMapperIRQ, m.irqAt)
+	return m
 }
 
+// Save stores the counter as PPU cycles since it started, or -1 while
+// disabled, as it was stored when the mapper counted every PPU cycle.
 func (m *Mapper40) Save(encoder *gob.Encoder) error {
+	cycles := -1
+	if m.irqAt != never {
+		cycles = 3 * int(mapper40IRQCycles-(m.irqAt-m.console.APU.cycle))
+	}
 	encoder.Encode(m.bank)
-	encoder.Encode(m.cycles)
+	encoder.Encode(cycles)
 	return nil
 }
 
 func (m *Mapper40) Load(decoder *gob.Decoder) error {
+	var cycles int
 	decoder.Decode(&m.bank)
-	decoder.Decode(&m.cycles)
+	decoder.Decode(&cycles)
+	if cycles < 0 {
+		m.setIRQ(never)
+	} else {
+		m.setIRQ(m.console.APU.cycle + mapper40IRQCycles - uint64(cycles/3))
+	}
 	return nil
 }
 
+// Step does nothing; the IRQ counter runs on the scheduler.
 func (m *Mapper40) Step() {
-	if m.cycles < 0 {
-		return
-	}
-	m.cycles++
-	if m.cycles%(4096*3) == 0 {
-		m.cycles = 0
-		m.console.CPU.triggerIRQ()
+}
+
+func (m *Mapper40) idle() {
+}
+
+func (m *Mapper40) setIRQ(at uint64) {
+	m.irqAt = at
+	if at == never {
+		m.console.scheduler.cancel(eventMapperIRQ)
+	} else {
+		m.console.scheduler.schedule(eventMapperIRQ, at)
 	}
 }
 
+func (m *Mapper40) irq() {
+	m.console.CPU.triggerIRQ()
+	m.setIRQ(m.irqAt + mapper40IRQCycles)
+}
+
 func (m *Mapper40) Read(address uint16) byte {
 	switch {
 	case address < 0x2000:
@@ -60,14 +88,34 @@ func (m *Mapper40) Read(address uint16) byte {
 	return 0
 }
 
+func (m *Mapper40) prgOffset(address uint16) int {
+	switch {
+	case address >= 0xe000:
+		return int(address-0xe000) + 0x2000*7
+	case address >= 0xc000:
+		return int(address-0xc000) + 0x2000*m.bank
+	case address >= 0xa000:
+		return int(address-0xa000) + 0x2000*5
+	case address >= 0x8000:
+		return int(address-0x8000) + 0x2000*4
+	case address >= 0x6000:
+		return int(address-0x6000) + 0x2000*6
+	}
+	return -1
+}
+
+func (m *Mapper40) chrOffset(address uint16) int {
+	return int(address)
+}
+
 func (m *Mapper40) Write(address uint16, value byte) {
 	switch {
 	case address < 0x2000:
 		m.CHR[address] = value
 	case address >= 0x8000 && address < 0xa000:
-		m.cycles = -1
+		m.setIRQ(never)
 	case address >= 0xa000 && address < 0xc000:
-		m.cycles = 0
+		m.setIRQ(m.console.APU.cycle + mapper40IRQCycles)
 	case address >= 0xe000:
 		m.bank = int(value)
 	default:
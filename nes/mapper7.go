@@ -27,6 +27,9 @@ func (m *Mapper7) Load(decoder *gob.Decoder) error {
 func (m *Mapper7) Step() {
 }
 
+func (m *Mapper7) idle() {
+}
+
 func (m *Mapper7) Read(address uint16) byte {
 	switch {
 	case address < 0x2000:
@@ -43,6 +46,17 @@ func (m *Mapper7) Read(address uint16) byte {
 	return 0
 }
 
+func (m *Mapper7) prgOffset(address uint16) int {
+	if address < 0x8000 {
+		return -1
+	}
+	return m.prgBank*0x8000 + int(address-0x8000)
+}
+
+func (m *Mapper7) chrOffset(address uint16) int {
+	return int(address)
+}
+
 func (m *Mapper7) Write(address uint16, value byte) {
 	switch {
 	case address < 0x2000:
@@ -18,6 +18,14 @@ func NewCPUMemory(console *Console) Memory {
 }
 
 func (mem *cpuMemory) Read(address uint16) byte {
+	value := mem.read(address)
+	if mem.console.debugger != nil {
+		mem.console.debugger.access(BreakRead, address, value)
+	}
+	return value
+}
+
+func (mem *cpuMemory) read(address uint16) byte {
 	switch {
 	case address < 0x2000:
 		return mem.console.RAM[address%0x0800]
@@ -34,14 +42,46 @@ func (mem *cpuMemory) Read(address uint16) byte {
 	case address < 0x6000:
 		// TODO: I/O registers
 	case address >= 0x6000:
-		return mem.console.Mapper.Read(address)
+		return mem.readPRG(address)
 	default:
 		log.Fatalf("unhandled cpu memory read at address: 0x%04X", address)
 	}
 	return 0
 }
 
+// peek reads a byte without side effects. I/O registers read as zero.
+func (mem *cpuMemory) peek(address uint16) byte {
+	switch {
+	case address < 0x2000:
+		return mem.console.RAM[address%0x0800]
+	case address >= 0x6000:
+		return mem.readPRG(address)
+	}
+	return 0
+}
+
+// readPRG reads cartridge space, applying any Game Genie codes
+func (mem *cpuMemory) readPRG(address uint16) byte {
+	value := mem.console.Mapper.Read(address)
+	if mem.console.cheats != nil && address >= 0x8000 {
+		value = mem.console.cheats.patch(address, value)
+	}
+	return value
+}
+
 func (mem *cpuMemory) Write(address uint16, value byte) {
+	if mem.console.debugger != nil {
+		mem.console.debugger.access(BreakWrite, address, value)
+	}
+	mem.write(address, value)
+	if hooks := mem.console.hooks; hooks != nil {
+		for _, h := range hooks.write[address] {
+			h.f(address, value)
+		}
+	}
+}
+
+func (mem *cpuMemory) write(address uint16, value byte) {
 	switch {
 	case address < 0x2000:
 		mem.console.RAM[address%0x0800] = value
@@ -81,6 +121,9 @@ func (mem *ppuMemory) Read(address uint16) byte {
 	address = address % 0x4000
 	switch {
 	case address < 0x2000:
+		if m := mem.console.mapper2; m != nil {
+			return m.CHR[address] // NROM and UNROM, without an interface call
+		}
 		return mem.console.Mapper.Read(address)
 	case address < 0x3F00:
 		mode := mem.console.Cartridge.Mirror
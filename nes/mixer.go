@@ -0,0 +1,154 @@
+package nes
+
+// audio channels
+const (
+	ChannelPulse1 = iota
+	ChannelPulse2
+	ChannelTriangle
+	ChannelNoise
+	ChannelDMC
+	ChannelExpansion // first expansion audio channel, if any
+)
+
+var channelNames = []string{"pulse1", "pulse2", "triangle", "noise", "dmc"}
+
+// ExpansionAudio is implemented by mappers that have their own sound
+// hardware on the cartridge.
+type ExpansionAudio interface {
+	// ExpansionChannels returns the names of the expansion channels
+	ExpansionChannels() []string
+	// ExpansionOutput stores the current output of each expansion channel,
+	// in the same units as the mixed 2A03 output (roughly 0 to 1)
+	ExpansionOutput(output []float32)
+}
+
+// channelMix holds the user settings for one audio channel
+type channelMix struct {
+	volume float32
+	pan    float32 // -1: left; 0: center; 1: right
+	mute   bool
+	gain   [2]float32 // effective left/right gain
+}
+
+func (c *channelMix) update() {
+	c.gain[0], c.gain[1] = 0, 0
+	if c.mute {
+		return
+	}
+	c.gain[0] = c.volume
+	c.gain[1] = c.volume
+	if c.pan > 0 {
+		c.gain[0] *= 1 - c.pan
+	} else if c.pan < 0 {
+		c.gain[1] *= 1 + c.pan
+	}
+}
+
+// Mixer combines the APU channels, plus any expansion channels, into a
+// stereo signal using the non-linear 2A03 mixing formulas with a gain per
+// channel and side.
+type Mixer struct {
+	channels  []channelMix
+	expansion ExpansionAudio
+	expOutput []float32
+	levels    [5]byte
+	output    [2]float32
+	dirty     bool
+}
+
+func NewMixer(expansion ExpansionAudio) *Mixer {
+	n := ChannelExpansion
+	if expansion != nil {
+		n += len(expansion.ExpansionChannels())
+	}
+	m := Mixer{expansion: expansion}
+	m.channels = make([]channelMix, n)
+	m.expOutput = make([]float32, n-ChannelExpansion)
+	for i := range m.channels {
+		m.channels[i].volume = 1
+		m.channels[i].update()
+	}
+	m.dirty = true
+	return &m
+}
+
+// ChannelNames returns the name of each channel, indexed by channel number
+func (m *Mixer) ChannelNames() []string {
+	names := append([]string(nil), channelNames...)
+	if m.expansion != nil {
+		names = append(names, m.expansion.ExpansionChannels()...)
+	}
+	return names
+}
+
+func (m *Mixer) SetVolume(channel int, volume float32) {
+	if channel < 0 || channel >= len(m.channels) {
+		return
+	}
+	m.channels[channel].volume = volume
+	m.channels[channel].update()
+	m.dirty = true
+}
+
+func (m *Mixer) SetPan(channel int, pan float32) {
+	if channel < 0 || channel >= len(m.channels) {
+		return
+	}
+	if pan < -1 {
+		pan = -1
+	}
+	if pan > 1 {
+		pan = 1
+	}
+	m.channels[channel].pan = pan
+	m.channels[channel].update()
+	m.dirty = true
+}
+
+func (m *Mixer) SetMute(channel int, mute bool) {
+	if channel < 0 || channel >= len(m.channels) {
+		return
+	}
+	m.channels[channel].mute = mute
+	m.channels[channel].update()
+	m.dirty = true
+}
+
+// changed reports whether the output for the given channel levels may differ
+// from the last mix. Expansion audio is not tracked, so it always may.
+func (m *Mixer) changed(levels [5]byte) bool {
+	return m.expansion != nil || m.dirty || levels != m.levels
+}
+
+// mix returns the left and right output for the given channel levels. The
+// result is cached until the levels or settings change.
+func (m *Mixer) mix(levels [5]byte) (float32, float32) {
+	if !m.changed(levels) {
+		return m.output[0], m.output[1]
+	}
+	m.levels = levels
+	m.dirty = false
+	if m.expansion != nil {
+		m.expansion.ExpansionOutput(m.expOutput)
+	}
+	c := m.channels
+	for side := 0; side < 2; side++ {
+		var out float32
+		pulse := float32(levels[0])*c[0].gain[side] +
+			float32(levels[1])*c[1].gain[side]
+		if pulse > 0 {
+			out += 95.52 / (8128/pulse + 100)
+		}
+		tnd := 3*float32(levels[2])*c[2].gain[side] +
+			2*float32(levels[3])*c[3].gain[side] +
+			float32(levels[4])*c[4].gain[side]
+		if tnd > 0 {
+			out += 163.67 / (24329/tnd + 100)
+		}
+		for i, x := range m.expOutput {
+			out += x * c[ChannelExpansion+i].gain[side]
+		}
+		m.output[side] = out
+	}
+	return m.output[0], m.output[1]
+}
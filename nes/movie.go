@@ -0,0 +1,309 @@
+package nes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// movie frame commands, as in FM2 files
+const (
+	MovieReset = 1 // soft reset at the start of the frame
+	MoviePower = 2 // power cycle at the start of the frame
+)
+
+// MovieFrame is the input for one frame. Bit i of each port's byte is
+// button i, starting with ButtonA.
+type MovieFrame struct {
+	Commands byte
+	Buttons  [2]byte
+}
+
+// Movie is a recording of the controller input of both ports, frame by
+// frame. Frames begin when the PPU enters vertical blank; the first frame
+// starts where the recording started.
+type Movie struct {
+	ROMHash   string // hex MD5 of the ROM, if known
+	State     []byte // save state the movie starts from; nil for power-on
+	Rerecords int
+	Comments  []string
+	Frames    []MovieFrame
+}
+
+// moviePlayer records or plays a movie on a console
+type moviePlayer struct {
+	movie     *Movie
+	recording bool
+	frame     int        // index of the frame being emulated
+	input     [2][8]bool // input for the next frame while recording
+	commands  byte       // commands for the next frame while recording
+	boundary  bool       // a frame ended; advance before the next step
+}
+
+func packButtons(buttons [8]bool) byte {
+	var b byte
+	for i, pressed := range buttons {
+		if pressed {
+			b |= 1 << uint(i)
+		}
+	}
+	return b
+}
+
+func unpackButtons(b byte) [8]bool {
+	var buttons [8]bool
+	for i := range buttons {
+		buttons[i] = b>>uint(i)&1 == 1
+	}
+	return buttons
+}
+
+// PowerCycle returns the console to its power-on state. Save RAM and CHR
+// RAM are cleared.
+func (console *Console) PowerCycle() error {
+	cartridge := *console.Cartridge
+	cartridge.SRAM = make([]byte, len(cartridge.SRAM))
+	if cartridge.CHRRAM {
+		cartridge.CHR = make([]byte, len(cartridge.CHR))
+	}
+	fresh, err := newConsole(&cartridge)
+	if err != nil {
+		return err
+	}
+	fresh.Reset()
+	var buf bytes.Buffer
+	if err := fresh.Save(gob.NewEncoder(&buf)); err != nil {
+		return err
+	}
+	return console.load(gob.NewDecoder(&buf))
+}
+
+// RecordMovie starts recording input into m, replacing its frames. The
+// movie starts at power-on if powerOn is set and from the current state
+// otherwise. While recording, SetButtons1, SetButtons2 and Reset take effect
+// at the start of the next frame.
+func (console *Console) RecordMovie(m *Movie, powerOn bool) error {
+	console.movie = nil
+	if powerOn {
+		if err := console.PowerCycle(); err != nil {
+			return err
+		}
+		m.State = nil
+	} else {
+		var buf bytes.Buffer
+		if err := console.Save(gob.NewEncoder(&buf)); err != nil {
+			return err
+		}
+		m.State = buf.Bytes()
+	}
+	p := moviePlayer{movie: m, recording: true}
+	p.input[0] = console.Controller1.Buttons()
+	p.input[1] = console.Controller2.Buttons()
+	m.Frames = []MovieFrame{{
+		Buttons: [2]byte{packButtons(p.input[0]), packButtons(p.input[1])}}}
+	console.movie = &p
+	return nil
+}
+
+// PlayMovie restores the movie's starting state and plays it back. Input
+// from SetButtons1, SetButtons2 and Reset is ignored until the movie ends.
+func (console *Console) PlayMovie(m *Movie) error {
+	if len(m.Frames) == 0 {
+		// don't throw away the console state for nothing
+		return errors.New("movie has no frames")
+	}
+	console.movie = nil
+	if m.State != nil {
+		if err := console.load(gob.NewDecoder(bytes.NewReader(m.State))); err != nil {
+			return err
+		}
+	} else if err := console.PowerCycle(); err != nil {
+		return err
+	}
+	p := moviePlayer{movie: m}
+	console.movie = &p
+	p.apply(console, m.Frames[0])
+	return nil
+}
+
+// StopMovie ends recording or playback.
+func (console *Console) StopMovie() {
+	console.movie = nil
+}
+
+// Movie returns the movie being recorded or played, or nil, and whether it
+// is being recorded.
+func (console *Console) Movie() (m *Movie, recording bool) {
+	if console.movie == nil {
+		return nil, false
+	}
+	return console.movie.movie, console.movie.recording
+}
+
+// MovieFrame returns the index of the movie frame being emulated.
+func (console *Console) MovieFrame() int {
+	if console.movie == nil {
+		return 0
+	}
+	return console.movie.frame
+}
+
+// advance moves to the next movie frame
+func (p *moviePlayer) advance(console *Console) {
+	p.boundary = false
+	p.frame++
+	m := p.movie
+	if p.recording {
+		f := MovieFrame{p.commands,
+			[2]byte{packButtons(p.input[0]), packButtons(p.input[1])}}
+		p.commands = 0
+		m.Frames = append(m.Frames, f)
+		p.apply(console, f)
+		return
+	}
+	if p.frame >= len(m.Frames) {
+		console.movie = nil
+		return
+	}
+	p.apply(console, m.Frames[p.frame])
+}
+
+func (p *moviePlayer) apply(console *Console, f MovieFrame) {
+	if f.Commands&MoviePower != 0 {
+		console.PowerCycle()
+	} else if f.Commands&MovieReset != 0 {
+		console.CPU.Reset()
+	}
+	console.Controller1.SetButtons(unpackButtons(f.Buttons[0]))
+	console.Controller2.SetButtons(unpackButtons(f.Buttons[1]))
+}
+
+// native movie format: magic, version, rerecords, ROM hash, state, comments
+// and frames, with runs of identical frames stored once
+const movieMagic = "NESM"
+
+var errMovieFormat = errors.New("invalid movie file")
+
+// WriteTo writes the movie in the native binary format.
+func (m *Movie) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	varint := func(x uint64) {
+		var b [binary.MaxVarintLen64]byte
+		buf.Write(b[:binary.PutUvarint(b[:], x)])
+	}
+	buf.WriteString(movieMagic)
+	buf.WriteByte(1)
+	hash, _ := hex.DecodeString(m.ROMHash)
+	varint(uint64(m.Rerecords))
+	varint(uint64(len(hash)))
+	buf.Write(hash)
+	varint(uint64(len(m.State)))
+	buf.Write(m.State)
+	comments := strings.Join(m.Comments, "\n")
+	varint(uint64(len(comments)))
+	buf.WriteString(comments)
+	varint(uint64(len(m.Frames)))
+	for i := 0; i < len(m.Frames); {
+		j := i + 1
+		for j < len(m.Frames) && m.Frames[j] == m.Frames[i] {
+			j++
+		}
+		varint(uint64(j - i))
+		f := m.Frames[i]
+		buf.Write([]byte{f.Commands, f.Buttons[0], f.Buttons[1]})
+		i = j
+	}
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// ReadMovie reads a movie in the native binary format or FM2.
+func ReadMovie(r io.Reader) (*Movie, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(movieMagic))
+	if err != nil || string(magic) != movieMagic {
+		return ReadFM2(br)
+	}
+	br.Discard(len(movieMagic))
+	if version, err := br.ReadByte(); err != nil || version != 1 {
+		return nil, errMovieFormat
+	}
+	var readErr error
+	varint := func() int {
+		x, err := binary.ReadUvarint(br)
+		if err != nil || x > 1<<30 {
+			readErr = errMovieFormat
+			return 0
+		}
+		return int(x)
+	}
+	readBytes := func(n int) []byte {
+		if readErr != nil {
+			return nil
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(br, b); err != nil {
+			readErr = errMovieFormat
+		}
+		return b
+	}
+	m := Movie{}
+	m.Rerecords = varint()
+	m.ROMHash = hex.EncodeToString(readBytes(varint()))
+	if state := readBytes(varint()); len(state) > 0 {
+		m.State = state
+	}
+	if comments := string(readBytes(varint())); comments != "" {
+		m.Comments = strings.Split(comments, "\n")
+	}
+	total := varint()
+	for len(m.Frames) < total && readErr == nil {
+		run := varint()
+		b := readBytes(3)
+		if readErr != nil || run == 0 || len(m.Frames)+run > total {
+			return nil, errMovieFormat
+		}
+		f := MovieFrame{b[0], [2]byte{b[1], b[2]}}
+		for i := 0; i < run; i++ {
+			m.Frames = append(m.Frames, f)
+		}
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	return &m, nil
+}
+
+// LoadMovieFile reads a movie file in either format.
+func LoadMovieFile(path string) (*Movie, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadMovie(file)
+}
+
+// SaveFile writes the movie to path, in FM2 format if the name ends in
+// .fm2 and in the native format otherwise.
+func (m *Movie) SaveFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(strings.ToLower(path), ".fm2") {
+		err = m.WriteFM2(file)
+	} else {
+		_, err = m.WriteTo(file)
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
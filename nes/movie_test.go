@@ -0,0 +1,181 @@
+package nes
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// joypadProgram reads controller 1 every iteration and accumulates the
+// result into $01
+var joypadProgram = []byte{
+	0xA9, 0x01, // 8000 LDA #$01
+	0x8D, 0x16, 0x40, // 8002 STA $4016
+	0xA9, 0x00, // 8005 LDA #$00
+	0x8D, 0x16, 0x40, // 8007 STA $4016
+	0xA2, 0x08, // 800A LDX #$08
+	0xAD, 0x16, 0x40, // 800C LDA $4016
+	0x4A,       // 800F LSR A
+	0x26, 0x00, // 8010 ROL $00
+	0xCA,       // 8012 DEX
+	0xD0, 0xF7, // 8013 BNE $800C
+	0xA5, 0x00, // 8015 LDA $00
+	0x18,       // 8017 CLC
+	0x65, 0x01, // 8018 ADC $01
+	0x85, 0x01, // 801A STA $01
+	0xE6, 0x02, // 801C INC $02
+	0x4C, 0x00, 0x80, // 801E JMP $8000
+}
+
+func movieInput(i int) [8]bool {
+	var buttons [8]bool
+	buttons[i%8] = true
+	buttons[(i/3)%8] = i%5 != 0
+	return buttons
+}
+
+func consoleState(console *Console) []byte {
+	cpu := console.CPU
+	state := append([]byte(nil), console.RAM...)
+	return append(state, cpu.A, cpu.X, cpu.Y, cpu.SP, byte(cpu.PC), byte(cpu.PC>>8))
+}
+
+func recordTestMovie(t *testing.T, console *Console, powerOn bool, frames int) (*Movie, []byte) {
+	m := &Movie{}
+	if err := console.RecordMovie(m, powerOn); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < frames; i++ {
+		console.SetButtons1(movieInput(i))
+		console.SetButtons2(movieInput(i + 3))
+		if i == 10 {
+			console.Reset()
+		}
+		console.StepFrame()
+	}
+	return m, consoleState(console)
+}
+
+func playTestMovie(t *testing.T, console *Console, m *Movie) []byte {
+	if err := console.PlayMovie(m); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(m.Frames); i++ {
+		console.SetButtons1([8]bool{true, true, true, true}) // ignored
+		console.StepFrame()
+	}
+	return consoleState(console)
+}
+
+func TestMoviePlayback(t *testing.T) {
+	console := newTestConsole(t, joypadProgram)
+	console.StepFrame()
+	m, want := recordTestMovie(t, console, true, 30)
+	// every frame, including the last, starts with a vertical blank
+	if len(m.Frames) != 31 || m.State != nil {
+		t.Fatalf("got %d frames, state %v", len(m.Frames), m.State != nil)
+	}
+	if m.Frames[11].Commands != MovieReset {
+		t.Errorf("reset not recorded: %+v", m.Frames[11])
+	}
+	if console.RAM[1] == 0 {
+		t.Fatal("input had no effect")
+	}
+	if got := playTestMovie(t, console, m); !bytes.Equal(got, want) {
+		t.Error("power-on playback diverged")
+	}
+	console.StepFrame()
+	if m, _ := console.Movie(); m != nil {
+		t.Error("movie still playing after its last frame")
+	}
+
+	// from a save state
+	m, want = recordTestMovie(t, console, false, 20)
+	console.StopMovie()
+	console.StepFrame()
+	if got := playTestMovie(t, console, m); !bytes.Equal(got, want) {
+		t.Error("save state playback diverged")
+	}
+}
+
+func TestMovieFormats(t *testing.T) {
+	console := newTestConsole(t, joypadProgram)
+	m, _ := recordTestMovie(t, console, true, 30)
+	m.ROMHash = "0123456789abcdef0123456789abcdef"
+	m.Rerecords = 7
+	m.Comments = []string{"author test"}
+
+	var native bytes.Buffer
+	if _, err := m.WriteTo(&native); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadMovie(&native)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("native round trip: got %+v", got)
+	}
+
+	var fm2 bytes.Buffer
+	if err := m.WriteFM2(&fm2); err != nil {
+		t.Fatal(err)
+	}
+	got, err = ReadMovie(&fm2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("fm2 round trip: got %+v", got)
+	}
+
+	m.State = []byte{1}
+	if err := m.WriteFM2(&fm2); err == nil {
+		t.Error("expected error exporting a movie with a save state")
+	}
+}
+
+func TestReadFM2(t *testing.T) {
+	src := `version 3
+romChecksum base64:ASNFZ4mrze8BI0VniavN7w==
+port0 1
+port1 1
+|0|........|........||
+|1|R......A|......B.||
+|0|RLDUTSBA|||
+`
+	m, err := ReadFM2(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.ROMHash != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("got hash %s", m.ROMHash)
+	}
+	want := []MovieFrame{
+		{0, [2]byte{0, 0}},
+		{MovieReset, [2]byte{1<<ButtonRight | 1<<ButtonA, 1 << ButtonB}},
+		{0, [2]byte{0xFF, 0}},
+	}
+	if !reflect.DeepEqual(m.Frames, want) {
+		t.Errorf("got %+v", m.Frames)
+	}
+	for _, src := range []string{
+		"version 3\nfourscore 1\n|0|........|||\n",
+		"|0|........|||\n",
+		"version 2\n|0|........|||\n",
+		"version 3\nport0 1\n",
+		"some text file\n",
+	} {
+		if _, err := ReadFM2(strings.NewReader(src)); err == nil {
+			t.Errorf("%q: expected an error", src)
+		}
+	}
+
+	console := newTestConsole(t, debuggerProgram)
+	console.StepFrame()
+	frame := console.PPU.Frame
+	if err := console.PlayMovie(&Movie{}); err == nil || console.PPU.Frame != frame {
+		t.Errorf("empty movie: %v, frame %d -> %d", err, frame, console.PPU.Frame)
+	}
+}
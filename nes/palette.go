@@ -1,8 +1,20 @@
 package nes
 
-import "image/color"
+import (
+	"fmt"
+	"image/color"
+	"io/ioutil"
+)
 
-var Palette [64]color.RGBA
+// Palette holds 512 colors: the 64 base colors for each of the 8
+// combinations of the PPUMASK emphasis bits. Entry i corresponds to
+// base color i%64 with emphasis bits i/64 (bit 0: red, 1: green, 2: blue).
+type Palette [512]color.RGBA
+
+// emphasisFactor is the attenuation applied to the non-emphasized channels
+const emphasisFactor = 0.816328
+
+var DefaultPalette *Palette
 
 func init() {
 	colors := []uint32{
@@ -15,10 +27,90 @@ func init() {
 		0xFFFEFF, 0xC0DFFF, 0xD3D2FF, 0xE8C8FF, 0xFBC2FF, 0xFEC4EA, 0xFECCC5, 0xF7D8A5,
 		0xE4E594, 0xCFEF96, 0xBDF4AB, 0xB3F3CC, 0xB5EBF2, 0xB8B8B8, 0x000000, 0x000000,
 	}
+	base := make([]color.RGBA, len(colors))
 	for i, c := range colors {
 		r := byte(c >> 16)
 		g := byte(c >> 8)
 		b := byte(c)
-		Palette[i] = color.RGBA{r, g, b, 0xFF}
+		base[i] = color.RGBA{r, g, b, 0xFF}
+	}
+	DefaultPalette, _ = NewPalette(base)
+}
+
+// NewPalette builds a palette from either 64 base colors, in which case the
+// emphasized colors are generated, or from all 512 colors.
+func NewPalette(colors []color.RGBA) (*Palette, error) {
+	palette := Palette{}
+	switch len(colors) {
+	case 512:
+		copy(palette[:], colors)
+	case 64:
+		for emphasis := 0; emphasis < 8; emphasis++ {
+			for i, c := range colors {
+				palette[emphasis*64+i] = emphasize(c, emphasis)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid palette size: %d colors", len(colors))
+	}
+	return &palette, nil
+}
+
+// emphasize attenuates the channels that are not emphasized by the given
+// PPUMASK emphasis bits
+func emphasize(c color.RGBA, emphasis int) color.RGBA {
+	if emphasis == 0 {
+		return c
+	}
+	r, g, b := float64(c.R), float64(c.G), float64(c.B)
+	if emphasis&1 == 1 {
+		g *= emphasisFactor
+		b *= emphasisFactor
+	}
+	if emphasis&2 == 2 {
+		r *= emphasisFactor
+		b *= emphasisFactor
+	}
+	if emphasis&4 == 4 {
+		r *= emphasisFactor
+		g *= emphasisFactor
+	}
+	return color.RGBA{byte(r), byte(g), byte(b), 0xFF}
+}
+
+// ParsePalette decodes the contents of a .pal file: raw RGB triplets for
+// either 64 or 512 colors.
+func ParsePalette(data []byte) (*Palette, error) {
+	if len(data) != 64*3 && len(data) != 512*3 {
+		return nil, fmt.Errorf("invalid .pal file size: %d", len(data))
+	}
+	colors := make([]color.RGBA, len(data)/3)
+	for i := range colors {
+		colors[i] = color.RGBA{data[i*3], data[i*3+1], data[i*3+2], 0xFF}
+	}
+	return NewPalette(colors)
+}
+
+// LoadPaletteFile reads a .pal file and returns a Palette on success.
+func LoadPaletteFile(path string) (*Palette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePalette(data)
+}
+
+// Lookup returns the color for a palette RAM value combined with the
+// current PPUMASK grayscale and emphasis bits.
+func (palette *Palette) Lookup(value byte, grayscale bool, emphasis byte) color.RGBA {
+	return palette[paletteIndex(value, grayscale, emphasis)]
+}
+
+// paletteIndex returns the index into a Palette for a palette RAM value
+func paletteIndex(value byte, grayscale bool, emphasis byte) uint16 {
+	index := uint16(value % 64)
+	if grayscale {
+		index &= 0x30
 	}
+	return index | uint16(emphasis&7)<<6
 }
@@ -0,0 +1,78 @@
+package nes
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestNewPalette(t *testing.T) {
+	for _, n := range []int{0, 1, 63, 65, 511, 513} {
+		if _, err := NewPalette(make([]color.RGBA, n)); err == nil {
+			t.Errorf("%d colors: expected an error", n)
+		}
+	}
+	colors := make([]color.RGBA, 512)
+	for i := range colors {
+		colors[i] = color.RGBA{byte(i), byte(i >> 8), 0, 0xFF}
+	}
+	palette, err := NewPalette(colors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range colors {
+		if palette[i] != c {
+			t.Fatalf("color %d: got %v, want %v", i, palette[i], c)
+		}
+	}
+}
+
+func TestPaletteEmphasis(t *testing.T) {
+	base := make([]color.RGBA, 64)
+	for i := range base {
+		base[i] = color.RGBA{200, 100, 50, 0xFF}
+	}
+	palette, err := NewPalette(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		emphasis byte
+		want     color.RGBA
+	}{
+		{0, color.RGBA{200, 100, 50, 0xFF}},
+		{1, color.RGBA{200, 81, 40, 0xFF}},  // red
+		{2, color.RGBA{163, 100, 40, 0xFF}}, // green
+		{4, color.RGBA{163, 81, 50, 0xFF}},  // blue
+		{7, color.RGBA{133, 66, 33, 0xFF}},
+	}
+	for _, test := range tests {
+		if got := palette.Lookup(0x21, false, test.emphasis); got != test.want {
+			t.Errorf("emphasis %d: got %v, want %v", test.emphasis, got, test.want)
+		}
+	}
+}
+
+func TestPaletteIndex(t *testing.T) {
+	tests := []struct {
+		value     byte
+		grayscale bool
+		emphasis  byte
+		want      uint16
+	}{
+		{0x16, false, 0, 0x16},
+		{0x16, true, 0, 0x10},
+		{0x3D, true, 0, 0x30},
+		{0x56, false, 0, 0x16}, // palette RAM values are 6 bits
+		{0x16, true, 5, 0x10 | 5<<6},
+	}
+	for _, test := range tests {
+		got := paletteIndex(test.value, test.grayscale, test.emphasis)
+		if got != test.want {
+			t.Errorf("%+v: got $%03X", test, got)
+		}
+		c := DefaultPalette.Lookup(test.value, test.grayscale, test.emphasis)
+		if c != DefaultPalette[got] {
+			t.Errorf("%+v: Lookup disagrees with paletteIndex", test)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path"
+	"strings"
+)
+
+// PatchExtensions are the file extensions of the supported patch formats.
+var PatchExtensions = []string{".ips", ".bps", ".ups"}
+
+var errPatchFormat = errors.New("invalid patch")
+
+// ApplyPatch applies an IPS, BPS or UPS patch to a ROM image, header
+// included, and returns the patched image. BPS and UPS checksums are
+// verified; patches made for the ROM without its iNES header are accepted
+// too.
+func ApplyPatch(rom, patch []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(patch, []byte("PATCH")):
+		return applyIPS(rom, patch)
+	case bytes.HasPrefix(patch, []byte("BPS1")):
+		return applyChecked(rom, patch, applyBPS)
+	case bytes.HasPrefix(patch, []byte("UPS1")):
+		return applyChecked(rom, patch, applyUPS)
+	}
+	return nil, errors.New("unknown patch format")
+}
+
+// FindPatch returns the path of a patch next to a ROM with the same name,
+// such as game.ips or game.nes.ips for game.nes, or "" if there is none.
+func FindPatch(romPath string) string {
+	base := strings.TrimSuffix(romPath, path.Ext(romPath))
+	for _, name := range []string{base, romPath} {
+		for _, ext := range PatchExtensions {
+			if _, err := os.Stat(name + ext); err == nil {
+				return name + ext
+			}
+		}
+	}
+	return ""
+}
+
+// LoadPatchedROM reads a ROM file, unpacking archives, and applies the
+// patch at patchPath or, if patchPath is "", the one found by FindPatch.
+// It returns the image and the patch applied, if any. If the patch cannot
+// be read or applied, the unpatched image is returned along with the error.
+func LoadPatchedROM(romPath, patchPath string) ([]byte, string, error) {
+	file, err := os.Open(romPath)
+	if err != nil {
+		return nil, "", err
+	}
+	rom, err := ReadROM(file)
+	file.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	if patchPath == "" {
+		if patchPath = FindPatch(romPath); patchPath == "" {
+			return rom, "", nil
+		}
+	}
+	patch, err := readFile(patchPath)
+	if err != nil {
+		return rom, "", err
+	}
+	patched, err := ApplyPatch(rom, patch)
+	if err != nil {
+		return rom, "", fmt.Errorf("%s: %v", patchPath, err)
+	}
+	return patched, patchPath, nil
+}
+
+func readFile(name string) ([]byte, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readLimited(file)
+}
+
+// applyIPS applies an IPS patch: records of a 24-bit offset and a 16-bit
+// size followed by the data, or by a 16-bit count and a byte when the size
+// is zero, then "EOF" and an optional 24-bit length to truncate to
+func applyIPS(rom, patch []byte) ([]byte, error) {
+	out := append([]byte(nil), rom...)
+	p := patch[5:]
+	for {
+		if len(p) < 3 {
+			return nil, errPatchFormat
+		}
+		if string(p[:3]) == "EOF" {
+			if len(p) >= 6 {
+				size := int(p[3])<<16 | int(p[4])<<8 | int(p[5])
+				if size < len(out) {
+					out = out[:size]
+				}
+			}
+			return out, nil
+		}
+		if len(p) < 5 {
+			return nil, errPatchFormat
+		}
+		offset := int(p[0])<<16 | int(p[1])<<8 | int(p[2])
+		size := int(p[3])<<8 | int(p[4])
+		p = p[5:]
+		var data []byte
+		if size == 0 {
+			if len(p) < 3 {
+				return nil, errPatchFormat
+			}
+			data = bytes.Repeat(p[2:3], int(p[0])<<8|int(p[1]))
+			p = p[3:]
+		} else {
+			if len(p) < size {
+				return nil, errPatchFormat
+			}
+			data = p[:size]
+			p = p[size:]
+		}
+		if end := offset + len(data); end > len(out) {
+			out = append(out, make([]byte, end-len(out))...)
+		}
+		copy(out[offset:], data)
+	}
+}
+
+// applyChecked verifies the source, target and patch CRC32s that end BPS
+// and UPS patches around apply. If the source doesn't match, the ROM
+// without its header is tried.
+func applyChecked(rom, patch []byte, apply func(source, patch []byte) ([]byte, error)) ([]byte, error) {
+	if len(patch) < 16 {
+		return nil, errPatchFormat
+	}
+	footer := patch[len(patch)-12:]
+	sourceCRC := binary.LittleEndian.Uint32(footer[0:])
+	targetCRC := binary.LittleEndian.Uint32(footer[4:])
+	if crc32.ChecksumIEEE(patch[:len(patch)-4]) != binary.LittleEndian.Uint32(footer[8:]) {
+		return nil, errors.New("patch checksum mismatch")
+	}
+	var header []byte
+	if crc32.ChecksumIEEE(rom) != sourceCRC {
+		if !isINES(rom) || len(rom) < 16 || crc32.ChecksumIEEE(rom[16:]) != sourceCRC {
+			return nil, errors.New("patch is for a different rom")
+		}
+		header, rom = rom[:16], rom[16:]
+	}
+	out, err := apply(rom, patch[4:len(patch)-12])
+	if err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(out) != targetCRC {
+		return nil, errors.New("patched rom checksum mismatch")
+	}
+	if header != nil {
+		out = append(append([]byte(nil), header...), out...)
+	}
+	return out, nil
+}
+
+// patchReader reads the variable-length integers used by BPS and UPS
+type patchReader struct {
+	data []byte
+	err  error
+}
+
+func (r *patchReader) byte() byte {
+	if len(r.data) == 0 {
+		r.err = errPatchFormat
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *patchReader) number() int {
+	n, shift := 0, 1
+	for r.err == nil {
+		b := r.byte()
+		n += int(b&0x7F) * shift
+		if b&0x80 != 0 || shift > 1<<35 {
+			break
+		}
+		shift <<= 7
+		n += shift
+	}
+	// sizes, offsets and actions are all well below this
+	if n > 8*maxROMSize {
+		r.err = errPatchFormat
+	}
+	return n
+}
+
+func (r *patchReader) bytes(n int) []byte {
+	if n > len(r.data) {
+		r.err = errPatchFormat
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+// applyUPS applies the body of a UPS patch: runs of bytes to XOR with the
+// source, each after a number of bytes to copy and ending with a zero
+func applyUPS(source, patch []byte) ([]byte, error) {
+	r := &patchReader{data: patch}
+	if r.number() != len(source) {
+		return nil, errors.New("patch is for a different rom")
+	}
+	out := make([]byte, r.number())
+	copy(out, source)
+	for i := 0; len(r.data) > 0 && r.err == nil; i++ {
+		i += r.number()
+		for ; r.err == nil; i++ {
+			x := r.byte()
+			if x == 0 {
+				break
+			}
+			if i < len(out) {
+				out[i] ^= x
+			}
+		}
+	}
+	return out, r.err
+}
+
+// BPS actions
+const (
+	bpsSourceRead = iota
+	bpsTargetRead
+	bpsSourceCopy
+	bpsTargetCopy
+)
+
+// applyBPS applies the body of a BPS patch: actions copying from the
+// source or target, at the same or a relative offset, or from the patch
+func applyBPS(source, patch []byte) ([]byte, error) {
+	r := &patchReader{data: patch}
+	if r.number() != len(source) {
+		return nil, errors.New("patch is for a different rom")
+	}
+	out := make([]byte, 0, r.number())
+	r.bytes(r.number()) // metadata
+	sourceOffset, targetOffset := 0, 0
+	relative := func(offset int) int {
+		n := r.number()
+		if n&1 != 0 {
+			return offset - n>>1
+		}
+		return offset + n>>1
+	}
+	for len(r.data) > 0 && r.err == nil {
+		n := r.number()
+		length := n>>2 + 1
+		if len(out)+length > cap(out) {
+			return nil, errPatchFormat
+		}
+		switch n & 3 {
+		case bpsSourceRead:
+			if len(out)+length > len(source) {
+				return nil, errPatchFormat
+			}
+			out = append(out, source[len(out):len(out)+length]...)
+		case bpsTargetRead:
+			out = append(out, r.bytes(length)...)
+		case bpsSourceCopy:
+			sourceOffset = relative(sourceOffset)
+			if sourceOffset < 0 || sourceOffset+length > len(source) {
+				return nil, errPatchFormat
+			}
+			out = append(out, source[sourceOffset:sourceOffset+length]...)
+			sourceOffset += length
+		case bpsTargetCopy:
+			targetOffset = relative(targetOffset)
+			if targetOffset < 0 || targetOffset >= len(out) {
+				return nil, errPatchFormat
+			}
+			// the copy may overlap what it writes
+			for i := 0; i < length; i++ {
+				out = append(out, out[targetOffset])
+				targetOffset++
+			}
+		}
+	}
+	if r.err == nil && len(out) != cap(out) {
+		return nil, errPatchFormat
+	}
+	return out, r.err
+}
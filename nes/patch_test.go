@@ -0,0 +1,171 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fogleman/nes/internal/testrom"
+)
+
+// patchNumber encodes a BPS/UPS variable-length integer
+func patchNumber(n int) []byte {
+	var b []byte
+	for {
+		x := byte(n & 0x7F)
+		n >>= 7
+		if n == 0 {
+			return append(b, x|0x80)
+		}
+		b = append(b, x)
+		n--
+	}
+}
+
+// patchFooter appends the source, target and patch CRC32s
+func patchFooter(patch, source, target []byte) []byte {
+	var crc [4]byte
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(source))
+	patch = append(patch, crc[:]...)
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(target))
+	patch = append(patch, crc[:]...)
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(patch))
+	return append(patch, crc[:]...)
+}
+
+// upsPatch makes a UPS patch from source to target
+func upsPatch(source, target []byte) []byte {
+	p := append([]byte("UPS1"), patchNumber(len(source))...)
+	p = append(p, patchNumber(len(target))...)
+	last := 0
+	for i := 0; i < len(target); i++ {
+		var s byte
+		if i < len(source) {
+			s = source[i]
+		}
+		if s == target[i] {
+			continue
+		}
+		p = append(p, patchNumber(i-last)...)
+		for ; i < len(target); i++ {
+			s = 0
+			if i < len(source) {
+				s = source[i]
+			}
+			if s == target[i] {
+				break
+			}
+			p = append(p, s^target[i])
+		}
+		p = append(p, 0)
+		last = i + 1
+	}
+	return patchFooter(p, source, target)
+}
+
+func bpsAction(action, length int) []byte {
+	return patchNumber((length-1)<<2 | action)
+}
+
+func bpsOffset(delta int) []byte {
+	if delta < 0 {
+		return patchNumber(-delta<<1 | 1)
+	}
+	return patchNumber(delta << 1)
+}
+
+func TestApplyPatch(t *testing.T) {
+	rom := testrom.NROM(debuggerProgram)
+	target := append([]byte(nil), rom...)
+	copy(target[0x20:], "HELLO")
+	target[0x1000] = 0xEA
+	target = append(target, 1, 2, 3, 1, 2, 3, 1)
+
+	ips := []byte("PATCH")
+	ips = append(ips, 0, 0, 0x20, 0, 5)
+	ips = append(ips, "HELLO"...)
+	ips = append(ips, 0, 0x10, 0x00, 0, 0, 0, 1, 0xEA) // RLE
+	ips = append(ips, byte(len(rom)>>16), byte(len(rom)>>8), byte(len(rom)), 0, 7, 1, 2, 3, 1, 2, 3, 1)
+	ips = append(ips, "EOF"...)
+
+	// copy the header and program, insert HELLO, copy up to the NOP, write
+	// it, copy the rest and repeat 1, 2, 3 from the target
+	bps := append([]byte("BPS1"), patchNumber(len(rom))...)
+	bps = append(bps, patchNumber(len(target))...)
+	bps = append(bps, patchNumber(0)...)
+	bps = append(bps, bpsAction(bpsSourceRead, 0x20)...)
+	bps = append(bps, bpsAction(bpsTargetRead, 5)...)
+	bps = append(bps, "HELLO"...)
+	bps = append(bps, bpsAction(bpsSourceCopy, 0x1000-0x25)...)
+	bps = append(bps, bpsOffset(0x25)...)
+	bps = append(bps, bpsAction(bpsTargetRead, 1)...)
+	bps = append(bps, 0xEA)
+	bps = append(bps, bpsAction(bpsSourceRead, len(rom)-0x1001)...)
+	bps = append(bps, bpsAction(bpsTargetRead, 3)...)
+	bps = append(bps, 1, 2, 3)
+	bps = append(bps, bpsAction(bpsTargetCopy, 4)...)
+	bps = append(bps, bpsOffset(len(rom))...)
+	bps = patchFooter(bps, rom, target)
+
+	// a patch for the rom without its header
+	headerless := upsPatch(rom[16:], target[16:])
+
+	for name, patch := range map[string][]byte{
+		"ips": ips, "bps": bps, "ups": upsPatch(rom, target), "headerless": headerless,
+	} {
+		got, err := ApplyPatch(rom, patch)
+		if err != nil || !bytes.Equal(got, target) {
+			t.Errorf("%s: got %d bytes, %v", name, len(got), err)
+		}
+	}
+
+	other := append([]byte(nil), rom...)
+	other[0x100]++
+	if _, err := ApplyPatch(other, bps); err == nil {
+		t.Error("applied a bps patch to the wrong rom")
+	}
+	bps[10]++
+	if _, err := ApplyPatch(rom, bps); err == nil {
+		t.Error("applied a corrupt bps patch")
+	}
+	if _, err := ApplyPatch(rom, []byte("PATCH\x00")); err == nil {
+		t.Error("applied a truncated ips patch")
+	}
+}
+
+func TestLoadPatchedROM(t *testing.T) {
+	dir, err := ioutil.TempDir("", "patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rom := testrom.NROM(debuggerProgram)
+	romPath := filepath.Join(dir, "game.nes")
+	ioutil.WriteFile(romPath, rom, 0644)
+
+	got, applied, err := LoadPatchedROM(romPath, "")
+	if err != nil || applied != "" || !bytes.Equal(got, rom) {
+		t.Fatalf("unpatched: %q, %v", applied, err)
+	}
+	ips := []byte("PATCH\x00\x00\x10\x00\x01\xFFEOF")
+	patchPath := filepath.Join(dir, "game.ips")
+	ioutil.WriteFile(patchPath, ips, 0644)
+	got, applied, err = LoadPatchedROM(romPath, "")
+	if err != nil || applied != patchPath || got[0x10] != 0xFF {
+		t.Fatalf("patched: %q, %v", applied, err)
+	}
+	if _, err := NewConsoleFromBytes(got); err != nil {
+		t.Fatal(err)
+	}
+
+	// a bad patch still returns the rom
+	ioutil.WriteFile(patchPath, []byte("PATCH\x00"), 0644)
+	got, applied, err = LoadPatchedROM(romPath, "")
+	if err == nil || applied != "" || !bytes.Equal(got, rom) {
+		t.Errorf("bad patch: %q, %v", applied, err)
+	}
+}
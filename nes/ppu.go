@@ -6,8 +6,9 @@ import (
 )
 
 type PPU struct {
-	Memory           // memory interface
-	console *Console // reference to parent object
+	Memory             // memory interface
+	memory  *ppuMemory // the same, called directly on the hot path
+	console *Console   // reference to parent object
 
 	Cycle    int    // 0-340
 	ScanLine int    // 0-261, 0-239=visible, 240=post, 241-260=vblank, 261=pre
@@ -19,6 +20,8 @@ type PPU struct {
 	oamData       [256]byte
 	front         *image.RGBA
 	back          *image.RGBA
+	frontIndex    *IndexedImage
+	backIndex     *IndexedImage
 
 	// PPU registers
 	v uint16 // current vram address (15 bit)
@@ -78,10 +81,21 @@ type PPU struct {
 	bufferedData byte // for buffered reads
 }
 
+func (ppu *PPU) Read(address uint16) byte {
+	return ppu.memory.Read(address)
+}
+
+func (ppu *PPU) Write(address uint16, value byte) {
+	ppu.memory.Write(address, value)
+}
+
 func NewPPU(console *Console) *PPU {
-	ppu := PPU{Memory: NewPPUMemory(console), console: console}
+	memory := &ppuMemory{console}
+	ppu := PPU{Memory: memory, memory: memory, console: console}
 	ppu.front = image.NewRGBA(image.Rect(0, 0, 256, 240))
 	ppu.back = image.NewRGBA(image.Rect(0, 0, 256, 240))
+	ppu.frontIndex = NewIndexedImage(image.Rect(0, 0, 256, 240))
+	ppu.backIndex = NewIndexedImage(image.Rect(0, 0, 256, 240))
 	ppu.Reset()
 	return &ppu
 }
@@ -265,6 +279,12 @@ func (ppu *PPU) writeMask(value byte) {
 	ppu.flagBlueTint = (value >> 7) & 1
 }
 
+// emphasis returns the PPUMASK color emphasis bits (bit 0: red, 1: green,
+// 2: blue)
+func (ppu *PPU) emphasis() byte {
+	return ppu.flagRedTint | ppu.flagGreenTint<<1 | ppu.flagBlueTint<<2
+}
+
 // $2002: PPUSTATUS
 func (ppu *PPU) readStatus() byte {
 	result := ppu.register & 0x1F
@@ -339,6 +359,9 @@ func (ppu *PPU) writeAddress(value byte) {
 // $2007: PPUDATA (read)
 func (ppu *PPU) readData() byte {
 	value := ppu.Read(ppu.v)
+	if ppu.console.cdl != nil && ppu.v%0x4000 < 0x2000 {
+		ppu.console.cdl.logCHR(ppu.v%0x4000, CDLRead)
+	}
 	// emulate buffered reads
 	if ppu.v%0x4000 < 0x3F00 {
 		buffered := ppu.bufferedData
@@ -449,8 +472,10 @@ func (ppu *PPU) nmiChange() {
 
 func (ppu *PPU) setVerticalBlank() {
 	ppu.front, ppu.back = ppu.back, ppu.front
+	ppu.frontIndex, ppu.backIndex = ppu.backIndex, ppu.frontIndex
 	ppu.nmiOccurred = true
 	ppu.nmiChange()
+	ppu.console.endFrame()
 }
 
 func (ppu *PPU) clearVerticalBlank() {
@@ -477,6 +502,9 @@ func (ppu *PPU) fetchLowTileByte() {
 	tile := ppu.nameTableByte
 	address := 0x1000*uint16(table) + uint16(tile)*16 + fineY
 	ppu.lowTileByte = ppu.Read(address)
+	if ppu.console.cdl != nil {
+		ppu.console.cdl.logCHR(address, CDLDrawn)
+	}
 }
 
 func (ppu *PPU) fetchHighTileByte() {
@@ -485,6 +513,9 @@ func (ppu *PPU) fetchHighTileByte() {
 	tile := ppu.nameTableByte
 	address := 0x1000*uint16(table) + uint16(tile)*16 + fineY
 	ppu.highTileByte = ppu.Read(address + 8)
+	if ppu.console.cdl != nil {
+		ppu.console.cdl.logCHR(address+8, CDLDrawn)
+	}
 }
 
 func (ppu *PPU) storeTileData() {
@@ -562,8 +593,13 @@ func (ppu *PPU) renderPixel() {
 			color = background
 		}
 	}
-	c := Palette[ppu.readPalette(uint16(color))%64]
-	ppu.back.SetRGBA(x, y, c)
+	index := paletteIndex(
+		ppu.readPalette(uint16(color)), ppu.flagGrayscale == 1, ppu.emphasis())
+	c := ppu.console.Palette[index]
+	offset := y*ppu.back.Stride + x*4
+	pix := ppu.back.Pix[offset : offset+4 : offset+4]
+	pix[0], pix[1], pix[2], pix[3] = c.R, c.G, c.B, c.A
+	ppu.backIndex.Pix[y*256+x] = index
 }
 
 func (ppu *PPU) fetchSpritePattern(i, row int) uint32 {
@@ -591,6 +627,10 @@ func (ppu *PPU) fetchSpritePattern(i, row int) uint32 {
 	a := (attributes & 3) << 2
 	lowTileByte := ppu.Read(address)
 	highTileByte := ppu.Read(address + 8)
+	if ppu.console.cdl != nil {
+		ppu.console.cdl.logCHR(address, CDLDrawn)
+		ppu.console.cdl.logCHR(address+8, CDLDrawn)
+	}
 	var data uint32
 	for i := 0; i < 8; i++ {
 		var p1, p2 byte
@@ -672,71 +712,66 @@ func (ppu *PPU) tick() {
 	}
 }
 
-// Step executes a single PPU cycle
-func (ppu *PPU) Step() {
-	ppu.tick()
-
-	renderingEnabled := ppu.flagShowBackground != 0 || ppu.flagShowSprites != 0
+// render runs the background and sprite logic for one cycle while
+// rendering is enabled
+func (ppu *PPU) render() {
+	cycle := ppu.Cycle
 	preLine := ppu.ScanLine == 261
 	visibleLine := ppu.ScanLine < 240
-	// postLine := ppu.ScanLine == 240
-	renderLine := preLine || visibleLine
-	preFetchCycle := ppu.Cycle >= 321 && ppu.Cycle <= 336
-	visibleCycle := ppu.Cycle >= 1 && ppu.Cycle <= 256
-	fetchCycle := preFetchCycle || visibleCycle
-
-	// background logic
-	if renderingEnabled {
-		if visibleLine && visibleCycle {
-			ppu.renderPixel()
-		}
-		if renderLine && fetchCycle {
-			ppu.tileData <<= 4
-			switch ppu.Cycle % 8 {
-			case 1:
-				ppu.fetchNameTableByte()
-			case 3:
-				ppu.fetchAttributeTableByte()
-			case 5:
-				ppu.fetchLowTileByte()
-			case 7:
-				ppu.fetchHighTileByte()
-			case 0:
-				ppu.storeTileData()
-			}
+	if !preLine && !visibleLine {
+		if cycle == 257 {
+			ppu.spriteCount = 0
 		}
-		if preLine && ppu.Cycle >= 280 && ppu.Cycle <= 304 {
-			ppu.copyY()
+		return
+	}
+	visibleCycle := cycle >= 1 && cycle <= 256
+	if visibleLine && visibleCycle {
+		ppu.renderPixel()
+	}
+	if visibleCycle || cycle >= 321 && cycle <= 336 {
+		ppu.tileData <<= 4
+		switch cycle % 8 {
+		case 1:
+			ppu.fetchNameTableByte()
+		case 3:
+			ppu.fetchAttributeTableByte()
+		case 5:
+			ppu.fetchLowTileByte()
+		case 7:
+			ppu.fetchHighTileByte()
+		case 0:
+			ppu.storeTileData()
+			ppu.incrementX()
 		}
-		if renderLine {
-			if fetchCycle && ppu.Cycle%8 == 0 {
-				ppu.incrementX()
-			}
-			if ppu.Cycle == 256 {
-				ppu.incrementY()
-			}
-			if ppu.Cycle == 257 {
-				ppu.copyX()
-			}
+	}
+	switch {
+	case cycle == 256:
+		ppu.incrementY()
+	case cycle == 257:
+		ppu.copyX()
+		if visibleLine {
+			ppu.evaluateSprites()
+		} else {
+			ppu.spriteCount = 0
 		}
+	case preLine && cycle >= 280 && cycle <= 304:
+		ppu.copyY()
 	}
+}
 
-	// sprite logic
-	if renderingEnabled {
-		if ppu.Cycle == 257 {
-			if visibleLine {
-				ppu.evaluateSprites()
-			} else {
-				ppu.spriteCount = 0
-			}
-		}
+// Step executes a single PPU cycle
+func (ppu *PPU) Step() {
+	ppu.tick()
+
+	if ppu.flagShowBackground != 0 || ppu.flagShowSprites != 0 {
+		ppu.render()
 	}
 
 	// vblank logic
 	if ppu.ScanLine == 241 && ppu.Cycle == 1 {
 		ppu.setVerticalBlank()
 	}
-	if preLine && ppu.Cycle == 1 {
+	if ppu.ScanLine == 261 && ppu.Cycle == 1 {
 		ppu.clearVerticalBlank()
 		ppu.flagSpriteZeroHit = 0
 		ppu.flagSpriteOverflow = 0
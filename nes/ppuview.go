@@ -0,0 +1,193 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Sprite describes one OAM entry.
+type Sprite struct {
+	Index    int
+	X        int
+	Y        int // top of the sprite; OAM stores Y-1
+	Tile     byte
+	Palette  int  // 4-7
+	Behind   bool // drawn behind the background
+	FlipH    bool
+	FlipV    bool
+	Height   int // 8 or 16
+	Visible  bool
+	RawBytes [4]byte
+}
+
+// color returns the color of palette entry index (0-31), using the current
+// grayscale and emphasis settings
+func (ppu *PPU) color(index int) color.RGBA {
+	if index%4 == 0 {
+		index = 0
+	}
+	return ppu.console.Palette.Lookup(
+		ppu.readPalette(uint16(index)), ppu.flagGrayscale == 1, ppu.emphasis())
+}
+
+// drawTile draws the 8x8 tile at pattern address using palette (0-7). When
+// transparent is set, pixels with value 0 are left alone.
+func (ppu *PPU) drawTile(im *image.RGBA, x, y int, address uint16, palette int, flipH, flipV, transparent bool) {
+	for row := 0; row < 8; row++ {
+		low := ppu.Read(address + uint16(row))
+		high := ppu.Read(address + uint16(row) + 8)
+		dy := row
+		if flipV {
+			dy = 7 - row
+		}
+		for col := 0; col < 8; col++ {
+			shift := uint(7 - col)
+			value := int((low>>shift)&1 | ((high>>shift)&1)<<1)
+			if value == 0 && transparent {
+				continue
+			}
+			dx := col
+			if flipH {
+				dx = 7 - col
+			}
+			im.SetRGBA(x+dx, y+dy, ppu.color(palette*4+value))
+		}
+	}
+}
+
+// NameTables renders the four logical nametables at $2000, $2400, $2800 and
+// $2C00 as a 512x480 image, with mirroring applied by the cartridge.
+func (console *Console) NameTables() *image.RGBA {
+	ppu := console.PPU
+	im := image.NewRGBA(image.Rect(0, 0, 512, 480))
+	table := 0x1000 * uint16(ppu.flagBackgroundTable)
+	for n := 0; n < 4; n++ {
+		base := 0x2000 + uint16(n)*0x0400
+		ox := (n % 2) * 256
+		oy := (n / 2) * 240
+		for ty := 0; ty < 30; ty++ {
+			for tx := 0; tx < 32; tx++ {
+				tile := ppu.Read(base + uint16(ty*32+tx))
+				attribute := ppu.Read(base + 0x03C0 + uint16(ty/4*8+tx/4))
+				shift := uint((ty&2)<<1 | tx&2)
+				palette := int(attribute>>shift) & 3
+				ppu.drawTile(im, ox+tx*8, oy+ty*8,
+					table+uint16(tile)*16, palette, false, false, false)
+			}
+		}
+	}
+	return im
+}
+
+// PatternTable renders pattern table 0 ($0000) or 1 ($1000) as a 128x128
+// image of 16x16 tiles using palette 0-7.
+func (console *Console) PatternTable(table, palette int) *image.RGBA {
+	ppu := console.PPU
+	im := image.NewRGBA(image.Rect(0, 0, 128, 128))
+	for tile := 0; tile < 256; tile++ {
+		address := uint16(table&1)*0x1000 + uint16(tile)*16
+		ppu.drawTile(im, tile%16*8, tile/16*8, address, palette&7, false, false, false)
+	}
+	return im
+}
+
+// Sprites returns the 64 entries of OAM.
+func (console *Console) Sprites() []Sprite {
+	ppu := console.PPU
+	height := 8
+	if ppu.flagSpriteSize == 1 {
+		height = 16
+	}
+	sprites := make([]Sprite, 64)
+	for i := range sprites {
+		var raw [4]byte
+		copy(raw[:], ppu.oamData[i*4:])
+		attributes := raw[2]
+		sprites[i] = Sprite{
+			Index:    i,
+			X:        int(raw[3]),
+			Y:        int(raw[0]) + 1,
+			Tile:     raw[1],
+			Palette:  4 + int(attributes&3),
+			Behind:   attributes&0x20 != 0,
+			FlipH:    attributes&0x40 != 0,
+			FlipV:    attributes&0x80 != 0,
+			Height:   height,
+			Visible:  raw[0] < 0xEF,
+			RawBytes: raw,
+		}
+	}
+	return sprites
+}
+
+// SpriteSheet renders the 64 sprites in an 8x8 grid of 8x16 cells on the
+// background color, giving a 64x128 image.
+func (console *Console) SpriteSheet() *image.RGBA {
+	ppu := console.PPU
+	im := image.NewRGBA(image.Rect(0, 0, 64, 128))
+	draw.Draw(im, im.Bounds(), &image.Uniform{ppu.color(0)}, image.ZP, draw.Src)
+	for _, s := range console.Sprites() {
+		x, y := s.Index%8*8, s.Index/8*16
+		console.drawSprite(im, x, y, s)
+	}
+	return im
+}
+
+// SpriteLayer renders all visible sprites at their screen positions over a
+// transparent 256x240 image.
+func (console *Console) SpriteLayer() *image.RGBA {
+	im := image.NewRGBA(image.Rect(0, 0, 256+8, 240+16))
+	sprites := console.Sprites()
+	// lower indexes have priority, so draw them last
+	for i := len(sprites) - 1; i >= 0; i-- {
+		if sprites[i].Visible {
+			console.drawSprite(im, sprites[i].X, sprites[i].Y, sprites[i])
+		}
+	}
+	return im.SubImage(image.Rect(0, 0, 256, 240)).(*image.RGBA)
+}
+
+func (console *Console) drawSprite(im *image.RGBA, x, y int, s Sprite) {
+	ppu := console.PPU
+	if s.Height == 8 {
+		address := 0x1000*uint16(ppu.flagSpriteTable) + uint16(s.Tile)*16
+		ppu.drawTile(im, x, y, address, s.Palette, s.FlipH, s.FlipV, true)
+		return
+	}
+	table := uint16(s.Tile&1) * 0x1000
+	top := table + uint16(s.Tile&0xFE)*16
+	bottom := top + 16
+	if s.FlipV {
+		top, bottom = bottom, top
+	}
+	ppu.drawTile(im, x, y, top, s.Palette, s.FlipH, s.FlipV, true)
+	ppu.drawTile(im, x, y+8, bottom, s.Palette, s.FlipH, s.FlipV, true)
+}
+
+// PaletteRAM returns the 32 bytes of palette RAM at $3F00.
+func (console *Console) PaletteRAM() [32]byte {
+	var data [32]byte
+	for i := range data {
+		data[i] = console.PPU.readPalette(uint16(i))
+	}
+	return data
+}
+
+// PaletteImage renders palette RAM as two rows of sixteen 16x16 swatches,
+// background palettes on top and sprite palettes below.
+func (console *Console) PaletteImage() *image.RGBA {
+	ppu := console.PPU
+	im := image.NewRGBA(image.Rect(0, 0, 256, 32))
+	for i := 0; i < 32; i++ {
+		c := console.Palette.Lookup(
+			ppu.readPalette(uint16(i)), ppu.flagGrayscale == 1, ppu.emphasis())
+		x, y := i%16*16, i/16*16
+		for dy := 0; dy < 16; dy++ {
+			for dx := 0; dx < 16; dx++ {
+				im.SetRGBA(x+dx, y+dy, c)
+			}
+		}
+	}
+	return im
+}
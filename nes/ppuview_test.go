@@ -0,0 +1,59 @@
+package nes
+
+import "testing"
+
+// ppuViewProgram fills palette RAM and one OAM entry
+func ppuViewProgram() []byte {
+	p := []byte{0xAD, 0x02, 0x20} // LDA $2002
+	p = store(p, 0x2006, 0x3F)
+	p = store(p, 0x2006, 0x00)
+	p = store(p, 0x2007, 0x0F)
+	p = store(p, 0x2007, 0x16)
+	p = store(p, 0x2006, 0x3F)
+	p = store(p, 0x2006, 0x11)
+	p = store(p, 0x2007, 0x2A)
+	p = store(p, 0x2003, 0x04)
+	for _, b := range []byte{0x20, 0x41, 0xE3, 0x50} {
+		p = store(p, 0x2004, b)
+	}
+	p = store(p, 0x2000, 0x20) // 8x16 sprites
+	end := 0x8000 + uint16(len(p))
+	return append(p, 0x4C, byte(end), byte(end>>8))
+}
+
+func TestPaletteRAM(t *testing.T) {
+	console := newTestConsole(t, ppuViewProgram())
+	console.StepFrame()
+	ram := console.PaletteRAM()
+	if ram[0] != 0x0F || ram[1] != 0x16 || ram[0x11] != 0x2A {
+		t.Errorf("got % X", ram)
+	}
+	// $3F10 mirrors $3F00
+	if ram[0x10] != ram[0] {
+		t.Errorf("$3F10 = $%02X, want $%02X", ram[0x10], ram[0])
+	}
+	im := console.PaletteImage()
+	if got, want := im.RGBAAt(16*1+8, 8), DefaultPalette.Lookup(0x16, false, 0); got != want {
+		t.Errorf("swatch 1: got %v, want %v", got, want)
+	}
+	if got, want := im.RGBAAt(16*1+8, 24), DefaultPalette.Lookup(0x2A, false, 0); got != want {
+		t.Errorf("swatch $11: got %v, want %v", got, want)
+	}
+}
+
+func TestSprites(t *testing.T) {
+	console := newTestConsole(t, ppuViewProgram())
+	console.StepFrame()
+	sprites := console.Sprites()
+	if len(sprites) != 64 {
+		t.Fatalf("got %d sprites", len(sprites))
+	}
+	want := Sprite{
+		Index: 1, X: 0x50, Y: 0x21, Tile: 0x41, Palette: 7,
+		Behind: true, FlipH: true, FlipV: true, Height: 16, Visible: true,
+		RawBytes: [4]byte{0x20, 0x41, 0xE3, 0x50},
+	}
+	if sprites[1] != want {
+		t.Errorf("got %+v", sprites[1])
+	}
+}
@@ -0,0 +1,178 @@
+package nes
+
+import "fmt"
+
+// RAM search comparisons. The first four compare each candidate against a
+// given value; the rest compare it against its value at the previous search.
+const (
+	SearchEqual = iota
+	SearchNotEqual
+	SearchGreater
+	SearchLess
+	SearchChanged
+	SearchUnchanged
+	SearchIncreased
+	SearchDecreased
+	SearchChangedBy
+)
+
+var searchNames = map[string]int{
+	"eq": SearchEqual, "ne": SearchNotEqual, "gt": SearchGreater,
+	"lt": SearchLess, "changed": SearchChanged, "unchanged": SearchUnchanged,
+	"increased": SearchIncreased, "decreased": SearchDecreased,
+	"changedby": SearchChangedBy,
+}
+
+// ParseSearchOp parses a comparison name: eq, ne, gt, lt, changed,
+// unchanged, increased, decreased or changedby.
+func ParseSearchOp(name string) (int, error) {
+	op, ok := searchNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown comparison: %s", name)
+	}
+	return op, nil
+}
+
+// SearchResult is a candidate address of a RAM search.
+type SearchResult struct {
+	Address  uint16
+	Value    int
+	Previous int
+}
+
+// RAMSearch narrows down the addresses in internal RAM ($0000-$07FF) and
+// cartridge SRAM ($6000-$7FFF) that hold a value of interest.
+type RAMSearch struct {
+	console    *Console
+	size       int
+	signed     bool
+	previous   []byte
+	candidates []int // offsets into the RAM followed by SRAM
+}
+
+// NewRAMSearch starts a search over 8 or 16-bit little-endian values,
+// signed or unsigned. All addresses start out as candidates.
+func NewRAMSearch(console *Console, size int, signed bool) (*RAMSearch, error) {
+	if size != 1 && size != 2 {
+		return nil, fmt.Errorf("invalid value size: %d", size)
+	}
+	s := RAMSearch{console: console, size: size, signed: signed}
+	s.Reset()
+	return &s, nil
+}
+
+// Reset takes a new snapshot and makes every address a candidate again.
+func (s *RAMSearch) Reset() {
+	s.Snapshot()
+	s.candidates = nil
+	for offset := range s.previous {
+		if s.valid(offset) {
+			s.candidates = append(s.candidates, offset)
+		}
+	}
+}
+
+// Snapshot records the current values to compare the next search against.
+func (s *RAMSearch) Snapshot() {
+	s.previous = s.memory()
+}
+
+// memory returns a copy of RAM followed by SRAM
+func (s *RAMSearch) memory() []byte {
+	memory := append([]byte(nil), s.console.RAM[:]...)
+	return append(memory, s.console.Cartridge.SRAM...)
+}
+
+// valid reports whether a value of the search size starting at offset lies
+// within a single memory
+func (s *RAMSearch) valid(offset int) bool {
+	n := len(s.console.RAM)
+	last := offset + s.size - 1
+	return last < len(s.previous) && (offset < n) == (last < n)
+}
+
+func (s *RAMSearch) address(offset int) uint16 {
+	n := len(s.console.RAM)
+	if offset < n {
+		return uint16(offset)
+	}
+	return uint16(0x6000 + offset - n)
+}
+
+func (s *RAMSearch) value(memory []byte, offset int) int {
+	if s.size == 1 {
+		if s.signed {
+			return int(int8(memory[offset]))
+		}
+		return int(memory[offset])
+	}
+	value := uint16(memory[offset]) | uint16(memory[offset+1])<<8
+	if s.signed {
+		return int(int16(value))
+	}
+	return int(value)
+}
+
+// Filter keeps the candidates that satisfy the comparison and takes a new
+// snapshot. value is the operand of SearchEqual to SearchLess and the
+// difference for SearchChangedBy. It returns the number of candidates left.
+func (s *RAMSearch) Filter(op int, value int) int {
+	memory := s.memory()
+	candidates := s.candidates[:0]
+	for _, offset := range s.candidates {
+		current := s.value(memory, offset)
+		previous := s.value(s.previous, offset)
+		var ok bool
+		switch op {
+		case SearchEqual:
+			ok = current == value
+		case SearchNotEqual:
+			ok = current != value
+		case SearchGreater:
+			ok = current > value
+		case SearchLess:
+			ok = current < value
+		case SearchChanged:
+			ok = current != previous
+		case SearchUnchanged:
+			ok = current == previous
+		case SearchIncreased:
+			ok = current > previous
+		case SearchDecreased:
+			ok = current < previous
+		case SearchChangedBy:
+			ok = current-previous == value
+		}
+		if ok {
+			candidates = append(candidates, offset)
+		}
+	}
+	s.candidates = candidates
+	s.previous = memory
+	return len(candidates)
+}
+
+// Count returns the number of candidates.
+func (s *RAMSearch) Count() int {
+	return len(s.candidates)
+}
+
+// Results returns up to limit candidates with their current and snapshot
+// values. A limit of zero or less returns all of them.
+func (s *RAMSearch) Results(limit int) []SearchResult {
+	memory := s.memory()
+	n := len(s.candidates)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	results := make([]SearchResult, n)
+	for i := range results {
+		offset := s.candidates[i]
+		results[i] = SearchResult{
+			Address:  s.address(offset),
+			Value:    s.value(memory, offset),
+			Previous: s.value(s.previous, offset),
+		}
+	}
+	return results
+}
@@ -0,0 +1,49 @@
+package nes
+
+import "testing"
+
+func TestRAMSearch(t *testing.T) {
+	console := newTestConsole(t, debuggerProgram)
+	s, err := NewRAMSearch(console, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Count() != 0x0800+0x2000 {
+		t.Fatalf("got %d candidates", s.Count())
+	}
+	console.RAM[0x40] = 5
+	console.Cartridge.SRAM[0x10] = 5
+	if n := s.Filter(SearchChangedBy, 5); n != 2 {
+		t.Fatalf("changed by 5: got %d candidates", n)
+	}
+	console.Cartridge.SRAM[0x10] = 4
+	if n := s.Filter(SearchDecreased, 0); n != 1 {
+		t.Fatalf("decreased: got %d candidates", n)
+	}
+	results := s.Results(0)
+	if results[0].Address != 0x6010 || results[0].Value != 4 || results[0].Previous != 4 {
+		t.Errorf("got %+v", results[0])
+	}
+}
+
+func TestRAMSearchSigned16(t *testing.T) {
+	console := newTestConsole(t, debuggerProgram)
+	s, err := NewRAMSearch(console, 2, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a 16-bit value may not straddle RAM and SRAM
+	if s.Count() != 0x07FF+0x1FFF {
+		t.Fatalf("got %d candidates", s.Count())
+	}
+	console.RAM[0x20], console.RAM[0x21] = 0xFE, 0xFF
+	if n := s.Filter(SearchEqual, -2); n != 1 {
+		t.Fatalf("got %d candidates", n)
+	}
+	if a := s.Results(1)[0].Address; a != 0x20 {
+		t.Errorf("got $%04X", a)
+	}
+	if _, err := NewRAMSearch(console, 4, false); err == nil {
+		t.Error("expected error for size 4")
+	}
+}
@@ -0,0 +1,63 @@
+package nes
+
+import "math"
+
+// eventKind identifies a scheduled event. Each kind has at most one pending
+// occurrence; scheduling it again moves it.
+type eventKind int
+
+const (
+	eventFrameCounter eventKind = iota // APU frame counter tick
+	eventMapperIRQ                     // cartridge IRQ timer
+	eventKinds
+)
+
+const never = math.MaxUint64
+
+// scheduler runs events at timestamps measured in CPU cycles, as counted by
+// the APU. Components schedule their next event instead of checking for it
+// on every cycle. The zero value has no events pending.
+type scheduler struct {
+	next     uint64 // timestamp of the earliest pending event, if any
+	at       [eventKinds]uint64
+	pending  [eventKinds]bool
+	handlers [eventKinds]func()
+}
+
+// handle sets the function that runs when an event of the kind is due
+func (s *scheduler) handle(kind eventKind, f func()) {
+	s.handlers[kind] = f
+}
+
+func (s *scheduler) schedule(kind eventKind, at uint64) {
+	s.at[kind] = at
+	s.pending[kind] = true
+	s.update()
+}
+
+func (s *scheduler) cancel(kind eventKind) {
+	s.pending[kind] = false
+	s.update()
+}
+
+// update recomputes next, returning the kind of the earliest event or -1
+func (s *scheduler) update() eventKind {
+	kind := eventKind(-1)
+	s.next = never
+	for i, at := range s.at {
+		if s.pending[i] && at < s.next {
+			kind = eventKind(i)
+			s.next = at
+		}
+	}
+	return kind
+}
+
+// run fires every event due at or before now, earliest first and in kind
+// order for ties. Handlers may schedule further events.
+func (s *scheduler) run(now uint64) {
+	for kind := s.update(); kind >= 0 && s.next <= now; kind = s.update() {
+		s.pending[kind] = false
+		s.handlers[kind]()
+	}
+}
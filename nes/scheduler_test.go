@@ -0,0 +1,97 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"testing"
+)
+
+func TestScheduler(t *testing.T) {
+	var s scheduler
+	var fired []eventKind
+	s.handle(eventFrameCounter, func() {
+		fired = append(fired, eventFrameCounter)
+	})
+	s.handle(eventMapperIRQ, func() {
+		fired = append(fired, eventMapperIRQ)
+		s.schedule(eventFrameCounter, 12)
+	})
+	s.schedule(eventFrameCounter, 20)
+	s.schedule(eventMapperIRQ, 10)
+	s.run(9)
+	if len(fired) != 0 {
+		t.Fatalf("fired early: %v", fired)
+	}
+	s.run(15)
+	want := []eventKind{eventMapperIRQ, eventFrameCounter}
+	if !reflect.DeepEqual(fired, want) || s.next != never {
+		t.Errorf("got %v, next %d", fired, s.next)
+	}
+	s.schedule(eventMapperIRQ, 30)
+	s.cancel(eventMapperIRQ)
+	if s.next != never {
+		t.Error("cancel left an event pending")
+	}
+}
+
+// mapper40Program enables the mapper 40 IRQ counter and restarts it from
+// the IRQ handler
+var mapper40Program = []byte{
+	0x58,             // E000 CLI
+	0x8D, 0x00, 0xA0, // E001 STA $A000
+	0x4C, 0x04, 0xE0, // E004 JMP $E004
+	0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0x8D, 0x00, 0x80, // E010 STA $8000
+	0x8D, 0x00, 0xA0, // E013 STA $A000
+	0x40, // E016 RTI
+}
+
+func newMapper40Console(t *testing.T) (*Console, *[]uint64) {
+	prg := make([]byte, 0x10000)
+	copy(prg[0xE000:], mapper40Program)
+	prg[0xFFFC], prg[0xFFFD] = 0x00, 0xE0
+	prg[0xFFFE], prg[0xFFFF] = 0x10, 0xE0
+	console, err := newConsole(NewCartridge(prg, make([]byte, 0x2000), 40, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	console.Reset()
+	irqs := new([]uint64)
+	console.OnExecute(0xE010, func() {
+		*irqs = append(*irqs, console.APU.cycle)
+	})
+	return console, irqs
+}
+
+// the IRQ times match those of the original per-PPU-cycle counter
+func TestMapper40IRQ(t *testing.T) {
+	console, irqs := newMapper40Console(t)
+	for len(*irqs) < 2 {
+		console.Step()
+	}
+	if want := []uint64{4098, 8205}; !reflect.DeepEqual(*irqs, want) {
+		t.Fatalf("got IRQs at %v, want %v", *irqs, want)
+	}
+	for console.APU.cycle < 10000 {
+		console.Step()
+	}
+	var buf bytes.Buffer
+	if err := console.Save(gob.NewEncoder(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	loaded, loadedIRQs := newMapper40Console(t)
+	if err := loaded.Load(gob.NewDecoder(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	for len(*irqs) < 4 {
+		console.Step()
+	}
+	for len(*loadedIRQs) < 2 {
+		loaded.Step()
+	}
+	if want := []uint64{12312, 16419}; !reflect.DeepEqual(*loadedIRQs, want) ||
+		!reflect.DeepEqual((*irqs)[2:], want) {
+		t.Errorf("got IRQs at %v and %v after loading, want %v", *irqs, *loadedIRQs, want)
+	}
+}
@@ -0,0 +1,134 @@
+package nes
+
+import (
+	"crypto/md5"
+	"encoding/gob"
+	"fmt"
+	"reflect"
+)
+
+// StateHash returns a digest of the console's emulation state: everything
+// in a save state, i.e. RAM, CPU registers, PPU registers and memories, APU
+// state, cartridge RAM, mapper registers and controllers. Consoles running
+// the same game in the same state have the same hash.
+func (console *Console) StateHash() [md5.Size]byte {
+	h := md5.New()
+	console.Save(gob.NewEncoder(h))
+	var sum [md5.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// StateDiff is a difference between two consoles found by DiffState.
+type StateDiff struct {
+	Component string // CPU, PPU, APU, RAM, Cartridge, Mapper, Controller1 or Controller2
+	Field     string // path of the field within the component
+	A, B      string // the differing values
+}
+
+func (d StateDiff) String() string {
+	sep := "."
+	if d.Field == "" || d.Field[0] == '[' {
+		sep = ""
+	}
+	return fmt.Sprintf("%s%s%s: %s != %s", d.Component, sep, d.Field, d.A, d.B)
+}
+
+// DiffState compares two consoles running the same game field by field and
+// returns the differences. References to other components, frame buffers
+// and function tables are skipped. Fields that are not part of save states,
+// such as audio filter state, are compared too; to compare only saved
+// state, load both states into new consoles first.
+func DiffState(a, b *Console) []StateDiff {
+	components := []struct {
+		name string
+		a, b interface{}
+	}{
+		{"CPU", a.CPU, b.CPU},
+		{"PPU", a.PPU, b.PPU},
+		{"APU", a.APU, b.APU},
+		{"RAM", a.RAM, b.RAM},
+		{"Cartridge", a.Cartridge, b.Cartridge},
+		{"Mapper", a.Mapper, b.Mapper},
+		{"Controller1", a.Controller1, b.Controller1},
+		{"Controller2", a.Controller2, b.Controller2},
+	}
+	d := stateDiffer{}
+	for _, c := range components {
+		d.component = c.name
+		va := reflect.Indirect(reflect.ValueOf(c.a))
+		vb := reflect.Indirect(reflect.ValueOf(c.b))
+		if va.Type() != vb.Type() {
+			d.add("", va.Type().String(), vb.Type().String())
+			continue
+		}
+		d.diff("", va, vb)
+	}
+	return d.diffs
+}
+
+type stateDiffer struct {
+	component string
+	diffs     []StateDiff
+}
+
+func (d *stateDiffer) add(field, a, b string) {
+	d.diffs = append(d.diffs, StateDiff{d.component, field, a, b})
+}
+
+func (d *stateDiffer) diff(path string, a, b reflect.Value) {
+	switch a.Kind() {
+	case reflect.Struct:
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name := t.Field(i).Name
+			if path != "" {
+				name = path + "." + name
+			}
+			d.diff(name, a.Field(i), b.Field(i))
+		}
+	case reflect.Array, reflect.Slice:
+		d.diffList(path, a, b)
+	case reflect.Bool, reflect.String, reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		if sa, sb := fmt.Sprint(a), fmt.Sprint(b); sa != sb {
+			d.add(path, sa, sb)
+		}
+	}
+	// pointers, interfaces, functions and maps refer to other parts of the
+	// emulator or to frontend state
+}
+
+// diffList reports the first differing element of byte arrays and slices,
+// with a count of the others, and recurses into other element types
+func (d *stateDiffer) diffList(path string, a, b reflect.Value) {
+	if a.Len() != b.Len() {
+		d.add(path+".len", fmt.Sprint(a.Len()), fmt.Sprint(b.Len()))
+		return
+	}
+	if a.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < a.Len(); i++ {
+			d.diff(fmt.Sprintf("%s[%d]", path, i), a.Index(i), b.Index(i))
+		}
+		return
+	}
+	first, count := -1, 0
+	for i := 0; i < a.Len(); i++ {
+		if a.Index(i).Uint() != b.Index(i).Uint() {
+			if first < 0 {
+				first = i
+			}
+			count++
+		}
+	}
+	if first < 0 {
+		return
+	}
+	va := fmt.Sprintf("$%02X", a.Index(first).Uint())
+	vb := fmt.Sprintf("$%02X", b.Index(first).Uint())
+	if count > 1 {
+		vb += fmt.Sprintf(" (and %d more)", count-1)
+	}
+	d.add(fmt.Sprintf("%s[$%04X]", path, first), va, vb)
+}
@@ -0,0 +1,59 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"testing"
+)
+
+func TestStateHash(t *testing.T) {
+	a := newTestConsole(t, joypadProgram)
+	b := newTestConsole(t, joypadProgram)
+	for i := 0; i < 3; i++ {
+		a.StepFrame()
+		b.StepFrame()
+	}
+	if a.StateHash() != b.StateHash() {
+		t.Fatal("identical consoles have different hashes")
+	}
+	if diffs := DiffState(a, b); len(diffs) != 0 {
+		t.Fatalf("identical consoles differ: %v", diffs)
+	}
+
+	var buf bytes.Buffer
+	if err := a.Save(gob.NewEncoder(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestConsole(t, joypadProgram)
+	if err := c.Load(gob.NewDecoder(&buf)); err != nil {
+		t.Fatal(err)
+	}
+	if c.StateHash() != a.StateHash() {
+		t.Error("loaded state has a different hash")
+	}
+
+	b.RAM[0x10] = 0x55
+	b.RAM[0x20] = 0x66
+	b.CPU.A++
+	b.APU.pulse1.timerValue++
+	if a.StateHash() == b.StateHash() {
+		t.Error("different consoles have the same hash")
+	}
+	want := map[string]bool{
+		"RAM[$0010]: $00 != $55 (and 1 more)":            true,
+		fmt.Sprintf("CPU.A: %d != %d", a.CPU.A, b.CPU.A): true,
+		fmt.Sprintf("APU.pulse1.timerValue: %d != %d",
+			a.APU.pulse1.timerValue, b.APU.pulse1.timerValue): true,
+	}
+	diffs := DiffState(a, b)
+	for _, d := range diffs {
+		if !want[d.String()] {
+			t.Errorf("unexpected difference %s", d)
+		}
+		delete(want, d.String())
+	}
+	for d := range want {
+		t.Errorf("missing difference %s", d)
+	}
+}
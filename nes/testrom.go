@@ -0,0 +1,163 @@
+package nes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// blargg test ROM status protocol: $6000 holds the status, $6001-$6003 a
+// signature and $6004 on a NUL-terminated text message
+const (
+	testStatusRunning = 0x80
+	testStatusReset   = 0x81 // the ROM wants the reset button pressed
+)
+
+var testSignature = [3]byte{0xDE, 0xB0, 0x61}
+
+// TestROMResult is the outcome of RunTestROM.
+type TestROMResult struct {
+	Passed  bool
+	Code    int    // result code written to $6000; 0 is a pass, -1 if unknown
+	Message string // text written by the ROM, or shown on screen
+	Frames  int    // frames run until the result was known
+}
+
+// RunTestROM runs a test ROM headlessly for up to maxFrames frames. The
+// result is read from the $6000 status protocol of blargg's test ROMs when
+// the ROM uses it, and otherwise from "passed" or "failed" appearing in the
+// text on screen. A ROM that reports nothing in time fails.
+func RunTestROM(path string, maxFrames int) (TestROMResult, error) {
+	console, err := NewConsole(path)
+	if err != nil {
+		return TestROMResult{}, err
+	}
+	console.Reset()
+	result := TestROMResult{Code: -1}
+	resetAt := -1
+	for frame := 1; frame <= maxFrames; frame++ {
+		console.StepFrame()
+		result.Frames = frame
+		if console.testSignature() {
+			switch status := console.Peek(0x6000); status {
+			case testStatusRunning:
+			case testStatusReset:
+				// press reset at least 100 ms after the request
+				if resetAt < 0 {
+					resetAt = frame + 6
+				} else if frame >= resetAt {
+					console.Reset()
+					resetAt = -1
+				}
+			default:
+				result.Code = int(status)
+				result.Passed = status == 0
+				result.Message = console.testMessage()
+				return result, nil
+			}
+			continue
+		}
+		if frame%30 == 0 {
+			text := console.ScreenText()
+			lower := strings.ToLower(text)
+			if strings.Contains(lower, "passed") {
+				result.Passed = true
+				result.Message = text
+				return result, nil
+			}
+			if strings.Contains(lower, "failed") {
+				result.Message = text
+				return result, nil
+			}
+		}
+	}
+	result.Message = "timed out"
+	if console.testSignature() {
+		result.Message += ": " + console.testMessage()
+	}
+	return result, nil
+}
+
+func (console *Console) testSignature() bool {
+	for i, b := range testSignature {
+		if console.Peek(0x6001+uint16(i)) != b {
+			return false
+		}
+	}
+	return true
+}
+
+func (console *Console) testMessage() string {
+	var b []byte
+	for address := uint16(0x6004); address < 0x8000; address++ {
+		c := console.Peek(address)
+		if c == 0 {
+			break
+		}
+		b = append(b, c)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// ScreenText returns the first nametable as text, for test ROMs whose font
+// tiles are numbered by ASCII code. Other tiles become spaces and blank
+// lines are dropped.
+func (console *Console) ScreenText() string {
+	var lines []string
+	for row := 0; row < 30; row++ {
+		line := make([]byte, 32)
+		for col := range line {
+			c := console.PPU.nameTableData[row*32+col]
+			if c < 0x20 || c >= 0x7F {
+				c = ' '
+			}
+			line[col] = c
+		}
+		if s := strings.TrimSpace(string(line)); s != "" {
+			lines = append(lines, s)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// nestestFields matches the registers and cycle count of a nestest.log
+// line
+var nestestFields = regexp.MustCompile(
+	`^([0-9A-F]{4}) .*A:([0-9A-F]{2}) X:([0-9A-F]{2}) Y:([0-9A-F]{2}) P:([0-9A-F]{2}) SP:([0-9A-F]{2}).*CYC:\s*(\d+)`)
+
+// CompareNestest runs nestest.nes in its automated mode, starting at $C000,
+// and compares the trace logger's output with the golden nestest.log line
+// by line. The program counter, registers and cycle count must match. It
+// returns the number of matching lines and an error describing the first
+// mismatch.
+func CompareNestest(romPath string, golden io.Reader) (int, error) {
+	console, err := NewConsole(romPath)
+	if err != nil {
+		return 0, err
+	}
+	console.Reset()
+	console.CPU.PC = 0xC000
+	console.CPU.Cycles = 7
+	tracer := NewTracer(console, nil)
+	scanner := bufio.NewScanner(golden)
+	lines := 0
+	for number := 1; scanner.Scan(); number++ {
+		want := scanner.Text()
+		wantFields := nestestFields.FindStringSubmatch(want)
+		if wantFields == nil {
+			continue
+		}
+		got := tracer.Line()
+		gotFields := nestestFields.FindStringSubmatch(got)
+		for i := 1; i < len(wantFields); i++ {
+			if gotFields == nil || gotFields[i] != wantFields[i] {
+				return lines, fmt.Errorf("nestest line %d:\nwant %s\ngot  %s", number, want, got)
+			}
+		}
+		lines++
+		console.Step()
+	}
+	return lines, scanner.Err()
+}
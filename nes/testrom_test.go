@@ -0,0 +1,192 @@
+package nes
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/nes/internal/testrom"
+)
+
+// writeTestROM writes rom to a temporary file and returns its path
+func writeTestROM(t *testing.T, rom []byte) string {
+	dir, err := ioutil.TempDir("", "testrom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "test.nes")
+	if err := ioutil.WriteFile(path, rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// store appends LDA #value, STA address
+func store(program []byte, address uint16, value byte) []byte {
+	return append(program, 0xA9, value, 0x8D, byte(address), byte(address>>8))
+}
+
+// blarggProgram reports through $6000: running, then the message "OK" and
+// the result code after about ten frames
+func blarggProgram(code byte) []byte {
+	p := store(nil, 0x6000, testStatusRunning)
+	for i, b := range append(testSignature[:], 'O', 'K', 0) {
+		p = store(p, 0x6001+uint16(i), b)
+	}
+	p = append(p,
+		0xA0, 0x00, // LDY #$00
+		0xCA,       // DEX
+		0xD0, 0xFD, // BNE -3
+		0x88,       // DEY
+		0xD0, 0xFA, // BNE -6
+	)
+	p = store(p, 0x6000, code)
+	end := 0x8000 + uint16(len(p))
+	return append(p, 0x4C, byte(end), byte(end>>8)) // JMP end
+}
+
+// screenProgram writes text to the first nametable
+func screenProgram(text string) []byte {
+	p := []byte{0xAD, 0x02, 0x20} // LDA $2002
+	p = store(p, 0x2006, 0x20)
+	p = store(p, 0x2006, 0x21)
+	for _, c := range []byte(text) {
+		p = store(p, 0x2007, c)
+	}
+	end := 0x8000 + uint16(len(p))
+	return append(p, 0x4C, byte(end), byte(end>>8))
+}
+
+func TestRunTestROM(t *testing.T) {
+	tests := []struct {
+		program []byte
+		passed  bool
+		code    int
+		message string
+	}{
+		{blarggProgram(0), true, 0, "OK"},
+		{blarggProgram(3), false, 3, "OK"},
+		{screenProgram("All tests Passed"), true, -1, "All tests Passed"},
+		{screenProgram("Failed #2"), false, -1, "Failed #2"},
+		{screenProgram("Still going"), false, -1, "timed out"},
+	}
+	for i, test := range tests {
+		result, err := RunTestROM(writeTestROM(t, testrom.NROM(test.program)), 120)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Passed != test.passed || result.Code != test.code ||
+			result.Message != test.message {
+			t.Errorf("%d: got %+v", i, result)
+		}
+	}
+}
+
+func TestCompareNestest(t *testing.T) {
+	// the golden log comes from the tracer itself, starting at $C000 like
+	// nestest's automated mode
+	path := writeTestROM(t, testrom.NROM(debuggerProgram))
+	console, err := NewConsole(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	console.Reset()
+	console.CPU.PC = 0xC000
+	console.CPU.Cycles = 7
+	tracer := NewTracer(console, nil)
+	var golden []string
+	for i := 0; i < 50; i++ {
+		golden = append(golden, tracer.Line())
+		console.Step()
+	}
+	log := strings.Join(golden, "\n")
+	if n, err := CompareNestest(path, strings.NewReader(log)); n != 50 || err != nil {
+		t.Fatalf("got %d lines, %v", n, err)
+	}
+	golden[20] = strings.Replace(golden[20], "CYC:", "CYC:9", 1)
+	log = strings.Join(golden, "\n")
+	if n, err := CompareNestest(path, strings.NewReader(log)); n != 20 || err == nil {
+		t.Errorf("got %d lines, %v; want a mismatch on line 21", n, err)
+	}
+}
+
+// testROMDir holds test ROMs, such as blargg's suites and nestest.nes with
+// nestest.log. It may be overridden with $NES_TEST_ROMS.
+func testROMDir() string {
+	if dir := os.Getenv("NES_TEST_ROMS"); dir != "" {
+		return dir
+	}
+	return "../testroms"
+}
+
+// TestROMs runs every test ROM in testROMDir and logs a pass/fail table.
+// ROMs named in known_failures.txt in that directory are reported without
+// failing the test.
+func TestROMs(t *testing.T) {
+	dir := testROMDir()
+	var paths []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(path, ".nes") &&
+			filepath.Base(path) != "nestest.nes" {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if len(paths) == 0 {
+		t.Skip("no test roms in", dir)
+	}
+	known := make(map[string]bool)
+	if file, err := os.Open(filepath.Join(dir, "known_failures.txt")); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if name := strings.TrimSpace(scanner.Text()); name != "" {
+				known[name] = true
+			}
+		}
+		file.Close()
+	}
+	var table strings.Builder
+	passed := 0
+	for _, path := range paths {
+		name, _ := filepath.Rel(dir, path)
+		name = filepath.ToSlash(name)
+		result, err := RunTestROM(path, 60*60)
+		status := "PASS"
+		message := result.Message
+		switch {
+		case err != nil:
+			status, message = "ERROR", err.Error()
+		case !result.Passed:
+			status = "FAIL"
+		}
+		if status == "PASS" {
+			passed++
+		} else if known[name] {
+			status += " (known)"
+		} else {
+			t.Errorf("%s: %s", name, message)
+		}
+		message = strings.Replace(message, "\n", " ", -1)
+		fmt.Fprintf(&table, "%-12s %-50s %s\n", status, name, message)
+	}
+	t.Logf("%d/%d test roms passed\n%s", passed, len(paths), table.String())
+}
+
+func TestNestest(t *testing.T) {
+	dir := testROMDir()
+	golden, err := os.Open(filepath.Join(dir, "nestest.log"))
+	if err != nil {
+		t.Skip("nestest.log not found in", dir)
+	}
+	defer golden.Close()
+	n, err := CompareNestest(filepath.Join(dir, "nestest.nes"), golden)
+	if err != nil {
+		t.Fatalf("after %d matching lines: %v", n, err)
+	}
+	t.Logf("%d lines match", n)
+}
@@ -0,0 +1,106 @@
+package nes
+
+import (
+	"fmt"
+	"io"
+)
+
+// trace line formats
+const (
+	TraceNestest = iota // nestest.log / Mesen style
+	TraceFCEUX          // FCEUX trace logger style
+)
+
+// Tracer writes one line per executed instruction to an io.Writer. Lines
+// can be limited to instructions within a set of PC ranges.
+type Tracer struct {
+	console *Console
+	writer  io.Writer
+	format  int
+	ranges  [][2]uint16
+	err     error
+}
+
+func NewTracer(console *Console, writer io.Writer) *Tracer {
+	return &Tracer{console: console, writer: writer}
+}
+
+// SetFormat selects TraceNestest (the default) or TraceFCEUX.
+func (t *Tracer) SetFormat(format int) {
+	t.format = format
+}
+
+// AddRange restricts tracing to instructions with start <= PC <= end.
+// Multiple ranges may be added; with none, every instruction is traced.
+func (t *Tracer) AddRange(start, end uint16) {
+	t.ranges = append(t.ranges, [2]uint16{start, end})
+}
+
+// Err returns the first error encountered writing trace lines.
+func (t *Tracer) Err() error {
+	return t.err
+}
+
+func (t *Tracer) trace() {
+	if t.err != nil || !t.inRange(t.console.CPU.PC) {
+		return
+	}
+	if _, err := io.WriteString(t.writer, t.Line()+"\n"); err != nil {
+		t.err = err
+	}
+}
+
+func (t *Tracer) inRange(pc uint16) bool {
+	if len(t.ranges) == 0 {
+		return true
+	}
+	for _, r := range t.ranges {
+		if pc >= r[0] && pc <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// Line formats the trace line for the instruction at the current PC.
+func (t *Tracer) Line() string {
+	console := t.console
+	cpu := console.CPU
+	ppu := console.PPU
+	inst := Disassemble(console.Peek, cpu.PC)
+	text := inst.Annotated(cpu, console.Peek)
+	switch t.format {
+	case TraceFCEUX:
+		return fmt.Sprintf("$%04X:%-9s %-32s A:%02X X:%02X Y:%02X S:%02X P:%s",
+			cpu.PC, inst.HexBytes(), text,
+			cpu.A, cpu.X, cpu.Y, cpu.SP, flagString(cpu.Flags()))
+	}
+	prefix := " "
+	if !inst.Official() {
+		prefix = "*"
+	}
+	return fmt.Sprintf("%04X  %-8s %s%-31s "+
+		"A:%02X X:%02X Y:%02X P:%02X SP:%02X PPU:%3d,%3d CYC:%d",
+		cpu.PC, inst.HexBytes(), prefix, text,
+		cpu.A, cpu.X, cpu.Y, cpu.Flags(), cpu.SP,
+		ppu.ScanLine, ppu.Cycle, cpu.Cycles)
+}
+
+// flagString formats processor flags as letters, upper case when set
+func flagString(flags byte) string {
+	const set, clear = "NVUBDIZC", "nvubdizc"
+	b := make([]byte, 8)
+	for i := 0; i < 8; i++ {
+		if flags&(0x80>>uint(i)) != 0 {
+			b[i] = set[i]
+		} else {
+			b[i] = clear[i]
+		}
+	}
+	return string(b)
+}
+
+// SetTracer attaches a trace logger, or detaches it if tracer is nil.
+func (console *Console) SetTracer(tracer *Tracer) {
+	console.CPU.tracer = tracer
+}
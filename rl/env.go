@@ -0,0 +1,181 @@
+// Package rl wraps the emulator in a gym-style environment for
+// reinforcement learning.
+package rl
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+
+	"github.com/fogleman/nes/nes"
+)
+
+// ObservationType selects how frames are returned from Reset and Step.
+type ObservationType int
+
+const (
+	ObserveRGB     ObservationType = iota // 256x240x3 RGB bytes
+	ObserveIndexed                        // 256x240 palette indexes (0-63)
+	ObserveGray                           // Width x Height grayscale, box filtered
+)
+
+// Config configures an environment.
+type Config struct {
+	Observation ObservationType
+	Width       int  // grayscale width; defaults to 84
+	Height      int  // grayscale height; defaults to 84
+	Task        Task // scores episodes; required
+}
+
+// Env is a single console driven one action at a time. An action is a
+// button mask where bit i is button i, starting with nes.ButtonA.
+type Env struct {
+	console *nes.Console
+	config  Config
+	start   []byte // state episodes start from
+	prev    []byte // RAM at the end of the previous frame
+	done    bool
+}
+
+// NewEnv loads the ROM at path, powers it on and lets the task bring it to
+// where episodes start.
+func NewEnv(path string, config Config) (*Env, error) {
+	if config.Task == nil {
+		return nil, errors.New("rl: no task")
+	}
+	if config.Width <= 0 {
+		config.Width = 84
+	}
+	if config.Height <= 0 {
+		config.Height = 84
+	}
+	console, err := nes.NewConsole(path)
+	if err != nil {
+		return nil, err
+	}
+	console.Reset()
+	config.Task.Start(console)
+	env := Env{console: console, config: config}
+	if env.start, err = env.State(); err != nil {
+		return nil, err
+	}
+	env.prev = append([]byte(nil), console.RAM...)
+	return &env, nil
+}
+
+// Console returns the emulated console.
+func (env *Env) Console() *nes.Console {
+	return env.console
+}
+
+// Shape returns the height, width and channels of observations.
+func (env *Env) Shape() (height, width, channels int) {
+	switch env.config.Observation {
+	case ObserveRGB:
+		return 240, 256, 3
+	case ObserveIndexed:
+		return 240, 256, 1
+	}
+	return env.config.Height, env.config.Width, 1
+}
+
+// State returns a save state of the console.
+func (env *Env) State() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := env.console.Save(gob.NewEncoder(&buf)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Reset starts a new episode from the given save state, or from the start
+// state if it is nil, and returns the first observation. Save states do not
+// hold the frame buffer, so one frame is run with no buttons held to draw it.
+func (env *Env) Reset(state []byte) ([]byte, error) {
+	if state == nil {
+		state = env.start
+	}
+	if err := env.console.Load(gob.NewDecoder(bytes.NewReader(state))); err != nil {
+		return nil, err
+	}
+	env.console.SetButtons1([8]bool{})
+	env.console.StepFrame()
+	copy(env.prev, env.console.RAM)
+	env.done = false
+	return env.Observation(), nil
+}
+
+// Step holds the action's buttons for frameskip frames and returns the
+// observation after the last one, the summed reward and whether the
+// episode is over. The episode ends early if the task says it is done.
+func (env *Env) Step(action byte, frameskip int) ([]byte, float64, bool) {
+	if frameskip < 1 {
+		frameskip = 1
+	}
+	var buttons [8]bool
+	for i := range buttons {
+		buttons[i] = action>>uint(i)&1 == 1
+	}
+	env.console.SetButtons1(buttons)
+	task := env.config.Task
+	reward := 0.0
+	for i := 0; i < frameskip && !env.done; i++ {
+		env.console.StepFrame()
+		ram := env.console.RAM
+		reward += task.Reward(env.prev, ram)
+		env.done = task.Done(ram)
+		copy(env.prev, ram)
+	}
+	return env.Observation(), reward, env.done
+}
+
+// Observation returns the current frame in the configured format.
+func (env *Env) Observation() []byte {
+	switch env.config.Observation {
+	case ObserveRGB:
+		im := env.console.Buffer()
+		obs := make([]byte, 0, 256*240*3)
+		for i := 0; i < len(im.Pix); i += 4 {
+			obs = append(obs, im.Pix[i], im.Pix[i+1], im.Pix[i+2])
+		}
+		return obs
+	case ObserveIndexed:
+		pix := env.console.IndexedBuffer().Pix
+		obs := make([]byte, len(pix))
+		for i, index := range pix {
+			obs[i] = byte(index & 0x3F)
+		}
+		return obs
+	}
+	return gray(env.console, env.config.Width, env.config.Height)
+}
+
+// gray averages the frame's luminance over a w x h grid of boxes
+func gray(console *nes.Console, w, h int) []byte {
+	im := console.Buffer()
+	obs := make([]byte, w*h)
+	for y := 0; y < h; y++ {
+		y0, y1 := y*240/h, (y+1)*240/h
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*256/w, (x+1)*256/w
+			if x1 == x0 {
+				x1++
+			}
+			sum, n := 0, 0
+			for sy := y0; sy < y1; sy++ {
+				i := im.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					p := im.Pix[i : i+3]
+					sum += 299*int(p[0]) + 587*int(p[1]) + 114*int(p[2])
+					n++
+					i += 4
+				}
+			}
+			obs[y*w+x] = byte(sum / (n * 1000))
+		}
+	}
+	return obs
+}
@@ -0,0 +1,117 @@
+package rl
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/fogleman/nes/nes"
+)
+
+const smbPath = "../rom/Super_mario_brothers.nes"
+
+func newSMB(t *testing.T, observation ObservationType) *Env {
+	if _, err := os.Stat(smbPath); err != nil {
+		t.Skip("rom not found:", smbPath)
+	}
+	env, err := NewEnv(smbPath, Config{Observation: observation, Task: SuperMarioBros{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+const right = 1<<nes.ButtonRight | 1<<nes.ButtonB
+
+func TestEnv(t *testing.T) {
+	env := newSMB(t, ObserveGray)
+	if env.Console().RAM[smbPlayerState] != 8 {
+		t.Fatal("task did not start the game")
+	}
+	obs, err := env.Reset(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, w, c := env.Shape(); len(obs) != h*w*c || h != 84 || w != 84 {
+		t.Fatalf("got %d bytes for shape %dx%dx%d", len(obs), h, w, c)
+	}
+	total := 0.0
+	done := false
+	steps := 0
+	for ; steps < 500 && !done; steps++ {
+		var reward float64
+		obs, reward, done = env.Step(right, 4)
+		total += reward
+	}
+	if !done || total <= 0 {
+		t.Fatalf("running right: reward %v, done %v after %d steps", total, done, steps)
+	}
+
+	// episodes are deterministic
+	first, _ := env.Reset(nil)
+	again := 0.0
+	for i := 0; i < steps; i++ {
+		_, reward, _ := env.Step(right, 4)
+		again += reward
+	}
+	if again != total {
+		t.Errorf("replay: got reward %v, want %v", again, total)
+	}
+	if second, _ := env.Reset(nil); !bytes.Equal(first, second) {
+		t.Error("reset observations differ")
+	}
+}
+
+func TestResetObservation(t *testing.T) {
+	env := newSMB(t, ObserveRGB)
+	first, err := env.Reset(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		env.Step(right, 4)
+	}
+	second, err := env.Reset(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Error("reset observations differ")
+	}
+}
+
+func TestObservations(t *testing.T) {
+	for _, o := range []ObservationType{ObserveRGB, ObserveIndexed} {
+		env := newSMB(t, o)
+		obs, _, _ := env.Step(0, 1)
+		if h, w, c := env.Shape(); len(obs) != h*w*c || w != 256 {
+			t.Errorf("observation %d: got %d bytes for %dx%dx%d", o, len(obs), h, w, c)
+		}
+	}
+}
+
+func TestVecEnv(t *testing.T) {
+	if _, err := os.Stat(smbPath); err != nil {
+		t.Skip("rom not found:", smbPath)
+	}
+	v, err := NewVecEnv(smbPath, 3, Config{Task: SuperMarioBros{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	rewards := make([]float64, 3)
+	for i := 0; i < 20; i++ {
+		_, r, _, err := v.Step([]byte{right, right, 0}, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := range rewards {
+			rewards[j] += r[j]
+		}
+	}
+	if rewards[0] != rewards[1] || rewards[0] <= 0 || rewards[2] != 0 {
+		t.Errorf("got rewards %v", rewards)
+	}
+}
@@ -0,0 +1,91 @@
+package rl
+
+import "github.com/fogleman/nes/nes"
+
+// Task defines a game's episodes in terms of its RAM.
+type Task interface {
+	// Start brings a console that has just been powered on to where
+	// episodes begin, e.g. past the title screen.
+	Start(console *nes.Console)
+	// Reward scores one frame given RAM before and after it.
+	Reward(prev, ram []byte) float64
+	// Done reports whether the episode is over.
+	Done(ram []byte) bool
+}
+
+// FuncTask is a Task built from functions. A nil StartFunc starts episodes
+// at power-on and a nil DoneFunc never ends them.
+type FuncTask struct {
+	StartFunc  func(console *nes.Console)
+	RewardFunc func(prev, ram []byte) float64
+	DoneFunc   func(ram []byte) bool
+}
+
+func (t FuncTask) Start(console *nes.Console) {
+	if t.StartFunc != nil {
+		t.StartFunc(console)
+	}
+}
+
+func (t FuncTask) Reward(prev, ram []byte) float64 {
+	return t.RewardFunc(prev, ram)
+}
+
+func (t FuncTask) Done(ram []byte) bool {
+	return t.DoneFunc != nil && t.DoneFunc(ram)
+}
+
+// Tasks maps names to the built-in tasks.
+var Tasks = map[string]Task{
+	"smb": SuperMarioBros{},
+}
+
+// Super Mario Bros. RAM addresses
+const (
+	smbPlayerState = 0x000E // 8 while the player has control
+	smbPlayerPage  = 0x006D
+	smbPlayerX     = 0x0086
+	smbPlayerYHigh = 0x00B5 // above 1 once the player falls off screen
+	smbLives       = 0x075A
+	smbOperMode    = 0x0770 // 0 title, 1 playing, 3 game over
+	smbOperTask    = 0x0772 // 3 once the mode has finished setting up
+)
+
+// SuperMarioBros rewards moving right in World 1-1 and onwards. An episode
+// ends when Mario loses a life.
+type SuperMarioBros struct{}
+
+// Start presses Start on the title screen and waits until Mario can move.
+func (SuperMarioBros) Start(console *nes.Console) {
+	for i := 0; i < 600 && console.RAM[smbOperMode] != 1; i++ {
+		var buttons [8]bool
+		buttons[nes.ButtonStart] = i%20 >= 10
+		console.SetButtons1(buttons)
+		console.StepFrame()
+	}
+	console.SetButtons1([8]bool{})
+	ram := console.RAM
+	for i := 0; i < 600 && (ram[smbOperTask] != 3 || ram[smbPlayerState] != 8); i++ {
+		console.StepFrame()
+	}
+}
+
+func (SuperMarioBros) Reward(prev, ram []byte) float64 {
+	x0 := int(prev[smbPlayerPage])<<8 | int(prev[smbPlayerX])
+	x1 := int(ram[smbPlayerPage])<<8 | int(ram[smbPlayerX])
+	dx := x1 - x0
+	if dx < -5 || dx > 5 {
+		dx = 0 // new level or warp
+	}
+	reward := float64(dx)
+	if ram[smbLives] < prev[smbLives] || (prev[smbPlayerState] != 0x0B && ram[smbPlayerState] == 0x0B) {
+		reward -= 15
+	}
+	return reward
+}
+
+func (SuperMarioBros) Done(ram []byte) bool {
+	state := ram[smbPlayerState]
+	return state == 0x0B || state == 0x06 || ram[smbPlayerYHigh] > 1 ||
+		ram[smbOperMode] == 3
+}
@@ -0,0 +1,74 @@
+package rl
+
+import "sync"
+
+// VecEnv steps several environments in parallel, one goroutine each.
+// Environments that finish an episode are reset to their start state, and
+// the observation returned for them is the first of the new episode.
+type VecEnv struct {
+	Envs []*Env
+}
+
+// NewVecEnv creates n environments for the ROM at path.
+func NewVecEnv(path string, n int, config Config) (*VecEnv, error) {
+	v := VecEnv{make([]*Env, n)}
+	err := v.each(func(i int) (err error) {
+		v.Envs[i], err = NewEnv(path, config)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// Reset resets every environment to its start state.
+func (v *VecEnv) Reset() ([][]byte, error) {
+	obs := make([][]byte, len(v.Envs))
+	err := v.each(func(i int) (err error) {
+		obs[i], err = v.Envs[i].Reset(nil)
+		return
+	})
+	return obs, err
+}
+
+// Step applies one action to each environment.
+func (v *VecEnv) Step(actions []byte, frameskip int) ([][]byte, []float64, []bool, error) {
+	n := len(v.Envs)
+	obs := make([][]byte, n)
+	rewards := make([]float64, n)
+	dones := make([]bool, n)
+	err := v.each(func(i int) (err error) {
+		var action byte
+		if i < len(actions) {
+			action = actions[i]
+		}
+		obs[i], rewards[i], dones[i] = v.Envs[i].Step(action, frameskip)
+		if dones[i] {
+			obs[i], err = v.Envs[i].Reset(nil)
+		}
+		return
+	})
+	return obs, rewards, dones, err
+}
+
+// each runs f for every environment index concurrently and returns the
+// first error
+func (v *VecEnv) each(f func(i int) error) error {
+	errs := make([]error, len(v.Envs))
+	var wg sync.WaitGroup
+	for i := range v.Envs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = f(i)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
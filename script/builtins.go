@@ -0,0 +1,166 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+func (in *Interpreter) defineBuiltins() {
+	arith := func(name string, f func(a, b int) (int, error)) {
+		in.Global.Define(Symbol(name), Builtin(func(args []Value) (Value, error) {
+			n, err := ints(name, args, 1, -1)
+			if err != nil {
+				return nil, err
+			}
+			if len(n) == 1 && name == "-" {
+				return -n[0], nil
+			}
+			result := n[0]
+			for _, x := range n[1:] {
+				if result, err = f(result, x); err != nil {
+					return nil, err
+				}
+			}
+			return result, nil
+		}))
+	}
+	arith("+", func(a, b int) (int, error) { return a + b, nil })
+	arith("-", func(a, b int) (int, error) { return a - b, nil })
+	arith("*", func(a, b int) (int, error) { return a * b, nil })
+	arith("/", func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, errors.New("/: division by zero")
+		}
+		return a / b, nil
+	})
+	arith("mod", func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, errors.New("mod: division by zero")
+		}
+		return a % b, nil
+	})
+	arith("band", func(a, b int) (int, error) { return a & b, nil })
+	arith("bor", func(a, b int) (int, error) { return a | b, nil })
+	arith("bxor", func(a, b int) (int, error) { return a ^ b, nil })
+	arith("shl", func(a, b int) (int, error) { return a << uint(b), nil })
+	arith("shr", func(a, b int) (int, error) { return a >> uint(b), nil })
+
+	compare := func(name string, f func(a, b int) bool) {
+		in.Global.Define(Symbol(name), Builtin(func(args []Value) (Value, error) {
+			n, err := ints(name, args, 2, -1)
+			if err != nil {
+				return nil, err
+			}
+			for i := 1; i < len(n); i++ {
+				if !f(n[i-1], n[i]) {
+					return false, nil
+				}
+			}
+			return true, nil
+		}))
+	}
+	compare("=", func(a, b int) bool { return a == b })
+	compare("<", func(a, b int) bool { return a < b })
+	compare(">", func(a, b int) bool { return a > b })
+	compare("<=", func(a, b int) bool { return a <= b })
+	compare(">=", func(a, b int) bool { return a >= b })
+
+	builtins := map[string]Builtin{
+		"not": func(args []Value) (Value, error) {
+			if len(args) != 1 {
+				return nil, errors.New("not: expected 1 argument")
+			}
+			return !Truthy(args[0]), nil
+		},
+		"eq": func(args []Value) (Value, error) {
+			if len(args) != 2 {
+				return nil, errors.New("eq: expected 2 arguments")
+			}
+			return reflect.DeepEqual(args[0], args[1]), nil
+		},
+		"list": func(args []Value) (Value, error) {
+			return List(append([]Value(nil), args...)), nil
+		},
+		"len": func(args []Value) (Value, error) {
+			if len(args) == 1 {
+				switch v := args[0].(type) {
+				case List:
+					return len(v), nil
+				case string:
+					return len(v), nil
+				}
+			}
+			return nil, errors.New("len: expected a list or string")
+		},
+		"nth": func(args []Value) (Value, error) {
+			if len(args) == 2 {
+				list, ok1 := args[0].(List)
+				i, ok2 := args[1].(int)
+				if ok1 && ok2 {
+					if i < 0 || i >= len(list) {
+						return List(nil), nil
+					}
+					return list[i], nil
+				}
+			}
+			return nil, errors.New("nth: expected a list and an index")
+		},
+		"append": func(args []Value) (Value, error) {
+			var result List
+			for _, arg := range args {
+				list, ok := arg.(List)
+				if !ok {
+					return nil, errors.New("append: expected lists")
+				}
+				result = append(result, list...)
+			}
+			return result, nil
+		},
+		"str": func(args []Value) (Value, error) {
+			return join(args, ""), nil
+		},
+		"print": func(args []Value) (Value, error) {
+			fmt.Fprintln(in.output(), join(args, " "))
+			return List(nil), nil
+		},
+	}
+	for name, f := range builtins {
+		in.Global.Define(Symbol(name), f)
+	}
+}
+
+func (in *Interpreter) output() io.Writer {
+	if in.Output == nil {
+		return ioutil.Discard
+	}
+	return in.Output
+}
+
+func join(args []Value, sep string) string {
+	s := make([]string, len(args))
+	for i, arg := range args {
+		s[i] = String(arg)
+	}
+	return strings.Join(s, sep)
+}
+
+// ints checks that args holds between min and max ints; max < 0 means no
+// limit
+func ints(name string, args []Value, min, max int) ([]int, error) {
+	if len(args) < min || max >= 0 && len(args) > max {
+		return nil, fmt.Errorf("%s: wrong number of arguments", name)
+	}
+	result := make([]int, len(args))
+	for i, arg := range args {
+		n, ok := arg.(int)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected a number, got %s", name, String(arg))
+		}
+		result[i] = n
+	}
+	return result, nil
+}
@@ -0,0 +1,70 @@
+package script
+
+// font is a 3x5 pixel font for ASCII 32 through 95. Each glyph is five rows
+// of three pixels; lowercase letters are drawn as uppercase.
+var font = [64]string{
+	"... ... ... ... ...", // ' '
+	".#. .#. .#. ... .#.", // '!'
+	"#.# #.# ... ... ...", // '"'
+	"#.# ### #.# ### #.#", // '#'
+	".## ##. .#. .## ##.", // '$'
+	"#.# ..# .#. #.. #.#", // '%'
+	".#. #.# .#. #.# .##", // '&'
+	".#. .#. ... ... ...", // '\''
+	"..# .#. .#. .#. ..#", // '('
+	"#.. .#. .#. .#. #..", // ')'
+	"... #.# .#. #.# ...", // '*'
+	"... .#. ### .#. ...", // '+'
+	"... ... ... .#. #..", // ','
+	"... ... ### ... ...", // '-'
+	"... ... ... ... .#.", // '.'
+	"..# ..# .#. #.. #..", // '/'
+	"### #.# #.# #.# ###", // '0'
+	".#. ##. .#. .#. ###", // '1'
+	"### ..# ### #.. ###", // '2'
+	"### ..# .## ..# ###", // '3'
+	"#.# #.# ### ..# ..#", // '4'
+	"### #.. ### ..# ###", // '5'
+	"### #.. ### #.# ###", // '6'
+	"### ..# .#. .#. .#.", // '7'
+	"### #.# ### #.# ###", // '8'
+	"### #.# ### ..# ###", // '9'
+	"... .#. ... .#. ...", // ':'
+	"... .#. ... .#. #..", // ';'
+	"..# .#. #.. .#. ..#", // '<'
+	"... ### ... ### ...", // '='
+	"#.. .#. ..# .#. #..", // '>'
+	"### ..# .#. ... .#.", // '?'
+	"### #.# #.# #.. ###", // '@'
+	".#. #.# ### #.# #.#", // 'A'
+	"##. #.# ##. #.# ##.", // 'B'
+	".## #.. #.. #.. .##", // 'C'
+	"##. #.# #.# #.# ##.", // 'D'
+	"### #.. ##. #.. ###", // 'E'
+	"### #.. ##. #.. #..", // 'F'
+	".## #.. #.# #.# .##", // 'G'
+	"#.# #.# ### #.# #.#", // 'H'
+	"### .#. .#. .#. ###", // 'I'
+	"..# ..# ..# #.# .#.", // 'J'
+	"#.# #.# ##. #.# #.#", // 'K'
+	"#.. #.. #.. #.. ###", // 'L'
+	"#.# ### ### #.# #.#", // 'M'
+	"##. #.# #.# #.# #.#", // 'N'
+	".#. #.# #.# #.# .#.", // 'O'
+	"##. #.# ##. #.. #..", // 'P'
+	".#. #.# #.# ### .##", // 'Q'
+	"##. #.# ##. #.# #.#", // 'R'
+	".## #.. .#. ..# ##.", // 'S'
+	"### .#. .#. .#. .#.", // 'T'
+	"#.# #.# #.# #.# ###", // 'U'
+	"#.# #.# #.# #.# .#.", // 'V'
+	"#.# #.# ### ### #.#", // 'W'
+	"#.# #.# .#. #.# #.#", // 'X'
+	"#.# #.# .#. .#. .#.", // 'Y'
+	"### ..# .#. #.. ###", // 'Z'
+	"##. #.. #.. #.. ##.", // '['
+	"#.. #.. .#. ..# ..#", // '\\'
+	".## ..# ..# ..# .##", // ']'
+	".#. #.# ... ... ...", // '^'
+	"... ... ... ... ###", // '_'
+}
@@ -0,0 +1,521 @@
+// Package script runs small Lisp programs against a console, in the spirit
+// of the Lua scripting found in other emulators. See Script for the
+// functions available to scripts.
+package script
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/nes/nes"
+)
+
+// Value is a Lisp value: int, string, bool, Symbol, List, *Lambda or
+// Builtin.
+type Value interface{}
+
+type Symbol string
+
+// List is a Lisp list. The empty list, written nil, is false.
+type List []Value
+
+// Builtin is a function implemented in Go.
+type Builtin func(args []Value) (Value, error)
+
+// Lambda is a function defined by a script.
+type Lambda struct {
+	name   string
+	params []Symbol
+	body   []Value
+	env    *Env
+}
+
+// Env maps symbols to values, falling back to its parent.
+type Env struct {
+	vars   map[Symbol]Value
+	parent *Env
+}
+
+func NewEnv(parent *Env) *Env {
+	return &Env{make(map[Symbol]Value), parent}
+}
+
+func (e *Env) Get(name Symbol) (Value, bool) {
+	for ; e != nil; e = e.parent {
+		if v, ok := e.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (e *Env) Define(name Symbol, value Value) {
+	e.vars[name] = value
+}
+
+// set assigns to an existing variable
+func (e *Env) set(name Symbol, value Value) bool {
+	for ; e != nil; e = e.parent {
+		if _, ok := e.vars[name]; ok {
+			e.vars[name] = value
+			return true
+		}
+	}
+	return false
+}
+
+// Parse reads all expressions in src. Numbers are written as in the
+// debugger: 10, $0A or 0x0A. Comments start with ";".
+func Parse(src string) ([]Value, error) {
+	p := parser{src: src}
+	var result []Value
+	for {
+		p.skip()
+		if p.pos >= len(p.src) {
+			return result, nil
+		}
+		v, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+}
+
+type parser struct {
+	src  string
+	pos  int
+	line int
+}
+
+// skip skips whitespace and comments
+func (p *parser) skip() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ';':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", p.line+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) parse() (Value, error) {
+	p.skip()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unexpected end of input")
+	}
+	switch c := p.src[p.pos]; c {
+	case '(':
+		p.pos++
+		list := List{}
+		for {
+			p.skip()
+			if p.pos >= len(p.src) {
+				return nil, p.errorf("missing )")
+			}
+			if p.src[p.pos] == ')' {
+				p.pos++
+				return list, nil
+			}
+			v, err := p.parse()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+	case ')':
+		return nil, p.errorf("unexpected )")
+	case '\'':
+		p.pos++
+		v, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		return List{Symbol("quote"), v}, nil
+	case '"':
+		start := p.pos
+		for p.pos++; p.pos < len(p.src) && p.src[p.pos] != '"'; p.pos++ {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+		}
+		if p.pos >= len(p.src) {
+			return nil, p.errorf("unterminated string")
+		}
+		p.pos++
+		s, err := strconv.Unquote(p.src[start:p.pos])
+		if err != nil {
+			return nil, p.errorf("invalid string %s", p.src[start:p.pos])
+		}
+		return s, nil
+	}
+	start := p.pos
+	for p.pos < len(p.src) && !strings.ContainsRune(" \t\r\n();\"'", rune(p.src[p.pos])) {
+		p.pos++
+	}
+	atom := p.src[start:p.pos]
+	switch atom {
+	case "#t":
+		return true, nil
+	case "#f":
+		return false, nil
+	case "nil":
+		return List(nil), nil
+	}
+	if n, err := nes.ParseNumber(atom); err == nil {
+		return n, nil
+	}
+	return Symbol(atom), nil
+}
+
+// maxDepth limits recursion so runaway scripts fail instead of crashing
+const maxDepth = 10000
+
+// Interpreter evaluates expressions in a global environment.
+type Interpreter struct {
+	Global *Env
+	Output io.Writer // receives the output of print; nil discards it
+	depth  int
+}
+
+func NewInterpreter() *Interpreter {
+	in := Interpreter{Global: NewEnv(nil)}
+	in.defineBuiltins()
+	return &in
+}
+
+// Run parses and evaluates src, returning the value of the last expression.
+func (in *Interpreter) Run(src string) (Value, error) {
+	exprs, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	var result Value
+	for _, expr := range exprs {
+		if result, err = in.Eval(expr, in.Global); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Truthy reports whether v counts as true: everything except #f and nil.
+func Truthy(v Value) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case List:
+		return len(v) > 0
+	}
+	return true
+}
+
+func (in *Interpreter) Eval(expr Value, env *Env) (Value, error) {
+	switch x := expr.(type) {
+	case Symbol:
+		v, ok := env.Get(x)
+		if !ok {
+			return nil, fmt.Errorf("undefined: %s", x)
+		}
+		return v, nil
+	case List:
+		if len(x) == 0 {
+			return x, nil
+		}
+		if name, ok := x[0].(Symbol); ok {
+			if form, ok := specialForms[name]; ok {
+				return form(in, x[1:], env)
+			}
+		}
+		fn, err := in.Eval(x[0], env)
+		if err != nil {
+			return nil, err
+		}
+		args := make([]Value, len(x)-1)
+		for i, arg := range x[1:] {
+			if args[i], err = in.Eval(arg, env); err != nil {
+				return nil, err
+			}
+		}
+		return in.Apply(fn, args)
+	}
+	return expr, nil
+}
+
+// Apply calls a Builtin or Lambda.
+func (in *Interpreter) Apply(fn Value, args []Value) (Value, error) {
+	switch f := fn.(type) {
+	case Builtin:
+		return f(args)
+	case *Lambda:
+		if len(args) != len(f.params) {
+			return nil, fmt.Errorf("%s: expected %d arguments, got %d",
+				f, len(f.params), len(args))
+		}
+		if in.depth >= maxDepth {
+			return nil, errors.New("maximum recursion depth exceeded")
+		}
+		in.depth++
+		defer func() { in.depth-- }()
+		env := NewEnv(f.env)
+		for i, param := range f.params {
+			env.Define(param, args[i])
+		}
+		return in.evalBody(f.body, env)
+	}
+	return nil, fmt.Errorf("not a function: %s", String(fn))
+}
+
+func (in *Interpreter) evalBody(body []Value, env *Env) (Value, error) {
+	var result Value = List(nil)
+	var err error
+	for _, expr := range body {
+		if result, err = in.Eval(expr, env); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (f *Lambda) String() string {
+	if f.name == "" {
+		return "<lambda>"
+	}
+	return "<" + f.name + ">"
+}
+
+// String formats a value the way print shows it.
+func String(v Value) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case bool:
+		if v {
+			return "#t"
+		}
+		return "#f"
+	case List:
+		if len(v) == 0 {
+			return "nil"
+		}
+		s := make([]string, len(v))
+		for i, x := range v {
+			if str, ok := x.(string); ok {
+				s[i] = strconv.Quote(str)
+			} else {
+				s[i] = String(x)
+			}
+		}
+		return "(" + strings.Join(s, " ") + ")"
+	case Builtin:
+		return "<builtin>"
+	}
+	return fmt.Sprint(v)
+}
+
+type specialForm func(in *Interpreter, args []Value, env *Env) (Value, error)
+
+var specialForms map[Symbol]specialForm
+
+func init() {
+	specialForms = map[Symbol]specialForm{
+		"quote":  formQuote,
+		"if":     formIf,
+		"define": formDefine,
+		"set!":   formSet,
+		"lambda": formLambda,
+		"let":    formLet,
+		"begin":  formBegin,
+		"while":  formWhile,
+		"and":    formAnd,
+		"or":     formOr,
+	}
+}
+
+func formQuote(in *Interpreter, args []Value, env *Env) (Value, error) {
+	if len(args) != 1 {
+		return nil, errors.New("quote: expected 1 argument")
+	}
+	return args[0], nil
+}
+
+// (if COND THEN [ELSE])
+func formIf(in *Interpreter, args []Value, env *Env) (Value, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("if: expected 2 or 3 arguments")
+	}
+	cond, err := in.Eval(args[0], env)
+	if err != nil {
+		return nil, err
+	}
+	if Truthy(cond) {
+		return in.Eval(args[1], env)
+	}
+	if len(args) == 3 {
+		return in.Eval(args[2], env)
+	}
+	return List(nil), nil
+}
+
+// (define NAME VALUE) or (define (NAME PARAMS...) BODY...)
+func formDefine(in *Interpreter, args []Value, env *Env) (Value, error) {
+	if len(args) < 2 {
+		return nil, errors.New("define: expected a name and a value")
+	}
+	if sig, ok := args[0].(List); ok && len(sig) > 0 {
+		name, ok := sig[0].(Symbol)
+		if !ok {
+			return nil, errors.New("define: invalid function name")
+		}
+		f, err := newLambda(string(name), sig[1:], args[1:], env)
+		if err != nil {
+			return nil, err
+		}
+		env.Define(name, f)
+		return f, nil
+	}
+	name, ok := args[0].(Symbol)
+	if !ok || len(args) != 2 {
+		return nil, errors.New("define: expected a name and a value")
+	}
+	v, err := in.Eval(args[1], env)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := v.(*Lambda); ok && f.name == "" {
+		f.name = string(name)
+	}
+	env.Define(name, v)
+	return v, nil
+}
+
+// (set! NAME VALUE)
+func formSet(in *Interpreter, args []Value, env *Env) (Value, error) {
+	if len(args) != 2 {
+		return nil, errors.New("set!: expected a name and a value")
+	}
+	name, ok := args[0].(Symbol)
+	if !ok {
+		return nil, errors.New("set!: expected a name and a value")
+	}
+	v, err := in.Eval(args[1], env)
+	if err != nil {
+		return nil, err
+	}
+	if !env.set(name, v) {
+		return nil, fmt.Errorf("set!: undefined: %s", name)
+	}
+	return v, nil
+}
+
+// (lambda (PARAMS...) BODY...)
+func formLambda(in *Interpreter, args []Value, env *Env) (Value, error) {
+	if len(args) < 1 {
+		return nil, errors.New("lambda: expected parameters")
+	}
+	params, ok := args[0].(List)
+	if !ok {
+		return nil, errors.New("lambda: expected a parameter list")
+	}
+	return newLambda("", params, args[1:], env)
+}
+
+func newLambda(name string, params List, body []Value, env *Env) (*Lambda, error) {
+	f := Lambda{name: name, body: body, env: env}
+	for _, p := range params {
+		s, ok := p.(Symbol)
+		if !ok {
+			return nil, fmt.Errorf("invalid parameter: %s", String(p))
+		}
+		f.params = append(f.params, s)
+	}
+	return &f, nil
+}
+
+// (let ((NAME VALUE)...) BODY...)
+func formLet(in *Interpreter, args []Value, env *Env) (Value, error) {
+	if len(args) < 1 {
+		return nil, errors.New("let: expected bindings")
+	}
+	bindings, ok := args[0].(List)
+	if !ok {
+		return nil, errors.New("let: expected a binding list")
+	}
+	local := NewEnv(env)
+	for _, b := range bindings {
+		pair, ok := b.(List)
+		if !ok || len(pair) != 2 {
+			return nil, errors.New("let: expected (name value)")
+		}
+		name, ok := pair[0].(Symbol)
+		if !ok {
+			return nil, errors.New("let: expected (name value)")
+		}
+		v, err := in.Eval(pair[1], env)
+		if err != nil {
+			return nil, err
+		}
+		local.Define(name, v)
+	}
+	return in.evalBody(args[1:], local)
+}
+
+func formBegin(in *Interpreter, args []Value, env *Env) (Value, error) {
+	return in.evalBody(args, env)
+}
+
+// (while COND BODY...)
+func formWhile(in *Interpreter, args []Value, env *Env) (Value, error) {
+	if len(args) < 1 {
+		return nil, errors.New("while: expected a condition")
+	}
+	for {
+		cond, err := in.Eval(args[0], env)
+		if err != nil {
+			return nil, err
+		}
+		if !Truthy(cond) {
+			return List(nil), nil
+		}
+		if _, err := in.evalBody(args[1:], env); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func formAnd(in *Interpreter, args []Value, env *Env) (Value, error) {
+	var result Value = true
+	var err error
+	for _, arg := range args {
+		if result, err = in.Eval(arg, env); err != nil || !Truthy(result) {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+func formOr(in *Interpreter, args []Value, env *Env) (Value, error) {
+	var result Value = false
+	var err error
+	for _, arg := range args {
+		if result, err = in.Eval(arg, env); err != nil || Truthy(result) {
+			return result, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,522 @@
+package script
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/nes/nes"
+)
+
+var buttonNames = []string{
+	"a", "b", "select", "start", "up", "down", "left", "right"}
+
+var colorNames = map[string]color.RGBA{
+	"white":   {255, 255, 255, 255},
+	"black":   {0, 0, 0, 255},
+	"gray":    {128, 128, 128, 255},
+	"red":     {255, 0, 0, 255},
+	"green":   {0, 255, 0, 255},
+	"blue":    {0, 0, 255, 255},
+	"yellow":  {255, 255, 0, 255},
+	"cyan":    {0, 255, 255, 255},
+	"magenta": {255, 0, 255, 255},
+	"orange":  {255, 128, 0, 255},
+}
+
+// Script runs a program against a console. Besides the core language (see
+// Interpreter), scripts can call:
+//
+//	(read ADDR) (read16 ADDR)   read memory without side effects
+//	(write ADDR VALUE)          write memory
+//	(reg NAME)                  CPU register: a, x, y, sp, p or pc
+//	(frame)                     frame number
+//	(joypad PLAYER)             buttons held, e.g. (a right)
+//	(joypad PLAYER BUTTONS)     hold buttons: a b select start up down left right
+//	(text X Y STRING [COLOR])   draw on the frame
+//	(box X Y W H [COLOR])       draw a rectangle
+//	(fill X Y W H [COLOR])      fill a rectangle
+//	(line X1 Y1 X2 Y2 [COLOR])  draw a line
+//	(pixel X Y [COLOR])         draw a pixel
+//	(on-frame FN)               call (FN) at the end of each frame
+//	(on-exec ADDR FN)           call (FN) before the CPU executes ADDR
+//	(on-write ADDR FN)          call (FN ADDR VALUE) after writes to ADDR
+//	(save-state SLOT)           save the console state in memory
+//	(load-state SLOT)           restore a state saved by save-state
+//
+// save-state and load-state raise an error in on-exec and on-write
+// functions, which run in the middle of a CPU instruction.
+//
+// Colors are "#rrggbb", "#rrggbbaa", a name such as "red" or a number
+// $RRGGBB; the default is white. Drawing is composited onto the finished
+// frame at the end of the frame it was done in, so overlays that should stay
+// visible must be redrawn from an on-frame function.
+type Script struct {
+	console *nes.Console
+	in      *Interpreter
+	overlay []func(im *image.RGBA)
+	frame   []Value
+	states  map[int][]byte
+	inStep  bool // running an on-exec or on-write function, mid-instruction
+	err     error
+	remove  []func() // removes the console hooks
+}
+
+// New creates a script environment for console.
+func New(console *nes.Console) *Script {
+	s := Script{console: console, in: NewInterpreter(), states: make(map[int][]byte)}
+	s.defineBuiltins()
+	s.remove = append(s.remove, console.OnFrame(s.endFrame))
+	return &s
+}
+
+// SetOutput sets the writer that receives the output of print.
+func (s *Script) SetOutput(w io.Writer) {
+	s.in.Output = w
+}
+
+// Run evaluates src.
+func (s *Script) Run(src string) error {
+	_, err := s.in.Run(src)
+	return err
+}
+
+// RunFile evaluates the script in a file.
+func (s *Script) RunFile(path string) error {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return s.Run(string(src))
+}
+
+// Err returns the first error raised by a callback. Callbacks stop running
+// after an error.
+func (s *Script) Err() error {
+	return s.err
+}
+
+// Stop removes the script's hooks from the console.
+func (s *Script) Stop() {
+	for _, remove := range s.remove {
+		remove()
+	}
+	s.remove = nil
+}
+
+// call runs a callback, recording the first error
+func (s *Script) call(fn Value, args ...Value) {
+	if s.err != nil {
+		return
+	}
+	if _, err := s.in.Apply(fn, args); err != nil {
+		s.err = err
+	}
+}
+
+func (s *Script) endFrame() {
+	for _, fn := range s.frame {
+		s.call(fn)
+	}
+	im := s.console.Buffer()
+	for _, draw := range s.overlay {
+		draw(im)
+	}
+	s.overlay = s.overlay[:0]
+}
+
+func (s *Script) draw(f func(im *image.RGBA)) {
+	s.overlay = append(s.overlay, f)
+}
+
+func (s *Script) defineBuiltins() {
+	builtins := map[string]Builtin{
+		"read":       s.read,
+		"read16":     s.read16,
+		"write":      s.write,
+		"reg":        s.reg,
+		"frame":      s.frameNumber,
+		"joypad":     s.joypad,
+		"text":       s.text,
+		"box":        s.box,
+		"fill":       s.fill,
+		"line":       s.line,
+		"pixel":      s.pixel,
+		"on-frame":   s.onFrame,
+		"on-exec":    s.onExec,
+		"on-write":   s.onWrite,
+		"save-state": s.saveState,
+		"load-state": s.loadState,
+	}
+	for name, f := range builtins {
+		s.in.Global.Define(Symbol(name), f)
+	}
+}
+
+func (s *Script) read(args []Value) (Value, error) {
+	n, err := ints("read", args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	return int(s.console.Peek(uint16(n[0]))), nil
+}
+
+func (s *Script) read16(args []Value) (Value, error) {
+	n, err := ints("read16", args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	address := uint16(n[0])
+	lo := int(s.console.Peek(address))
+	hi := int(s.console.Peek(address + 1))
+	return hi<<8 | lo, nil
+}
+
+func (s *Script) write(args []Value) (Value, error) {
+	n, err := ints("write", args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	s.console.Poke(uint16(n[0]), byte(n[1]))
+	return List(nil), nil
+}
+
+func (s *Script) reg(args []Value) (Value, error) {
+	if len(args) != 1 {
+		return nil, errors.New("reg: expected a register name")
+	}
+	cpu := s.console.CPU
+	switch strings.ToLower(String(args[0])) {
+	case "a":
+		return int(cpu.A), nil
+	case "x":
+		return int(cpu.X), nil
+	case "y":
+		return int(cpu.Y), nil
+	case "sp":
+		return int(cpu.SP), nil
+	case "p":
+		return int(cpu.Flags()), nil
+	case "pc":
+		return int(cpu.PC), nil
+	}
+	return nil, fmt.Errorf("reg: unknown register %s", String(args[0]))
+}
+
+func (s *Script) frameNumber(args []Value) (Value, error) {
+	return int(s.console.PPU.Frame), nil
+}
+
+func (s *Script) controller(player int) (*nes.Controller, error) {
+	switch player {
+	case 1:
+		return s.console.Controller1, nil
+	case 2:
+		return s.console.Controller2, nil
+	}
+	return nil, fmt.Errorf("joypad: invalid player %d", player)
+}
+
+func (s *Script) joypad(args []Value) (Value, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, errors.New("joypad: expected a player and buttons")
+	}
+	player, ok := args[0].(int)
+	if !ok {
+		return nil, errors.New("joypad: expected a player number")
+	}
+	controller, err := s.controller(player)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 1 {
+		var held List
+		for i, pressed := range controller.Buttons() {
+			if pressed {
+				held = append(held, Symbol(buttonNames[i]))
+			}
+		}
+		return held, nil
+	}
+	list, ok := args[1].(List)
+	if !ok {
+		return nil, errors.New("joypad: expected a list of buttons")
+	}
+	var buttons [8]bool
+	for _, b := range list {
+		name := strings.ToLower(String(b))
+		found := false
+		for i, n := range buttonNames {
+			if n == name {
+				buttons[i] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("joypad: unknown button %s", name)
+		}
+	}
+	if player == 1 {
+		s.console.SetButtons1(buttons)
+	} else {
+		s.console.SetButtons2(buttons)
+	}
+	return List(nil), nil
+}
+
+// shape parses n numbers followed by an optional color
+func shape(name string, args []Value, n int) ([]int, color.RGBA, error) {
+	c := colorNames["white"]
+	if len(args) == n+1 {
+		var err error
+		if c, err = parseColor(args[n]); err != nil {
+			return nil, c, fmt.Errorf("%s: %v", name, err)
+		}
+		args = args[:n]
+	}
+	values, err := ints(name, args, n, n)
+	return values, c, err
+}
+
+func parseColor(v Value) (color.RGBA, error) {
+	switch v := v.(type) {
+	case int:
+		return color.RGBA{byte(v >> 16), byte(v >> 8), byte(v), 255}, nil
+	case string, Symbol:
+		name := strings.ToLower(String(v))
+		if c, ok := colorNames[name]; ok {
+			return c, nil
+		}
+		if strings.HasPrefix(name, "#") && (len(name) == 7 || len(name) == 9) {
+			if n, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+				if len(name) == 7 {
+					n = n<<8 | 0xFF
+				}
+				return color.RGBA{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}, nil
+			}
+		}
+	}
+	return color.RGBA{}, fmt.Errorf("invalid color %s", String(v))
+}
+
+// blend draws c over the pixel at x, y
+func blend(im *image.RGBA, x, y int, c color.RGBA) {
+	if !(image.Point{x, y}.In(im.Rect)) {
+		return
+	}
+	i := im.PixOffset(x, y)
+	a := int(c.A)
+	p := im.Pix[i : i+4]
+	p[0] = byte((int(c.R)*a + int(p[0])*(255-a)) / 255)
+	p[1] = byte((int(c.G)*a + int(p[1])*(255-a)) / 255)
+	p[2] = byte((int(c.B)*a + int(p[2])*(255-a)) / 255)
+	p[3] = 255
+}
+
+func (s *Script) text(args []Value) (Value, error) {
+	if len(args) < 3 {
+		return nil, errors.New("text: expected x, y and text")
+	}
+	str := String(args[2])
+	args = append(args[:2:2], args[3:]...)
+	n, c, err := shape("text", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	s.draw(func(im *image.RGBA) {
+		x, y := n[0], n[1]
+		for _, ch := range strings.ToUpper(str) {
+			if ch == '\n' {
+				x, y = n[0], y+6
+				continue
+			}
+			if ch >= 32 && ch < 96 {
+				rows := strings.Fields(font[ch-32])
+				for dy, row := range rows {
+					for dx, p := range row {
+						if p == '#' {
+							blend(im, x+dx, y+dy, c)
+						}
+					}
+				}
+			}
+			x += 4
+		}
+	})
+	return List(nil), nil
+}
+
+func (s *Script) box(args []Value) (Value, error) {
+	n, c, err := shape("box", args, 4)
+	if err != nil {
+		return nil, err
+	}
+	s.draw(func(im *image.RGBA) {
+		x, y, w, h := n[0], n[1], n[2], n[3]
+		for i := 0; i < w; i++ {
+			blend(im, x+i, y, c)
+			if h > 1 {
+				blend(im, x+i, y+h-1, c)
+			}
+		}
+		for j := 1; j < h-1; j++ {
+			blend(im, x, y+j, c)
+			if w > 1 {
+				blend(im, x+w-1, y+j, c)
+			}
+		}
+	})
+	return List(nil), nil
+}
+
+func (s *Script) fill(args []Value) (Value, error) {
+	n, c, err := shape("fill", args, 4)
+	if err != nil {
+		return nil, err
+	}
+	s.draw(func(im *image.RGBA) {
+		for j := 0; j < n[3]; j++ {
+			for i := 0; i < n[2]; i++ {
+				blend(im, n[0]+i, n[1]+j, c)
+			}
+		}
+	})
+	return List(nil), nil
+}
+
+func (s *Script) line(args []Value) (Value, error) {
+	n, c, err := shape("line", args, 4)
+	if err != nil {
+		return nil, err
+	}
+	s.draw(func(im *image.RGBA) {
+		x0, y0, x1, y1 := n[0], n[1], n[2], n[3]
+		dx, dy := abs(x1-x0), -abs(y1-y0)
+		sx, sy := sign(x1-x0), sign(y1-y0)
+		e := dx + dy
+		for {
+			blend(im, x0, y0, c)
+			if x0 == x1 && y0 == y1 {
+				return
+			}
+			if 2*e >= dy {
+				e += dy
+				x0 += sx
+			}
+			if 2*e <= dx {
+				e += dx
+				y0 += sy
+			}
+		}
+	})
+	return List(nil), nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func sign(x int) int {
+	if x < 0 {
+		return -1
+	}
+	return 1
+}
+
+func (s *Script) pixel(args []Value) (Value, error) {
+	n, c, err := shape("pixel", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	s.draw(func(im *image.RGBA) {
+		blend(im, n[0], n[1], c)
+	})
+	return List(nil), nil
+}
+
+func (s *Script) onFrame(args []Value) (Value, error) {
+	if len(args) != 1 {
+		return nil, errors.New("on-frame: expected a function")
+	}
+	s.frame = append(s.frame, args[0])
+	return List(nil), nil
+}
+
+func (s *Script) onExec(args []Value) (Value, error) {
+	if len(args) != 2 {
+		return nil, errors.New("on-exec: expected an address and a function")
+	}
+	address, ok := args[0].(int)
+	if !ok {
+		return nil, errors.New("on-exec: expected an address")
+	}
+	fn := args[1]
+	s.remove = append(s.remove, s.console.OnExecute(uint16(address), func() {
+		s.inStep = true
+		s.call(fn)
+		s.inStep = false
+	}))
+	return List(nil), nil
+}
+
+func (s *Script) onWrite(args []Value) (Value, error) {
+	if len(args) != 2 {
+		return nil, errors.New("on-write: expected an address and a function")
+	}
+	address, ok := args[0].(int)
+	if !ok {
+		return nil, errors.New("on-write: expected an address")
+	}
+	fn := args[1]
+	s.remove = append(s.remove, s.console.OnWrite(uint16(address), func(address uint16, value byte) {
+		s.inStep = true
+		s.call(fn, int(address), int(value))
+		s.inStep = false
+	}))
+	return List(nil), nil
+}
+
+func (s *Script) saveState(args []Value) (Value, error) {
+	n, err := ints("save-state", args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if s.inStep {
+		return nil, errors.New("save-state: not allowed in on-exec and on-write functions")
+	}
+	var buf bytes.Buffer
+	if err := s.console.Save(gob.NewEncoder(&buf)); err != nil {
+		return nil, err
+	}
+	s.states[n[0]] = buf.Bytes()
+	return List(nil), nil
+}
+
+func (s *Script) loadState(args []Value) (Value, error) {
+	n, err := ints("load-state", args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if s.inStep {
+		// the CPU is part way through an instruction
+		return nil, errors.New("load-state: not allowed in on-exec and on-write functions")
+	}
+	state, ok := s.states[n[0]]
+	if !ok {
+		return false, nil
+	}
+	if err := s.console.Load(gob.NewDecoder(bytes.NewReader(state))); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
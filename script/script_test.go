@@ -0,0 +1,163 @@
+package script
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/fogleman/nes/internal/testrom"
+	"github.com/fogleman/nes/nes"
+)
+
+func TestInterpreter(t *testing.T) {
+	tests := []struct {
+		src    string
+		result string
+	}{
+		{"(+ 1 2 (* 3 4))", "15"},
+		{"(- 5)", "-5"},
+		{"(band $FF 0x0F)", "15"},
+		{"(define (fact n) (if (<= n 1) 1 (* n (fact (- n 1))))) (fact 5)", "120"},
+		{"(let ((a 1) (b 2)) (list a b \"c\"))", `(1 2 "c")`},
+		{"(define i 0) (while (< i 10) (set! i (+ i 1))) i", "10"},
+		{"(str \"x=\" 3)", "x=3"},
+		{"(and 1 #f 2)", "#f"},
+		{"(or nil 2)", "2"},
+		{"(if () 1 2)", "2"},
+		{"(nth '(a b c) 1)", "b"},
+		{"(eq '(1 2) (list 1 2))", "#t"},
+	}
+	for _, test := range tests {
+		v, err := NewInterpreter().Run(test.src)
+		if err != nil {
+			t.Errorf("%s: %v", test.src, err)
+			continue
+		}
+		if s := String(v); s != test.result {
+			t.Errorf("%s: got %s, want %s", test.src, s, test.result)
+		}
+	}
+	for _, src := range []string{"(", ")", "(undefined)", "(/ 1 0)", "(define (f) (f)) (f)"} {
+		if _, err := NewInterpreter().Run(src); err == nil {
+			t.Errorf("%s: expected error", src)
+		}
+	}
+}
+
+// program stores an incrementing counter to $0300 and calls a subroutine at
+// $8010 every iteration
+var program = []byte{
+	0xA2, 0x00, // 8000 LDX #$00
+	0x20, 0x10, 0x80, // 8002 JSR $8010
+	0xE8,             // 8005 INX
+	0x8E, 0x00, 0x03, // 8006 STX $0300
+	0x4C, 0x02, 0x80, // 8009 JMP $8002
+	0, 0, 0, 0,
+	0xA9, 0x10, // 8010 LDA #$10
+	0x85, 0x10, // 8012 STA $10
+	0x60, // 8014 RTS
+}
+
+func newTestConsole(t *testing.T) *nes.Console {
+	console, err := nes.NewConsoleFromBytes(testrom.NROM(program))
+	if err != nil {
+		t.Fatal(err)
+	}
+	console.Reset()
+	return console
+}
+
+func TestScript(t *testing.T) {
+	console := newTestConsole(t)
+	s := New(console)
+	err := s.Run(`
+		(define writes 0)
+		(define calls 0)
+		(define last 0)
+		(on-write $0300 (lambda (addr value) (set! writes (+ writes 1)) (set! last value)))
+		(on-exec $8010 (lambda () (set! calls (+ calls 1))))
+		(on-frame (lambda ()
+			(fill 0 0 4 4 "red")
+			(text 10 10 "Hi" "#00ff00")
+			(joypad 1 '(a right))))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	console.StepFrame()
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	v, _ := s.in.Run("(list writes calls (= last (read $0300)))")
+	list := v.(List)
+	if list[0].(int) == 0 || list[1] != list[0] || list[2] != true {
+		t.Errorf("got %s", String(v))
+	}
+	im := console.Buffer()
+	if c := im.RGBAAt(1, 1); c != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("overlay pixel: got %v", c)
+	}
+	if c := im.RGBAAt(10, 10); c != (color.RGBA{0, 255, 0, 255}) {
+		t.Errorf("text pixel: got %v", c)
+	}
+	if v, _ := s.in.Run("(joypad 1)"); String(v) != "(a right)" {
+		t.Errorf("joypad: got %s", String(v))
+	}
+
+	if err := s.Run("(save-state 1) (write $0300 $42)"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.in.Run("(load-state 1) (read $0300)"); err != nil || v == 0x42 {
+		t.Errorf("load-state: got %v, %v", v, err)
+	}
+
+	s.Stop()
+	console.StepFrame()
+	if v, _ := s.in.Run("calls"); v != list[1] {
+		t.Error("hooks ran after Stop")
+	}
+}
+
+func TestScriptStateInHook(t *testing.T) {
+	console := newTestConsole(t)
+	s := New(console)
+	err := s.Run("(save-state 1) (on-exec $8010 (lambda () (load-state 1)))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ppu := console.PPU
+	dot := func() int {
+		return (int(ppu.Frame)*262+ppu.ScanLine)*341 + ppu.Cycle
+	}
+	cycles, dots := console.CPU.Cycles, dot()
+	total := 0
+	for i := 0; i < 100; i++ {
+		// the APU is stepped once per cycle returned
+		n := console.Step()
+		if n < 1 || n > 7 {
+			t.Fatalf("step %d took %d cycles", i, n)
+		}
+		total += n
+	}
+	if console.CPU.Cycles-cycles != uint64(total) || dot()-dots != 3*total {
+		t.Errorf("ran %d cycles: CPU %d, PPU %d dots",
+			total, console.CPU.Cycles-cycles, dot()-dots)
+	}
+	if err := s.Err(); err == nil || !strings.Contains(err.Error(), "load-state") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestScriptError(t *testing.T) {
+	console := newTestConsole(t)
+	s := New(console)
+	if err := s.Run("(on-frame (lambda () (undefined)))"); err != nil {
+		t.Fatal(err)
+	}
+	console.StepFrame()
+	if s.Err() == nil {
+		t.Error("expected error from callback")
+	}
+	if err := s.Run("(text 0 0)"); err == nil {
+		t.Error("expected error for missing text")
+	}
+}
@@ -0,0 +1,71 @@
+package ui
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/fogleman/nes/achievement"
+	"github.com/fogleman/nes/nes"
+)
+
+func achievementPath(hash string) string {
+	return homeDir + "/.nes/achievements/" + hash + ".json"
+}
+
+func unlockedPath(hash string) string {
+	return homeDir + "/.nes/achievements/" + hash + ".unlocked"
+}
+
+// unlockedSink records unlocked achievement IDs, one per line, so they stay
+// unlocked in later sessions
+type unlockedSink struct {
+	path string
+}
+
+func (s *unlockedSink) Unlock(u achievement.Unlock) error {
+	dir, _ := path.Split(s.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = fmt.Fprintln(file, u.ID)
+	return err
+}
+
+func readUnlocked(hash string) []string {
+	data, err := ioutil.ReadFile(unlockedPath(hash))
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(data))
+}
+
+// startAchievements tracks the achievements defined for the game, if any,
+// replacing the engine of any previous game
+func (d *Director) startAchievements(console *nes.Console, hash string) {
+	if d.achievements != nil {
+		d.achievements.Close()
+		d.achievements = nil
+	}
+	set, err := achievement.LoadFile(achievementPath(hash))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println(err)
+		}
+		return
+	}
+	sink := achievement.MultiSink{
+		&achievement.LogSink{}, &unlockedSink{unlockedPath(hash)}}
+	if d.webhook != "" {
+		sink = append(sink, &achievement.WebhookSink{URL: d.webhook})
+	}
+	d.achievements = achievement.NewEngine(console, set, hash, sink, readUnlocked(hash))
+}
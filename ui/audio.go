@@ -4,6 +4,8 @@ import (
    "encoding/binary"
    "fmt"
    "math"
+
+   "github.com/fogleman/nes/nes"
    "github.com/mesilliac/pulse-simple"
 )
 
@@ -11,12 +13,12 @@ type Audio struct {
    stream         *pulse.Stream
    sampleRate     float64
    outputChannels int
-   channel        chan float32
+   buffer         *nes.AudioBuffer
 }
 
 func NewAudio() *Audio {
    a := Audio{}
-   a.channel = make(chan float32, 4096)
+   a.buffer = nes.NewAudioBuffer(8192)
    return &a
 }
 
@@ -25,7 +27,7 @@ func (a *Audio) Start() error {
    ss := pulse.SampleSpec{
       Format:   pulse.SAMPLE_FLOAT32LE,
       Rate:     44100,
-      Channels: 1,
+      Channels: 2,
    }
    stream, err := pulse.Playback("Simple Playback", "Audio Stream", &ss)
    if err != nil {
@@ -41,20 +43,22 @@ func (a *Audio) Start() error {
 }
 
 func (a *Audio) play() {
+   buf := make([]float32, 2048)
+   byteBuf := make([]byte, len(buf)*4)
+   var left, right float32
    for {
-      // 오디오 데이터를 채널에서 읽어서 스트림에 씁니다.
-      buf := make([]float32, 1024)
-      for i := range buf {
-         select {
-         case sample := <-a.channel:
-            buf[i] = sample
-         default:
-            buf[i] = 0
-         }
+      // 오디오 데이터를 링 버퍼에서 읽어서 스트림에 씁니다.
+      n := a.buffer.Read(buf)
+      if n > 0 {
+         left, right = buf[n-2], buf[n-1]
+      }
+      // on underrun hold the last frame instead of dropping to zero,
+      // which would be an audible click
+      for i := n; i < len(buf); i += 2 {
+         buf[i], buf[i+1] = left, right
       }
 
       // []float32를 []byte로 변환
-      byteBuf := make([]byte, len(buf)*4)
       for i, sample := range buf {
          binary.LittleEndian.PutUint32(byteBuf[i*4:], math.Float32bits(sample))
       }
@@ -63,6 +67,10 @@ func (a *Audio) play() {
    }
 }
 
+func (a *Audio) Stats() nes.AudioStats {
+   return a.buffer.Stats()
+}
+
 func (a *Audio) Stop() error {
    if a.stream != nil {
       a.stream.Free()
@@ -0,0 +1,95 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type controlParams struct {
+	Code    string  `json:"code"`
+	Name    string  `json:"name"`
+	Enabled bool    `json:"enabled"`
+	PowerOn bool    `json:"powerOn"`
+	Speed   float64 `json:"speed"`
+	Paused  bool    `json:"paused"`
+	Frames  int     `json:"frames"`
+}
+
+// serveControl exposes game controls as JSON-RPC 2.0 over a websocket
+func (d *Director) serveControl(w http.ResponseWriter, r *http.Request) {
+	d.serveRPC(w, r, d.controlClients, d.controlCall)
+}
+
+// controlCall runs a control method; d.mu must be held
+func (d *Director) controlCall(method string, raw json.RawMessage) (interface{}, error) {
+	var params controlParams
+	if err := unmarshalParams(raw, &params); err != nil {
+		return nil, err
+	}
+	console := d.console
+	if console == nil {
+		return nil, errors.New("no game running")
+	}
+	switch method {
+	case "listCheats":
+		return console.Cheats(), nil
+	case "addCheat":
+		cheat, err := console.AddCheat(params.Code, params.Name)
+		if err != nil {
+			return nil, err
+		}
+		return cheat, d.saveCheats()
+	case "removeCheat":
+		if !console.RemoveCheat(params.Code) {
+			return nil, fmt.Errorf("no cheat %s", params.Code)
+		}
+		return nil, d.saveCheats()
+	case "enableCheat":
+		if !console.EnableCheat(params.Code, params.Enabled) {
+			return nil, fmt.Errorf("no cheat %s", params.Code)
+		}
+		return nil, d.saveCheats()
+	case "recordMovie":
+		return nil, d.recordMovie(params.PowerOn)
+	case "playMovie":
+		filename, err := namedMoviePath(params.Name)
+		if err != nil {
+			return nil, err
+		}
+		return nil, d.playMovie(filename)
+	case "stopMovie":
+		var filename string
+		if params.Name != "" {
+			var err error
+			if filename, err = namedMoviePath(params.Name); err != nil {
+				return nil, err
+			}
+		}
+		return d.stopMovie(filename)
+	case "getSpeed":
+		return d.speed, nil
+	case "setSpeed":
+		if params.Speed < 0 {
+			return nil, errors.New("speed must not be negative")
+		}
+		d.speed.Speed = params.Speed
+		return d.speed, nil
+	case "setPaused":
+		d.speed.Paused = params.Paused
+		return d.speed, nil
+	case "frameAdvance":
+		if params.Frames < 1 {
+			params.Frames = 1
+		}
+		d.speed.frameAdvance(params.Frames)
+		return d.speed, nil
+	}
+	return nil, fmt.Errorf("unknown method: %s", method)
+}
+
+// saveCheats writes the cheat file of the running game
+func (d *Director) saveCheats() error {
+	return saveCheats(d.console, cheatPath(d.hash))
+}
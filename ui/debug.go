@@ -0,0 +1,434 @@
+package ui
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/fogleman/nes/nes"
+)
+
+const debugHelp = `commands:
+  c, continue             resume execution
+  p, pause                pause execution
+  s, step                 step into the next instruction
+  n, next                 step over subroutine calls
+  o, out                  run until the current subroutine returns
+  scanline, frame         run to the next scanline or frame
+  b ADDR[-END] [if COND]  break on execution
+  rb ADDR[-END] [if COND] break on read
+  wb ADDR[-END] [if COND] break on write
+  ab ADDR[-END] [if COND] break on read or write
+  nmi [if COND]           break on NMI
+  irq [if COND]           break on IRQ
+  bl                      list breakpoints
+  d ID                    delete a breakpoint
+  enable ID, disable ID   enable or disable a breakpoint
+  r                       show registers
+  r NAME VALUE            set a register or flag
+  m ADDR [LEN]            dump memory
+  w ADDR VALUE...         write memory
+  dis [ADDR] [COUNT]      disassemble
+  cdl start|stop          start or stop the code/data logger
+  cdl save FILE           write the log as an FCEUX .cdl file
+conditions use registers, flags, [ADDR] for memory, VALUE and ADDR for the
+accessed value and address, e.g. "A==$10 && [$0300]>2"`
+
+// debugCommand runs one debugger command and returns its output.
+func debugCommand(console *nes.Console, line string) (string, error) {
+	d := console.Debugger()
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	args := fields[1:]
+	number := func(i int) (int, error) {
+		if i >= len(args) {
+			return 0, errors.New("missing argument")
+		}
+		return nes.ParseNumber(args[i])
+	}
+	switch fields[0] {
+	case "help", "h", "?":
+		return debugHelp, nil
+	case "c", "continue":
+		d.Continue()
+	case "p", "pause":
+		d.Pause()
+		return debugStatus(console), nil
+	case "s", "step":
+		d.StepInto()
+	case "n", "next":
+		d.StepOver()
+	case "o", "out":
+		d.StepOut()
+	case "scanline":
+		d.StepScanline()
+	case "frame":
+		d.StepFrame()
+	case "b", "rb", "wb", "ab", "nmi", "irq":
+		kinds := map[string]int{
+			"b": nes.BreakExecute, "rb": nes.BreakRead, "wb": nes.BreakWrite,
+			"ab": nes.BreakRead | nes.BreakWrite, "nmi": nes.BreakNMI,
+			"irq": nes.BreakIRQ}
+		kind := kinds[fields[0]]
+		var start, end int
+		if kind&(nes.BreakNMI|nes.BreakIRQ) == 0 {
+			if len(args) == 0 {
+				return "", errors.New("missing address")
+			}
+			var err error
+			if start, end, err = parseRange(args[0]); err != nil {
+				return "", err
+			}
+			args = args[1:]
+		}
+		var condition string
+		if len(args) > 0 {
+			if args[0] != "if" {
+				return "", fmt.Errorf("unexpected %q", args[0])
+			}
+			condition = strings.Join(args[1:], " ")
+		}
+		b, err := d.AddBreakpoint(kind, uint16(start), uint16(end), condition)
+		if err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	case "bl":
+		var lines []string
+		for _, b := range d.Breakpoints() {
+			lines = append(lines, fmt.Sprintf("%s, %d hits", b, b.Hits))
+		}
+		return strings.Join(lines, "\n"), nil
+	case "d", "enable", "disable":
+		id, err := number(0)
+		if err != nil {
+			return "", err
+		}
+		var ok bool
+		if fields[0] == "d" {
+			ok = d.RemoveBreakpoint(id)
+		} else {
+			ok = d.EnableBreakpoint(id, fields[0] == "enable")
+		}
+		if !ok {
+			return "", fmt.Errorf("no breakpoint #%d", id)
+		}
+	case "r":
+		if len(args) == 0 {
+			return debugStatus(console), nil
+		}
+		value, err := number(1)
+		if err != nil {
+			return "", err
+		}
+		return "", d.SetRegister(args[0], value)
+	case "m":
+		address, err := number(0)
+		if err != nil {
+			return "", err
+		}
+		length := 64
+		if len(args) > 1 {
+			if length, err = number(1); err != nil {
+				return "", err
+			}
+		}
+		if length < 0 {
+			return "", errors.New("length must not be negative")
+		}
+		return hexDump(uint16(address), d.ReadMemory(uint16(address), length)), nil
+	case "w":
+		address, err := number(0)
+		if err != nil {
+			return "", err
+		}
+		var data []byte
+		for i := 1; i < len(args); i++ {
+			value, err := number(i)
+			if err != nil {
+				return "", err
+			}
+			data = append(data, byte(value))
+		}
+		d.WriteMemory(uint16(address), data)
+	case "dis":
+		address := int(console.CPU.PC)
+		count := 10
+		var err error
+		if len(args) > 0 {
+			if address, err = number(0); err != nil {
+				return "", err
+			}
+		}
+		if len(args) > 1 {
+			if count, err = number(1); err != nil {
+				return "", err
+			}
+		}
+		if count < 0 {
+			return "", errors.New("count must not be negative")
+		}
+		var lines []string
+		for _, inst := range disassemble(console, uint16(address), count) {
+			lines = append(lines, fmt.Sprintf("%04X  %-8s  %s",
+				inst.Address, inst.HexBytes(), inst))
+		}
+		return strings.Join(lines, "\n"), nil
+	case "cdl":
+		return cdlCommand(console, args)
+	default:
+		return "", fmt.Errorf("unknown command %q, try help", fields[0])
+	}
+	return "", nil
+}
+
+func cdlCommand(console *nes.Console, args []string) (string, error) {
+	if len(args) == 0 {
+		return "", errors.New("missing argument")
+	}
+	cdl := console.CDL()
+	switch args[0] {
+	case "start":
+		if console.StartCDL() == nil {
+			return "", errors.New("mapper does not support code/data logging")
+		}
+	case "stop":
+		console.StopCDL()
+	case "save":
+		if cdl == nil {
+			return "", errors.New("code/data logger is not running")
+		}
+		if len(args) < 2 {
+			return "", errors.New("missing file name")
+		}
+		if err := cdl.SaveFile(args[1]); err != nil {
+			return "", err
+		}
+		c := cdl.Coverage()
+		return fmt.Sprintf("%d of %d PRG bytes logged", c.PRGUsed, c.PRGSize), nil
+	default:
+		return "", fmt.Errorf("unknown cdl command %q", args[0])
+	}
+	return "", nil
+}
+
+// parseRange parses ADDR or START-END
+func parseRange(s string) (int, int, error) {
+	parts := strings.SplitN(s, "-", 2)
+	start, err := nes.ParseNumber(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	end := start
+	if len(parts) == 2 {
+		if end, err = nes.ParseNumber(parts[1]); err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, end, nil
+}
+
+// disassemble returns count instructions starting at address; count is
+// limited to 0-$10000
+func disassemble(console *nes.Console, address uint16, count int) []nes.Instruction {
+	if count < 0 {
+		count = 0
+	} else if count > 0x10000 {
+		count = 0x10000
+	}
+	result := make([]nes.Instruction, count)
+	for i := range result {
+		result[i] = nes.Disassemble(console.Peek, address)
+		address += uint16(result[i].Size)
+	}
+	return result
+}
+
+func hexDump(address uint16, data []byte) string {
+	var lines []string
+	for i := 0; i < len(data); i += 16 {
+		j := i + 16
+		if j > len(data) {
+			j = len(data)
+		}
+		lines = append(lines, fmt.Sprintf("%04X  % X", address+uint16(i), data[i:j]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// debugStatus returns the trace line for the next instruction
+func debugStatus(console *nes.Console) string {
+	return nes.NewTracer(console, nil).Line()
+}
+
+// debugCommand runs a REPL command with d.mu held
+func (d *Director) debugCommand(line string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.console == nil {
+		return "", errors.New("no game running")
+	}
+	d.debugger(d.console)
+	return debugCommand(d.console, line)
+}
+
+// runDebugREPL reads debugger commands from the terminal
+func (d *Director) runDebugREPL() {
+	scanner := bufio.NewScanner(os.Stdin)
+	fmt.Print("(nes) ")
+	for scanner.Scan() {
+		output, err := d.debugCommand(scanner.Text())
+		if err != nil {
+			fmt.Println("error:", err)
+		} else if output != "" {
+			fmt.Println(output)
+		}
+		fmt.Print("(nes) ")
+	}
+}
+
+// debugger returns the console's debugger. It is created on first use, so
+// games run without debugger checks until a client needs one, and reports
+// pauses to the terminal and websocket clients; d.mu must be held.
+func (d *Director) debugger(console *nes.Console) *nes.Debugger {
+	debugger := console.Debugger()
+	if d.debugging != console {
+		if d.removeBreak != nil {
+			d.removeBreak()
+		}
+		d.debugging = console
+		d.removeBreak = debugger.OnBreak(func(reason string) {
+			status := debugStatus(console)
+			if d.debugREPL {
+				fmt.Printf("\nbreak: %s\n%s\n(nes) ", reason, status)
+			}
+			broadcast(d.debugClients, "break", map[string]interface{}{
+				"reason":    reason,
+				"registers": debugger.Registers(),
+			})
+		})
+	}
+	return debugger
+}
+
+type debugParams struct {
+	Kind      string `json:"kind"`
+	Address   int    `json:"address"`
+	End       *int   `json:"end"`
+	Condition string `json:"condition"`
+	ID        int    `json:"id"`
+	Enabled   bool   `json:"enabled"`
+	Name      string `json:"name"`
+	Value     int    `json:"value"`
+	Length    int    `json:"length"`
+	Data      []int  `json:"data"`
+	Count     int    `json:"count"`
+	Line      string `json:"line"`
+}
+
+// serveDebug exposes the debugger as JSON-RPC 2.0 over a websocket.
+// "break" notifications are sent whenever execution pauses.
+func (d *Director) serveDebug(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	if d.console != nil {
+		d.debugger(d.console)
+	}
+	d.mu.Unlock()
+	d.serveRPC(w, r, d.debugClients, d.debugCall)
+}
+
+// debugCall runs a JSON-RPC method; d.mu must be held
+func (d *Director) debugCall(method string, raw json.RawMessage) (interface{}, error) {
+	var params debugParams
+	if err := unmarshalParams(raw, &params); err != nil {
+		return nil, err
+	}
+	console := d.console
+	if console == nil {
+		return nil, errors.New("no game running")
+	}
+	debugger := d.debugger(console)
+	switch method {
+	case "pause":
+		debugger.Pause()
+	case "continue":
+		debugger.Continue()
+	case "stepInto":
+		debugger.StepInto()
+	case "stepOver":
+		debugger.StepOver()
+	case "stepOut":
+		debugger.StepOut()
+	case "stepScanline":
+		debugger.StepScanline()
+	case "stepFrame":
+		debugger.StepFrame()
+	case "status":
+		return map[string]interface{}{
+			"paused":    debugger.Paused(),
+			"reason":    debugger.Reason(),
+			"registers": debugger.Registers(),
+		}, nil
+	case "addBreakpoint":
+		kind, err := nes.ParseBreakKind(params.Kind)
+		if err != nil {
+			return nil, err
+		}
+		end := params.Address
+		if params.End != nil {
+			end = *params.End
+		}
+		return debugger.AddBreakpoint(
+			kind, uint16(params.Address), uint16(end), params.Condition)
+	case "removeBreakpoint":
+		return debugger.RemoveBreakpoint(params.ID), nil
+	case "enableBreakpoint":
+		return debugger.EnableBreakpoint(params.ID, params.Enabled), nil
+	case "breakpoints":
+		return debugger.Breakpoints(), nil
+	case "registers":
+		return debugger.Registers(), nil
+	case "setRegister":
+		return nil, debugger.SetRegister(params.Name, params.Value)
+	case "readMemory":
+		if params.Length < 0 {
+			return nil, errInvalidParams
+		}
+		data := debugger.ReadMemory(uint16(params.Address), params.Length)
+		result := make([]int, len(data))
+		for i, value := range data {
+			result[i] = int(value)
+		}
+		return result, nil
+	case "writeMemory":
+		data := make([]byte, len(params.Data))
+		for i, value := range params.Data {
+			data[i] = byte(value)
+		}
+		debugger.WriteMemory(uint16(params.Address), data)
+	case "disassemble":
+		if params.Count < 0 {
+			return nil, errInvalidParams
+		}
+		var result []map[string]interface{}
+		for _, inst := range disassemble(console, uint16(params.Address), params.Count) {
+			result = append(result, map[string]interface{}{
+				"address": inst.Address,
+				"bytes":   inst.HexBytes(),
+				"text":    inst.String(),
+			})
+		}
+		return result, nil
+	case "command":
+		return debugCommand(console, params.Line)
+	default:
+		return nil, fmt.Errorf("unknown method: %s", method)
+	}
+	return nil, nil
+}
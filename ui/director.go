@@ -1,12 +1,17 @@
 package ui
 
 import (
+	"encoding/json"
 	"log"
+	"os"
 
+	"github.com/fogleman/nes/achievement"
 	"github.com/fogleman/nes/nes"
+	"github.com/fogleman/nes/script"
 	"github.com/go-gl/gl/v2.1/gl"
 	"github.com/go-gl/glfw/v3.2/glfw"
 	"net/http"
+	"sync"
     "github.com/gorilla/websocket"
 )
 var upgrader = websocket.Upgrader{
@@ -23,17 +28,45 @@ type View interface {
 }
 
 type Director struct {
-	window    *glfw.Window
-	audio     *Audio
-	view      View
-	menuView  View
-	timestamp float64
+	window         *glfw.Window
+	audio          *Audio
+	view           View
+	menuView       View
+	timestamp      float64
+	console        *nes.Console // console of the running game, if any
+	hash           string       // md5 of the running game
+	mu             sync.Mutex   // guards the console and speed against other goroutines
+	debugREPL      bool
+	debugClients   map[chan []byte]bool
+	controlClients map[chan []byte]bool
+	gdbAddress     string
+	gdb            *nes.GDBServer
+	debugging      *nes.Console   // console whose debugger reports pauses
+	removeBreak    func()         // removes the pause listener from debugging
+	search         *nes.RAMSearch // RAM search of the running game
+	scriptPath     string
+	script         *script.Script
+	webhook        string
+	achievements   *achievement.Engine
+	movie          string // movie to play when a game starts
+	patch          string // patch to apply to patchROM instead of one found next to it
+	patchROM       string // the only game given, if patch is set
+	speed          speedControl
 }
 
-func NewDirector(window *glfw.Window, audio *Audio) *Director {
+func NewDirector(window *glfw.Window, audio *Audio, options Options) *Director {
 	director := Director{}
 	director.window = window
     director.audio = audio
+	director.debugREPL = options.Debug
+	director.gdbAddress = options.GDB
+	director.scriptPath = options.Script
+	director.webhook = options.Webhook
+	director.movie = options.Movie
+	director.patch = options.Patch
+	director.speed = speedControl{Speed: 1}
+	director.debugClients = make(map[chan []byte]bool)
+	director.controlClients = make(map[chan []byte]bool)
 	return &director
 }
 
@@ -58,11 +91,33 @@ func (d *Director) Step() {
 	dt := timestamp - d.timestamp
 	d.timestamp = timestamp
 	if d.view != nil {
+		d.mu.Lock()
 		d.view.Update(timestamp, dt)
+		if d.script != nil && d.script.Err() != nil {
+			log.Println("script:", d.script.Err())
+			d.script.Stop()
+			d.script = nil
+		}
+		d.mu.Unlock()
 	}
 }
 
 func (d *Director) Start(paths []string) {
+	http.HandleFunc("/audio/stats", d.serveAudioStats)
+	http.HandleFunc("/control", d.serveControl)
+	http.HandleFunc("/debug", d.serveDebug)
+	http.HandleFunc("/debug/ppu/", d.servePPU)
+	http.HandleFunc("/debug/ramsearch", d.serveRAMSearch)
+	if d.debugREPL {
+		go d.runDebugREPL()
+	}
+	if d.patch != "" {
+		if len(paths) == 1 {
+			d.patchROM = paths[0]
+		} else {
+			log.Println("-patch ignored: it needs a single game")
+		}
+	}
 	d.menuView = NewMenuView(d, paths)
 	if len(paths) == 1 {
 		d.PlayGame(paths[0])
@@ -78,19 +133,70 @@ func (d *Director) Run() {
 		d.window.SwapBuffers()
 		glfw.PollEvents()
 	}
+	d.mu.Lock()
 	d.SetView(nil)
+	d.mu.Unlock()
+	if d.achievements != nil {
+		d.achievements.Close()
+	}
 
 }
 
 func (d *Director) PlayGame(path string) {
-    hash, err := hashFile(path)
-    if err != nil {
+    // a patched game is a different game as far as saves are concerned
+    patchPath := ""
+    if path == d.patchROM {
+        patchPath = d.patch
+    }
+    rom, patch, err := nes.LoadPatchedROM(path, patchPath)
+    if rom == nil {
         log.Fatalln(err)
     }
-    console, err := nes.NewConsole(path)
+    if err != nil {
+        log.Println("patch:", err, "(loading the game unpatched)")
+    }
+    if patch != "" {
+        log.Println("applied patch", patch)
+    }
+    hash := hashROM(rom)
+    console, err := nes.NewConsoleFromBytes(rom)
     if err != nil {
         log.Fatalln(err)
     }
+    for _, fix := range console.Cartridge.HeaderFixes {
+        log.Println("header fix:", fix)
+    }
+    if palette, err := loadPalette(hash); err == nil {
+        console.SetPalette(palette)
+    }
+    if err := loadCheats(console, cheatPath(hash)); err != nil && !os.IsNotExist(err) {
+        log.Println(err)
+    }
+    d.console = console
+    if d.debugREPL {
+        d.debugger(console)
+    }
+    d.hash = hash
+    d.search = nil
+    if d.gdbAddress != "" {
+        d.startGDB(console)
+    }
+    d.startAchievements(console, hash)
+    if d.movie != "" {
+        if err := d.playMovie(d.movie); err != nil {
+            log.Println("movie:", err)
+        }
+    }
+    d.script = nil
+    if d.scriptPath != "" {
+        d.script = script.New(console)
+        d.script.SetOutput(os.Stdout)
+        if err := d.script.RunFile(d.scriptPath); err != nil {
+            log.Println("script:", err)
+            d.script.Stop()
+            d.script = nil
+        }
+    }
     d.SetView(NewGameView(d, console, path, hash))
 
     // 1201 포트에서 웹소켓 연결 처리
@@ -144,6 +250,46 @@ func (d *Director) PlayGame(path string) {
     log.Println("실행")
 }
 
+// serveAudioStats reports audio buffer fill, underruns and overruns
+func (d *Director) serveAudioStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d.audio.Stats())
+}
+
+// startGDB serves the GDB remote protocol for console, replacing the server
+// for any previous game
+func (d *Director) startGDB(console *nes.Console) {
+	if d.gdb != nil {
+		d.gdb.Close()
+	}
+	d.gdb = nes.NewGDBServer(console, &d.mu)
+	go func(server *nes.GDBServer) {
+		if err := server.ListenAndServe(d.gdbAddress); err != nil {
+			log.Println("gdb:", err)
+		}
+	}(d.gdb)
+}
+
+// stopGame detaches the debugger, GDB and RAM search from the console of a
+// game whose view is exiting, so that clients can't change a console that
+// no longer runs; d.mu must be held
+func (d *Director) stopGame(console *nes.Console) {
+	if d.console != console {
+		return // another game has already started
+	}
+	if d.removeBreak != nil {
+		d.removeBreak()
+		d.removeBreak = nil
+	}
+	d.debugging = nil
+	if d.gdb != nil {
+		d.gdb.Close()
+		d.gdb = nil
+	}
+	d.search = nil
+	d.console = nil
+}
+
 func (d *Director) ShowMenu() {
 	d.SetView(d.menuView)
 }
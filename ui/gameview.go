@@ -2,6 +2,7 @@ package ui
 
 import (
 	"image"
+	"time"
 
 	"github.com/fogleman/nes/nes"
 	"github.com/go-gl/gl/v2.1/gl"
@@ -18,15 +19,20 @@ type GameView struct {
 	texture  uint32
 	record   bool
 	frames   []image.Image
+	muted    bool
 	// message []byte
 }
 
 func NewGameView(director *Director, console *nes.Console, title, hash string) View {
 	texture := createTexture()
-	return &GameView{director, console, title, hash, texture, false, nil}
+	return &GameView{director, console, title, hash, texture, false, nil, false}
 }
 
 func (view *GameView) load(snapshot int) {
+	// loading a state ends a recording, so save it first
+	if _, recording := view.console.Movie(); recording {
+		view.director.toggleMovie()
+	}
 	// load state
 	if err := view.console.LoadState(savePath(view.hash, snapshot)); err == nil {
 		return
@@ -55,7 +61,7 @@ func (view *GameView) save(snapshot int) {
 func (view *GameView) Enter() {
 	gl.ClearColor(0, 0, 0, 1)
 	view.director.SetTitle(view.title)
-	view.console.SetAudioChannel(view.director.audio.channel)
+	view.console.SetAudioBuffer(view.director.audio.buffer)
 	view.console.SetAudioSampleRate(view.director.audio.sampleRate)
 	view.director.window.SetKeyCallback(view.onKey)
 	view.load(-1)
@@ -63,9 +69,10 @@ func (view *GameView) Enter() {
 
 func (view *GameView) Exit() {
 	view.director.window.SetKeyCallback(nil)
-	view.console.SetAudioChannel(nil)
+	view.console.SetAudioBuffer(nil)
 	view.console.SetAudioSampleRate(0)
 	view.save(-1)
+	view.director.stopGame(view.console)
 }
 
 func (view *GameView) Update(t, dt float64) {
@@ -84,7 +91,26 @@ func (view *GameView) Update(t, dt float64) {
 		view.director.ShowMenu()
 	}
 
-	console.StepSeconds(dt)
+	speed := &view.director.speed
+	view.setMuted(speed.muted())
+	switch {
+	case speed.Paused:
+		for ; speed.advance > 0; speed.advance-- {
+			if console.StepFrame() == 0 {
+				break
+			}
+		}
+	case speed.Speed == 0:
+		// only the last frame is drawn
+		deadline := time.Now().Add(unlimitedBudget)
+		for time.Now().Before(deadline) {
+			if console.StepFrame() == 0 {
+				break
+			}
+		}
+	default:
+		console.StepSeconds(dt * speed.Speed)
+	}
 	// updateControllers(window, console)
 	// updateCloudControllers(window, view.message, console)
 	gl.BindTexture(gl.TEXTURE_2D, view.texture)
@@ -96,8 +122,26 @@ func (view *GameView) Update(t, dt float64) {
 	}
 }
 
+// setMuted turns sample generation off while muted, which also saves the
+// time spent mixing
+func (view *GameView) setMuted(muted bool) {
+	if muted == view.muted {
+		return
+	}
+	view.muted = muted
+	if muted {
+		view.console.SetAudioSampleRate(0)
+	} else {
+		view.console.SetAudioSampleRate(view.director.audio.sampleRate)
+	}
+}
+
 func (view *GameView) onKey(window *glfw.Window,
 	key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	// keys are handled outside Step, so take the lock that control and
+	// debug clients hold while they change the speed or console
+	view.director.mu.Lock()
+	defer view.director.mu.Unlock()
 	if action == glfw.Press {
 		if key >= glfw.Key0 && key <= glfw.Key9 {
 			snapshot := int(key - glfw.Key0)
@@ -112,6 +156,18 @@ func (view *GameView) onKey(window *glfw.Window,
 			screenshot(view.console.Buffer())
 		case glfw.KeyR:
 			view.console.Reset()
+		case glfw.KeyM:
+			view.director.toggleMovie()
+		case glfw.KeyP:
+			view.director.speed.Paused = !view.director.speed.Paused
+		case glfw.KeyPeriod:
+			view.director.speed.frameAdvance(1)
+		case glfw.KeyEqual:
+			view.director.speed.step(1)
+		case glfw.KeyMinus:
+			view.director.speed.step(-1)
+		case glfw.KeyBackspace:
+			view.director.speed = speedControl{Speed: 1}
 		case glfw.KeyTab:
 			if view.record {
 				view.record = false
@@ -0,0 +1,77 @@
+package ui
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fogleman/nes/nes"
+)
+
+func moviePath(hash string) string {
+	return fmt.Sprintf("%s/.nes/movies/%s-%d.nesm", homeDir, hash, time.Now().Unix())
+}
+
+// namedMoviePath returns the path of a movie in the movies directory. Names
+// come from control clients, so they may not contain path separators or "..".
+func namedMoviePath(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid movie name: %q", name)
+	}
+	return homeDir + "/.nes/movies/" + name, nil
+}
+
+// recordMovie starts recording a movie of the running game
+func (d *Director) recordMovie(powerOn bool) error {
+	return d.console.RecordMovie(&nes.Movie{ROMHash: d.hash}, powerOn)
+}
+
+// playMovie plays the movie file on the running game
+func (d *Director) playMovie(filename string) error {
+	m, err := nes.LoadMovieFile(filename)
+	if err != nil {
+		return err
+	}
+	if m.ROMHash != "" && m.ROMHash != d.hash {
+		log.Printf("movie %s was recorded with a different rom", filename)
+	}
+	return d.console.PlayMovie(m)
+}
+
+// stopMovie ends recording or playback. A recording is saved to filename,
+// or to the movies directory if it is empty; the path is returned.
+func (d *Director) stopMovie(filename string) (string, error) {
+	m, recording := d.console.Movie()
+	d.console.StopMovie()
+	if m == nil || !recording {
+		return "", nil
+	}
+	if filename == "" {
+		filename = moviePath(d.hash)
+	}
+	dir, _ := path.Split(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return filename, m.SaveFile(filename)
+}
+
+// toggleMovie starts recording from the current state, or stops and saves
+// the movie being recorded
+func (d *Director) toggleMovie() {
+	if _, recording := d.console.Movie(); recording {
+		filename, err := d.stopMovie("")
+		if err != nil {
+			log.Println(err)
+		} else {
+			log.Println("saved movie", filename)
+		}
+		return
+	}
+	if err := d.recordMovie(false); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,71 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// servePPU serves live views of the PPU state of the running game:
+//
+//	/debug/ppu/nametables.png
+//	/debug/ppu/patterns.png?table=0&palette=0
+//	/debug/ppu/sprites.png      all 64 sprites in a grid
+//	/debug/ppu/spritelayer.png  visible sprites at screen positions
+//	/debug/ppu/palette.png
+//	/debug/ppu/oam              sprite list as JSON
+//	/debug/ppu/palette          palette RAM as JSON
+func (d *Director) servePPU(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/debug/ppu/")
+	query := r.URL.Query()
+	var im image.Image
+	var data interface{}
+	d.mu.Lock()
+	console := d.console
+	if console == nil {
+		d.mu.Unlock()
+		http.Error(w, "no game running", http.StatusServiceUnavailable)
+		return
+	}
+	switch name {
+	case "nametables.png":
+		im = console.NameTables()
+	case "patterns.png":
+		table, _ := strconv.Atoi(query.Get("table"))
+		palette, _ := strconv.Atoi(query.Get("palette"))
+		im = console.PatternTable(table, palette)
+	case "sprites.png":
+		im = console.SpriteSheet()
+	case "spritelayer.png":
+		im = console.SpriteLayer()
+	case "palette.png":
+		im = console.PaletteImage()
+	case "oam":
+		data = console.Sprites()
+	case "palette":
+		// ints, since a []byte would be encoded as base64
+		ram := make([]int, 32)
+		colors := make([]string, len(ram))
+		for i, value := range console.PaletteRAM() {
+			c := console.Palette.Lookup(value, false, 0)
+			ram[i] = int(value)
+			colors[i] = fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+		}
+		data = map[string]interface{}{"ram": ram, "colors": colors}
+	}
+	d.mu.Unlock()
+	switch {
+	case im != nil:
+		w.Header().Set("Content-Type", "image/png")
+		png.Encode(w, im)
+	case data != nil:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(data)
+	default:
+		http.NotFound(w, r)
+	}
+}
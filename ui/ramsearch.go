@@ -0,0 +1,70 @@
+package ui
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/fogleman/nes/nes"
+)
+
+// serveRAMSearch runs a RAM search step on the running game and returns the
+// candidates as JSON:
+//
+//	/debug/ramsearch?op=reset&size=2&signed=1  start over
+//	/debug/ramsearch?op=snapshot               take a new snapshot
+//	/debug/ramsearch?op=gt&value=10            narrow the candidates
+//	/debug/ramsearch?limit=100                 list candidates
+//
+// op is one of reset, snapshot or a comparison accepted by ParseSearchOp.
+func (d *Director) serveRAMSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.console == nil {
+		http.Error(w, "no game running", http.StatusServiceUnavailable)
+		return
+	}
+	op := query.Get("op")
+	if d.search == nil || op == "reset" {
+		size, _ := strconv.Atoi(query.Get("size"))
+		if size == 0 {
+			size = 1
+		}
+		signed, _ := strconv.ParseBool(query.Get("signed"))
+		search, err := nes.NewRAMSearch(d.console, size, signed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d.search = search
+	}
+	switch op {
+	case "", "reset":
+	case "snapshot":
+		d.search.Snapshot()
+	default:
+		comparison, err := nes.ParseSearchOp(op)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		value := 0
+		if s := query.Get("value"); s != "" {
+			if value, err = nes.ParseNumber(s); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		d.search.Filter(comparison, value)
+	}
+	limit := 1000
+	if s := query.Get("limit"); s != "" {
+		limit, _ = strconv.Atoi(s)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":      d.search.Count(),
+		"candidates": d.search.Results(limit),
+	})
+}
@@ -0,0 +1,120 @@
+package ui
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// JSON-RPC 2.0 over websockets, used by the debug and control endpoints
+
+type rpcRequest struct {
+	ID     interface{}     `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+var errInvalidParams = errors.New("invalid params")
+
+// rpcHandler runs a method with d.mu held
+type rpcHandler func(method string, params json.RawMessage) (interface{}, error)
+
+// call runs handler with d.mu held, releasing it even if the handler panics
+func (d *Director) call(handler rpcHandler, method string, params json.RawMessage) (interface{}, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return handler(method, params)
+}
+
+// unmarshalParams decodes optional params into v
+func unmarshalParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if json.Unmarshal(params, v) != nil {
+		return errInvalidParams
+	}
+	return nil
+}
+
+// serveRPC handles requests in order until the connection closes. While
+// connected, the client is in clients and receives broadcast notifications.
+func (d *Director) serveRPC(w http.ResponseWriter, r *http.Request,
+	clients map[chan []byte]bool, handler rpcHandler) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("rpc:", err)
+		return
+	}
+	defer conn.Close()
+	send := make(chan []byte, 64)
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case message := <-send:
+				if conn.WriteMessage(websocket.TextMessage, message) != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	d.mu.Lock()
+	clients[send] = true
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(clients, send)
+		d.mu.Unlock()
+	}()
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		response := map[string]interface{}{"jsonrpc": "2.0"}
+		var request rpcRequest
+		if err := json.Unmarshal(message, &request); err != nil {
+			response["error"] = rpcError{-32700, err.Error()}
+		} else {
+			response["id"] = request.ID
+			result, err := d.call(handler, request.Method, request.Params)
+			switch {
+			case err == errInvalidParams:
+				response["error"] = rpcError{-32602, err.Error()}
+			case err != nil:
+				response["error"] = rpcError{-32000, err.Error()}
+			default:
+				response["result"] = result
+			}
+		}
+		reply, _ := json.Marshal(response)
+		send <- reply
+	}
+}
+
+// broadcast sends a notification to clients; d.mu must be held
+func broadcast(clients map[chan []byte]bool, method string, params interface{}) {
+	message, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+	})
+	for client := range clients {
+		select {
+		case client <- message:
+		default: // client is not keeping up
+		}
+	}
+}
@@ -24,7 +24,17 @@ func init() {
 	runtime.LockOSThread()
 }
 
-func Run(paths []string) {
+// Options configures the frontend.
+type Options struct {
+	Debug   bool   // run the debugger REPL on the terminal
+	GDB     string // address for the GDB remote stub, e.g. ":2345"
+	Script  string // script to run with each game
+	Webhook string // URL that receives achievement unlocks
+	Movie   string // movie to play when the game starts
+	Patch   string // IPS, BPS or UPS patch to apply when there is one game
+}
+
+func Run(paths []string, options Options) {
 	// initialize audio
 	// portaudio.Initialize()
 	// defer portaudio.Terminate()
@@ -57,6 +67,6 @@ func Run(paths []string) {
 	gl.Enable(gl.TEXTURE_2D)
 
 	// run director
-	director := NewDirector(window, audio)
+	director := NewDirector(window, audio, options)
 	director.Start(paths)
 }
@@ -0,0 +1,43 @@
+package ui
+
+import "time"
+
+// speeds are the emulation speeds selectable from the keyboard, as
+// multiples of normal speed; zero runs as fast as possible
+var speeds = []float64{0.25, 0.5, 1, 2, 4, 0}
+
+// unlimitedBudget is how long each displayed frame emulates for at
+// unlimited speed, leaving time to draw before the next vsync
+const unlimitedBudget = 14 * time.Millisecond
+
+// speedControl holds the emulation speed, which applies to every game
+type speedControl struct {
+	Speed   float64 `json:"speed"` // multiple of normal speed; 0 is unlimited
+	Paused  bool    `json:"paused"`
+	advance int     // frames to run while paused
+}
+
+func (s *speedControl) step(delta int) {
+	i := 2
+	for j, speed := range speeds {
+		if speed == s.Speed {
+			i = j
+		}
+	}
+	i += delta
+	if i >= 0 && i < len(speeds) {
+		s.Speed = speeds[i]
+	}
+}
+
+// frameAdvance pauses and runs n more frames
+func (s *speedControl) frameAdvance(n int) {
+	s.Paused = true
+	s.advance += n
+}
+
+// muted reports whether audio should be off. Audio is only played at normal
+// speed, since other speeds would change its pitch.
+func (s *speedControl) muted() bool {
+	return s.Paused || s.Speed != 1
+}
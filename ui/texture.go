@@ -109,7 +109,7 @@ func (t *Texture) load(path string) int {
 
 func (t *Texture) loadThumbnail(romPath string) image.Image {
 	_, name := path.Split(romPath)
-	name = strings.TrimSuffix(name, ".nes")
+	name = strings.TrimSuffix(name, path.Ext(name))
 	name = strings.Replace(name, "_", " ", -1)
 	name = strings.Title(name)
 	im := CreateGenericThumbnail(name)
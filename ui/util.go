@@ -10,7 +10,6 @@ import (
     "image/draw"
     "image/gif"
     "image/png"
-    "io/ioutil"
     "log"
     "os"
     "os/user"
@@ -39,6 +38,17 @@ func thumbnailPath(hash string) string {
 	return homeDir + "/.nes/thumbnail/" + hash + ".png"
 }
 
+func palettePath(hash string) string {
+	if hash != "" {
+		return homeDir + "/.nes/palette/" + hash + ".pal"
+	}
+	return homeDir + "/.nes/palette.pal"
+}
+
+func cheatPath(hash string) string {
+	return homeDir + "/.nes/cheats/" + hash + ".txt"
+}
+
 func sramPath(hash string, snapshot int) string {
 	if snapshot >= 0 {
 		return fmt.Sprintf("%s/.nes/sram/%s-%d.dat", homeDir, hash, snapshot)
@@ -243,12 +253,23 @@ func combineButtons(a, b [8]bool) [8]bool {
 	return result
 }
 
+// hashFile returns the MD5 of a ROM file, unpacked if it is an archive
 func hashFile(path string) (string, error) {
-	data, err := ioutil.ReadFile(path)
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data, err := nes.ReadROM(file)
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("%x", md5.Sum(data)), nil
+	return hashROM(data), nil
+}
+
+// hashROM returns the MD5 of a ROM image, which keys its saves and settings
+func hashROM(data []byte) string {
+	return fmt.Sprintf("%x", md5.Sum(data))
 }
 
 func createTexture() uint32 {
@@ -295,18 +316,12 @@ func savePNG(path string, im image.Image) error {
 }
 
 func saveGIF(path string, frames []image.Image) error {
-	var palette []color.Color
-	for _, c := range nes.Palette {
-		palette = append(palette, c)
-	}
 	g := gif.GIF{}
 	for i, src := range frames {
 		if i%3 != 0 {
 			continue
 		}
-		dst := image.NewPaletted(src.Bounds(), palette)
-		draw.Draw(dst, dst.Rect, src, image.ZP, draw.Src)
-		g.Image = append(g.Image, dst)
+		g.Image = append(g.Image, gifFrame(src))
 		g.Delay = append(g.Delay, 5)
 	}
 	file, err := os.Create(path)
@@ -317,6 +332,34 @@ func saveGIF(path string, frames []image.Image) error {
 	return gif.EncodeAll(file, &g)
 }
 
+// gifFrame converts a frame using a palette of the colors it holds, so that
+// emphasized and grayscale colors are kept. A frame uses far fewer than
+// GIF's 256 colors; any beyond that map to the nearest one.
+func gifFrame(src image.Image) *image.Paletted {
+	bounds := src.Bounds()
+	var palette color.Palette
+	indexes := make(map[color.Color]uint8)
+	dst := image.NewPaletted(bounds, nil)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := src.At(x, y)
+			index, ok := indexes[c]
+			if !ok {
+				if len(palette) < 256 {
+					palette = append(palette, c)
+					index = uint8(len(palette) - 1)
+				} else {
+					index = uint8(palette.Index(c))
+				}
+				indexes[c] = index
+			}
+			dst.SetColorIndex(x, y, index)
+		}
+	}
+	dst.Palette = palette
+	return dst
+}
+
 func screenshot(im image.Image) {
 	for i := 0; i < 1000; i++ {
 		path := fmt.Sprintf("%03d.png", i)
@@ -337,6 +380,16 @@ func animation(frames []image.Image) {
 	}
 }
 
+// loadPalette returns the palette for the game with the given hash, falling
+// back to the global palette file
+func loadPalette(hash string) (*nes.Palette, error) {
+	palette, err := nes.LoadPaletteFile(palettePath(hash))
+	if err == nil {
+		return palette, nil
+	}
+	return nes.LoadPaletteFile(palettePath(""))
+}
+
 func writeSRAM(filename string, sram []byte) error {
 	dir, _ := path.Split(filename)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -362,3 +415,25 @@ func readSRAM(filename string) ([]byte, error) {
 	}
 	return sram, nil
 }
+
+func loadCheats(console *nes.Console, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return console.ReadCheats(file)
+}
+
+func saveCheats(console *nes.Console, filename string) error {
+	dir, _ := path.Split(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return console.WriteCheats(file)
+}
@@ -0,0 +1,233 @@
+// Command gamedb generates the game database in nes/gamedb_data.go from
+// NES 2.0 XML (nes20db.xml), with titles and publishers optionally taken
+// from a headerless No-Intro DAT.
+//
+//	go run ./util/gamedb -nointro "Nintendo - NES (Headerless).dat" nes20db.xml
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/nes/nes"
+)
+
+var (
+	noIntro = flag.String("nointro", "", "No-Intro DAT to take titles and publishers from")
+	output  = flag.String("o", "nes/gamedb_data.go", "file to write")
+)
+
+type size struct {
+	Size int `xml:"size,attr"`
+}
+
+// nes20Game is a <game> element of nes20db.xml
+type nes20Game struct {
+	ROM struct {
+		CRC32 string `xml:"crc32,attr"`
+		SHA1  string `xml:"sha1,attr"`
+	} `xml:"rom"`
+	PRGRAM   size `xml:"prgram"`
+	PRGNVRAM size `xml:"prgnvram"`
+	CHRRAM   size `xml:"chrram"`
+	CHRNVRAM size `xml:"chrnvram"`
+	PCB      struct {
+		Mapper    int    `xml:"mapper,attr"`
+		Submapper int    `xml:"submapper,attr"`
+		Mirroring string `xml:"mirroring,attr"`
+		Battery   int    `xml:"battery,attr"`
+	} `xml:"pcb"`
+	Console struct {
+		Region int `xml:"region,attr"`
+	} `xml:"console"`
+}
+
+var regions = []string{"NTSC", "PAL", "Multi", "Dendy"}
+
+// readNES20 reads nes20db.xml. Each game is preceded by a comment with the
+// file name of the dump, which becomes its title.
+func readNES20(r io.Reader) ([]nes.GameInfo, error) {
+	var games []nes.GameInfo
+	var comment string
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return games, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.Comment:
+			comment = strings.TrimSpace(string(t))
+		case xml.StartElement:
+			if t.Name.Local != "game" {
+				continue
+			}
+			var g nes20Game
+			if err := decoder.DecodeElement(&g, &t); err != nil {
+				return nil, err
+			}
+			crc, err := strconv.ParseUint(g.ROM.CRC32, 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s: bad crc32 %q", comment, g.ROM.CRC32)
+			}
+			title := comment[strings.LastIndexAny(comment, `\/`)+1:]
+			title = strings.TrimSuffix(title, path.Ext(title))
+			info := nes.GameInfo{
+				CRC32:     uint32(crc),
+				SHA1:      strings.ToLower(g.ROM.SHA1),
+				Title:     title,
+				Mapper:    g.PCB.Mapper,
+				Submapper: g.PCB.Submapper,
+				Battery:   g.PCB.Battery != 0,
+				PRGRAM:    g.PRGRAM.Size + g.PRGNVRAM.Size,
+				CHRRAM:    g.CHRRAM.Size + g.CHRNVRAM.Size,
+			}
+			if g.Console.Region < len(regions) {
+				info.Region = regions[g.Console.Region]
+			}
+			switch g.PCB.Mirroring {
+			case "V":
+				info.Mirror = nes.MirrorVertical
+			case "4":
+				info.Mirror = nes.MirrorFour
+			default:
+				info.Mirror = nes.MirrorHorizontal
+			}
+			games = append(games, info)
+			comment = ""
+		}
+	}
+}
+
+// datFile is a Logiqx XML DAT as published by No-Intro
+type datFile struct {
+	Games []struct {
+		Name         string `xml:"name,attr"`
+		Manufacturer string `xml:"manufacturer"`
+		Publisher    string `xml:"publisher"`
+		ROMs         []struct {
+			SHA1 string `xml:"sha1,attr"`
+		} `xml:"rom"`
+	} `xml:"game"`
+}
+
+// readNoIntro reads a DAT into a map from SHA-1 to title and publisher
+func readNoIntro(r io.Reader) (map[string][2]string, error) {
+	var dat datFile
+	if err := xml.NewDecoder(r).Decode(&dat); err != nil {
+		return nil, err
+	}
+	names := make(map[string][2]string)
+	for _, g := range dat.Games {
+		publisher := g.Publisher
+		if publisher == "" {
+			publisher = g.Manufacturer
+		}
+		for _, rom := range g.ROMs {
+			names[strings.ToLower(rom.SHA1)] = [2]string{g.Name, publisher}
+		}
+	}
+	return names, nil
+}
+
+var mirrorNames = map[byte]string{
+	nes.MirrorHorizontal: "MirrorHorizontal",
+	nes.MirrorVertical:   "MirrorVertical",
+	nes.MirrorFour:       "MirrorFour",
+}
+
+func generate(games []nes.GameInfo) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "// Code generated by util/gamedb; DO NOT EDIT.")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "package nes")
+	fmt.Fprintln(&buf)
+	fmt.Fprintln(&buf, "var gameDB = []GameInfo{")
+	for _, g := range games {
+		fmt.Fprintf(&buf, "{CRC32: 0x%08X, SHA1: %q, Title: %q", g.CRC32, g.SHA1, g.Title)
+		if g.Publisher != "" {
+			fmt.Fprintf(&buf, ", Publisher: %q", g.Publisher)
+		}
+		fmt.Fprintf(&buf, ", Region: %q, Mapper: %d", g.Region, g.Mapper)
+		if g.Submapper != 0 {
+			fmt.Fprintf(&buf, ", Submapper: %d", g.Submapper)
+		}
+		fmt.Fprintf(&buf, ", Mirror: %s", mirrorNames[g.Mirror])
+		if g.Battery {
+			fmt.Fprint(&buf, ", Battery: true")
+		}
+		if g.PRGRAM != 0 {
+			fmt.Fprintf(&buf, ", PRGRAM: %d", g.PRGRAM)
+		}
+		if g.CHRRAM != 0 {
+			fmt.Fprintf(&buf, ", CHRRAM: %d", g.CHRRAM)
+		}
+		fmt.Fprintln(&buf, "},")
+	}
+	fmt.Fprintln(&buf, "}")
+	return format.Source(buf.Bytes())
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: gamedb [-nointro dat] [-o file] nes20db.xml")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	file, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	games, err := readNES20(file)
+	file.Close()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *noIntro != "" {
+		file, err := os.Open(*noIntro)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		names, err := readNoIntro(file)
+		file.Close()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for i := range games {
+			if name, ok := names[games[i].SHA1]; ok {
+				games[i].Title, games[i].Publisher = name[0], name[1]
+			}
+		}
+	}
+	// LookupGame binary searches by CRC32
+	sort.SliceStable(games, func(i, j int) bool {
+		return games[i].CRC32 < games[j].CRC32
+	})
+	src, err := generate(games)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("wrote %d games to %s", len(games), *output)
+}
@@ -0,0 +1,139 @@
+// Command gymserver serves reinforcement learning environments over a
+// websocket with JSON-RPC 2.0. Each connection gets its own vectorized
+// environment. Methods:
+//
+//	spec                        {"shape": [h, w, c], "envs": n}
+//	reset                       {"observations": [...]}
+//	step {actions, frameskip}   {"observations", "rewards", "dones"}
+//
+// Actions are button masks, bit i being button i in the order A, B,
+// Select, Start, Up, Down, Left, Right. Observations are base64 encoded
+// bytes in row-major order.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/fogleman/nes/rl"
+	"github.com/gorilla/websocket"
+)
+
+var (
+	addr        = flag.String("addr", ":8090", "listen address")
+	rom         = flag.String("rom", "rom/Super_mario_brothers.nes", "rom file")
+	task        = flag.String("task", "smb", "reward task")
+	envs        = flag.Int("n", 8, "environments per connection")
+	observation = flag.String("obs", "gray", "observation type: rgb, indexed or gray")
+	size        = flag.Int("size", 84, "grayscale observation width and height")
+)
+
+var observations = map[string]rl.ObservationType{
+	"rgb":     rl.ObserveRGB,
+	"indexed": rl.ObserveIndexed,
+	"gray":    rl.ObserveGray,
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type request struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params struct {
+		Actions   []int `json:"actions"`
+		Frameskip int   `json:"frameskip"`
+	} `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+func call(v *rl.VecEnv, r *request) (interface{}, error) {
+	switch r.Method {
+	case "spec":
+		h, w, c := v.Envs[0].Shape()
+		return map[string]interface{}{"shape": []int{h, w, c}, "envs": len(v.Envs)}, nil
+	case "reset":
+		obs, err := v.Reset()
+		return map[string]interface{}{"observations": obs}, err
+	case "step":
+		if len(r.Params.Actions) != len(v.Envs) {
+			return nil, fmt.Errorf("expected %d actions", len(v.Envs))
+		}
+		actions := make([]byte, len(r.Params.Actions))
+		for i, a := range r.Params.Actions {
+			actions[i] = byte(a)
+		}
+		obs, rewards, dones, err := v.Step(actions, r.Params.Frameskip)
+		return map[string]interface{}{
+			"observations": obs, "rewards": rewards, "dones": dones}, err
+	}
+	return nil, fmt.Errorf("unknown method: %s", r.Method)
+}
+
+func serve(config rl.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		defer conn.Close()
+		v, err := rl.NewVecEnv(*rom, *envs, config)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var req request
+			res := response{JSONRPC: "2.0"}
+			if err := json.Unmarshal(message, &req); err != nil {
+				res.Error = &rpcError{-32700, err.Error()}
+			} else if result, err := call(v, &req); err != nil {
+				res.ID = req.ID
+				res.Error = &rpcError{-32000, err.Error()}
+			} else {
+				res.ID = req.ID
+				res.Result = result
+			}
+			data, _ := json.Marshal(res)
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func main() {
+	flag.Parse()
+	t, ok := rl.Tasks[*task]
+	if !ok {
+		log.Fatalf("unknown task %s", *task)
+	}
+	obs, ok := observations[*observation]
+	if !ok {
+		log.Fatalf("unknown observation type %s", *observation)
+	}
+	config := rl.Config{Observation: obs, Width: *size, Height: *size, Task: t}
+	http.HandleFunc("/env", serve(config))
+	log.Printf("serving %s on %s/env", *rom, *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -1,7 +1,15 @@
 package main
 
 import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
 	"io/ioutil"
 	"log"
 	"os"
@@ -11,42 +19,375 @@ import (
 	"github.com/fogleman/nes/nes"
 )
 
-func testRom(path string) (err error) {
+var (
+	coverage = flag.Bool("coverage", false, "report PRG and CHR coverage")
+	cdlDir   = flag.String("cdl", "", "write FCEUX .cdl files to this directory")
+	frames   = flag.Int("frames", 180, "number of frames to run each rom")
+	every    = flag.Int("every", 60, "frames between screenshot checkpoints")
+	movies   = flag.String("movies", "", "directory of input movies named after the roms (.nesm or .fm2)")
+	baseline = flag.String("baseline", "", "compare screenshots against the baseline in this directory")
+	update   = flag.Bool("update", false, "write the screenshots to the baseline directory")
+	report   = flag.String("report", "", "write a JSON and HTML report with image diffs to this directory")
+)
+
+// Checkpoint is the screenshot hash at the end of a frame
+type Checkpoint struct {
+	Frame int    `json:"frame"`
+	Hash  string `json:"hash"`
+}
+
+// Baseline is the stored result of a regression run; screenshots are kept
+// next to it as <rom>/<frame>.png
+type Baseline struct {
+	Frames int                     `json:"frames"`
+	Every  int                     `json:"every"`
+	ROMs   map[string][]Checkpoint `json:"roms"`
+}
+
+// Mismatch is a checkpoint whose screenshot differs from the baseline
+type Mismatch struct {
+	Frame    int       `json:"frame"`
+	Expected string    `json:"expected"`
+	Actual   string    `json:"actual"`
+	Pixels   int       `json:"pixels"`
+	Images   [3]string `json:"images"` // expected, actual and diff, relative to the report
+}
+
+// Result is the outcome of one rom in the report
+type Result struct {
+	ROM        string     `json:"rom"`
+	Status     string     `json:"status"` // OK, DIFF, NEW or FAIL
+	Error      string     `json:"error,omitempty"`
+	Mismatches []Mismatch `json:"mismatches,omitempty"`
+}
+
+type run struct {
+	cdl         *nes.CodeDataLogger
+	checkpoints []Checkpoint
+	images      []*image.RGBA
+}
+
+func testRom(path string) (r run, err error) {
 	defer func() {
-		if r := recover(); r != nil {
-			err = r.(error)
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
 		}
 	}()
 	console, err := nes.NewConsole(path)
 	if err != nil {
-		return err
+		return r, err
+	}
+	if *coverage || *cdlDir != "" {
+		r.cdl = console.StartCDL()
+	}
+	if *movies != "" {
+		if m := findMovie(path); m != nil {
+			if err := console.PlayMovie(m); err != nil {
+				return r, err
+			}
+		}
+	}
+	for frame := 1; frame <= *frames; frame++ {
+		console.StepFrame()
+		if frame%*every != 0 && frame != *frames {
+			continue
+		}
+		buffer := console.Buffer()
+		hash := md5.Sum(buffer.Pix)
+		r.checkpoints = append(r.checkpoints,
+			Checkpoint{frame, hex.EncodeToString(hash[:])})
+		screenshot := image.NewRGBA(buffer.Rect)
+		copy(screenshot.Pix, buffer.Pix)
+		r.images = append(r.images, screenshot)
+	}
+	return r, nil
+}
+
+// findMovie loads the movie for a rom, if there is one
+func findMovie(romPath string) *nes.Movie {
+	base := path.Base(romPath)
+	base = strings.TrimSuffix(base, path.Ext(base))
+	for _, ext := range []string{".nesm", ".fm2"} {
+		m, err := nes.LoadMovieFile(path.Join(*movies, base+ext))
+		if err == nil {
+			return m
+		}
+		if !os.IsNotExist(err) {
+			log.Println(err)
+		}
 	}
-	console.StepSeconds(3)
 	return nil
 }
 
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
+
+func savePNG(filename string, im image.Image) error {
+	if err := os.MkdirAll(path.Dir(filename), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, im); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func loadPNG(filename string) (image.Image, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return png.Decode(file)
+}
+
+// diffImage marks differing pixels in red over a faded copy of the actual
+// screenshot and returns the number of differing pixels
+func diffImage(expected image.Image, actual *image.RGBA) (*image.RGBA, int) {
+	bounds := actual.Bounds()
+	diff := image.NewRGBA(bounds)
+	n := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			a := actual.RGBAAt(x, y)
+			er, eg, eb, _ := expected.At(x, y).RGBA()
+			if byte(er>>8) != a.R || byte(eg>>8) != a.G || byte(eb>>8) != a.B {
+				diff.SetRGBA(x, y, color.RGBA{255, 0, 0, 255})
+				n++
+				continue
+			}
+			gray := byte((int(a.R) + int(a.G) + int(a.B)) / 6)
+			diff.SetRGBA(x, y, color.RGBA{gray, gray, gray, 255})
+		}
+	}
+	return diff, n
+}
+
+func loadBaseline(dir string) Baseline {
+	b := Baseline{Frames: *frames, Every: *every, ROMs: make(map[string][]Checkpoint)}
+	data, err := ioutil.ReadFile(path.Join(dir, "baseline.json"))
+	if os.IsNotExist(err) {
+		return b
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &b)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if b.Frames != *frames || b.Every != *every {
+		log.Fatalf("baseline was made with -frames %d -every %d", b.Frames, b.Every)
+	}
+	return b
+}
+
+func saveBaseline(dir string, b Baseline) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(dir, "baseline.json"), data, 0644)
+}
+
+// compare checks a run against the checkpoints from the baseline in
+// baselineDir. If reportDir is not empty, the expected and actual
+// screenshots of any differences are written there along with a diff.
+func compare(name string, r run, want []Checkpoint, baselineDir, reportDir string) Result {
+	result := Result{ROM: name, Status: "OK"}
+	if want == nil {
+		result.Status = "NEW"
+		return result
+	}
+	for i, c := range r.checkpoints {
+		if i < len(want) && want[i] == c {
+			continue
+		}
+		result.Status = "DIFF"
+		m := Mismatch{Frame: c.Frame, Actual: c.Hash}
+		if i < len(want) {
+			m.Expected = want[i].Hash
+		}
+		if reportDir != "" {
+			m.Images = [3]string{
+				path.Join(name, fmt.Sprintf("%d-expected.png", c.Frame)),
+				path.Join(name, fmt.Sprintf("%d-actual.png", c.Frame)),
+				path.Join(name, fmt.Sprintf("%d-diff.png", c.Frame)),
+			}
+			expected, err := loadPNG(path.Join(baselineDir, name, fmt.Sprintf("%d.png", c.Frame)))
+			if err != nil {
+				log.Println(err)
+				expected = image.NewRGBA(r.images[i].Rect)
+			}
+			diff, n := diffImage(expected, r.images[i])
+			m.Pixels = n
+			for j, im := range []image.Image{expected, r.images[i], diff} {
+				if err := savePNG(path.Join(reportDir, m.Images[j]), im); err != nil {
+					log.Println(err)
+				}
+			}
+		}
+		result.Mismatches = append(result.Mismatches, m)
+	}
+	return result
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ROM regression report</title>
+<style>
+body { font-family: sans-serif; }
+td, th { padding: 4px 8px; text-align: left; vertical-align: top; }
+img { width: 256px; image-rendering: pixelated; }
+.OK { color: green; } .DIFF, .FAIL { color: red; } .NEW { color: gray; }
+</style>
+</head>
+<body>
+<h1>ROM regression report</h1>
+<table>
+<tr><th>Status</th><th>ROM</th><th>Details</th></tr>
+{{range .}}
+<tr>
+<td class="{{.Status}}">{{.Status}}</td>
+<td>{{.ROM}}</td>
+<td>
+{{if .Error}}{{.Error}}{{end}}
+{{range .Mismatches}}
+<p>frame {{.Frame}}: {{.Pixels}} pixels differ</p>
+<img src="{{index .Images 0}}" title="expected">
+<img src="{{index .Images 1}}" title="actual">
+<img src="{{index .Images 2}}" title="diff">
+{{end}}
+</td>
+</tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
+
+func writeReport(dir string, results []Result) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "report.json"), data, 0644); err != nil {
+		return err
+	}
+	file, err := os.Create(path.Join(dir, "index.html"))
+	if err != nil {
+		return err
+	}
+	if err := reportTemplate.Execute(file, results); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
 func main() {
-	args := os.Args[1:]
-	if len(args) != 1 {
-		log.Fatalln("Usage: go run util/roms.go roms_directory")
+	flag.Usage = func() {
+		log.Println("Usage: go run util/roms.go [-coverage] [-cdl dir] [-baseline dir [-update] [-report dir]] roms_directory")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) != 1 || *every < 1 || *frames < 1 ||
+		(*update || *report != "") && *baseline == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *cdlDir != "" {
+		if err := os.MkdirAll(*cdlDir, 0755); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	var base Baseline
+	if *baseline != "" {
+		base = loadBaseline(*baseline)
 	}
 	dir := args[0]
 	infos, err := ioutil.ReadDir(dir)
 	if err != nil {
 		panic(err)
 	}
+	var results []Result
+	failed := false
 	for _, info := range infos {
 		name := info.Name()
-		if !strings.HasSuffix(name, ".nes") {
+		if !nes.IsROMFile(name) {
 			continue
 		}
-		name = path.Join(dir, name)
-		err := testRom(name)
-		if err == nil {
-			fmt.Println("OK  ", name)
-		} else {
-			fmt.Println("FAIL", name)
+		romPath := path.Join(dir, name)
+		r, err := testRom(romPath)
+		if err != nil {
+			fmt.Println("FAIL", romPath)
 			fmt.Println(err)
+			results = append(results, Result{ROM: name, Status: "FAIL", Error: err.Error()})
+			// roms that never ran aren't regressions
+			failed = failed || base.ROMs[name] != nil
+			continue
+		}
+		status := "OK  "
+		if *baseline != "" {
+			result := compare(name, r, base.ROMs[name], *baseline, *report)
+			results = append(results, result)
+			status = fmt.Sprintf("%-4s", result.Status)
+			if result.Status == "DIFF" {
+				failed = true
+				for _, m := range result.Mismatches {
+					fmt.Printf("     frame %d: %s != %s\n", m.Frame, m.Actual, m.Expected)
+				}
+			}
+			if *update {
+				base.ROMs[name] = r.checkpoints
+				for i, c := range r.checkpoints {
+					filename := path.Join(*baseline, name, fmt.Sprintf("%d.png", c.Frame))
+					if err := savePNG(filename, r.images[i]); err != nil {
+						log.Fatalln(err)
+					}
+				}
+			}
+		}
+		if r.cdl == nil {
+			fmt.Println(status, romPath)
+			continue
+		}
+		c := r.cdl.Coverage()
+		fmt.Printf("%s %s  PRG %.1f%% (code %.1f%%, data %.1f%%)  CHR %.1f%%\n",
+			status, romPath, percent(c.PRGUsed, c.PRGSize), percent(c.Code, c.PRGSize),
+			percent(c.Data, c.PRGSize), percent(c.CHRUsed, c.CHRSize))
+		if *cdlDir != "" {
+			base := strings.TrimSuffix(name, path.Ext(name)) + ".cdl"
+			if err := r.cdl.SaveFile(path.Join(*cdlDir, base)); err != nil {
+				fmt.Println(err)
+			}
 		}
 	}
+	if *update {
+		if err := saveBaseline(*baseline, base); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if *report != "" {
+		if err := writeReport(*report, results); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if failed && *baseline != "" && !*update {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	baselineDir := path.Join(dir, "baseline")
+	reportDir := path.Join(dir, "report")
+
+	expected := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range expected.Pix {
+		expected.Pix[i] = 0xFF
+	}
+	if err := savePNG(path.Join(baselineDir, "game.nes", "60.png"), expected); err != nil {
+		t.Fatal(err)
+	}
+	actual := image.NewRGBA(expected.Rect)
+	copy(actual.Pix, expected.Pix)
+	actual.SetRGBA(2, 1, color.RGBA{0, 0, 0, 255})
+	want := []Checkpoint{{60, "expected"}}
+
+	r := run{checkpoints: []Checkpoint{{60, "expected"}}, images: []*image.RGBA{actual}}
+	if result := compare("game.nes", r, want, baselineDir, reportDir); result.Status != "OK" {
+		t.Errorf("same hash: got %+v", result)
+	}
+	if result := compare("game.nes", r, nil, baselineDir, reportDir); result.Status != "NEW" {
+		t.Errorf("no baseline: got %+v", result)
+	}
+
+	r.checkpoints[0].Hash = "actual"
+	result := compare("game.nes", r, want, baselineDir, reportDir)
+	if result.Status != "DIFF" || len(result.Mismatches) != 1 {
+		t.Fatalf("got %+v", result)
+	}
+	m := result.Mismatches[0]
+	if m.Frame != 60 || m.Expected != "expected" || m.Actual != "actual" || m.Pixels != 1 {
+		t.Errorf("got mismatch %+v", m)
+	}
+	diff, err := loadPNG(path.Join(reportDir, m.Images[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if red, green, _, _ := diff.At(2, 1).RGBA(); red != 0xFFFF || green != 0 {
+		t.Error("differing pixel not marked in the diff")
+	}
+	if red, green, _, _ := diff.At(0, 0).RGBA(); red != green {
+		t.Error("matching pixel marked in the diff")
+	}
+	for _, name := range m.Images[:2] {
+		if _, err := os.Stat(path.Join(reportDir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Command statediff loads two save states of the same game and reports
+// which components and fields differ.
+//
+//	statediff game.nes a.dat b.dat
+//
+// The exit status is 1 if the states differ.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/fogleman/nes/nes"
+)
+
+func load(rom, state string) *nes.Console {
+	console, err := nes.NewConsole(rom)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := console.LoadState(state); err != nil {
+		log.Fatalf("%s: %v", state, err)
+	}
+	return console
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: statediff rom_file state_a state_b")
+	}
+	flag.Parse()
+	if flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	a := load(flag.Arg(0), flag.Arg(1))
+	b := load(flag.Arg(0), flag.Arg(2))
+	fmt.Printf("%x %s\n", a.StateHash(), flag.Arg(1))
+	fmt.Printf("%x %s\n", b.StateHash(), flag.Arg(2))
+	diffs := nes.DiffState(a, b)
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+}